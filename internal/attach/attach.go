@@ -0,0 +1,351 @@
+// Package attach reads files to send along with a prompt: paths, globs and
+// directories are expanded, binary and git-ignored files are skipped, and
+// the rest is embedded in fenced code blocks that fit a token budget.
+package attach
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// File is a file attached to a prompt
+type File struct {
+	Path      string // As given or found, relative when the pattern was
+	Content   string
+	Truncated bool // Content was cut to fit the budget
+}
+
+// Skipped is a file that matched but is not attached
+type Skipped struct {
+	Path   string
+	Reason string
+}
+
+// sniffLen is how much of a file is checked for binary content, as git does
+const sniffLen = 8000
+
+// Collect expands patterns into files. A pattern is a path, a glob where
+// "**" matches any number of directories, or a directory, which includes
+// the files below it. Files are read once each, in order. Binary files and
+// files a .gitignore excludes are skipped and reported. A pattern that
+// matches nothing is an error.
+func Collect(patterns []string) ([]File, []Skipped, error) {
+	var files []File
+	var skipped []Skipped
+	seen := map[string]bool{}
+	ignorers := map[string]*ignorer{}
+
+	for _, pattern := range patterns {
+		paths, err := expand(pattern)
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(paths) == 0 {
+			return nil, nil, fmt.Errorf("no files match %s", pattern)
+		}
+		for _, p := range paths {
+			abs, err := filepath.Abs(p)
+			if err != nil {
+				return nil, nil, err
+			}
+			if seen[abs] {
+				continue
+			}
+			seen[abs] = true
+
+			if isIgnored(ignorers, abs) {
+				skipped = append(skipped, Skipped{Path: p, Reason: "ignored by .gitignore"})
+				continue
+			}
+			data, err := os.ReadFile(p)
+			if err != nil {
+				return nil, nil, err
+			}
+			if isBinary(data) {
+				skipped = append(skipped, Skipped{Path: p, Reason: "binary"})
+				continue
+			}
+			files = append(files, File{Path: p, Content: string(data)})
+		}
+	}
+	return files, skipped, nil
+}
+
+// isIgnored checks abs against the .gitignore files of its repository
+func isIgnored(ignorers map[string]*ignorer, abs string) bool {
+	root := repoRoot(filepath.Dir(abs))
+	if root == "" {
+		return false
+	}
+	ig, ok := ignorers[root]
+	if !ok {
+		ig = newIgnorer(root)
+		ignorers[root] = ig
+	}
+	return ig.ignored(abs, false)
+}
+
+// expand returns the regular files a pattern names
+func expand(pattern string) ([]string, error) {
+	if rest, ok := strings.CutPrefix(pattern, "~/"); ok {
+		if home, err := os.UserHomeDir(); err == nil {
+			pattern = filepath.Join(home, rest)
+		}
+	}
+
+	var matches []string
+	switch {
+	case strings.Contains(pattern, "**"):
+		var err error
+		if matches, err = globStar(pattern); err != nil {
+			return nil, err
+		}
+	case strings.ContainsAny(pattern, "*?["):
+		var err error
+		if matches, err = filepath.Glob(pattern); err != nil {
+			return nil, fmt.Errorf("invalid pattern %s: %w", pattern, err)
+		}
+	default:
+		if _, err := os.Stat(pattern); errors.Is(err, fs.ErrNotExist) {
+			return nil, nil // Reported as matching nothing
+		} else if err != nil {
+			return nil, err
+		}
+		matches = []string{pattern}
+	}
+
+	var files []string
+	for _, m := range matches {
+		info, err := os.Stat(m)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			files = append(files, m)
+			continue
+		}
+		found, err := walkFiles(m)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, found...)
+	}
+	return files, nil
+}
+
+// walkFiles returns the regular files below dir
+func walkFiles(dir string) ([]string, error) {
+	var files []string
+	err := walk(dir, func(p string) {
+		files = append(files, p)
+	})
+	return files, err
+}
+
+// walk calls fn for each regular file below dir, leaving out .git and the
+// directories a .gitignore excludes
+func walk(dir string, fn func(path string)) error {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return err
+	}
+	var ig *ignorer
+	if root := repoRoot(abs); root != "" {
+		ig = newIgnorer(root)
+	}
+
+	return filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if d.Name() == ".git" {
+				return filepath.SkipDir
+			}
+			if p != dir && ig != nil {
+				if abs, err := filepath.Abs(p); err == nil && ig.ignored(abs, true) {
+					return filepath.SkipDir
+				}
+			}
+			return nil
+		}
+		if d.Type().IsRegular() {
+			fn(p)
+		}
+		return nil
+	})
+}
+
+// globStar matches a pattern in which "**" stands for any number of
+// directories, e.g. "internal/**/*.go"
+func globStar(pattern string) ([]string, error) {
+	// Walk from the longest leading part without wildcards
+	parts := strings.Split(filepath.ToSlash(filepath.Clean(pattern)), "/")
+	root := "."
+	for i, part := range parts {
+		if strings.ContainsAny(part, "*?[") {
+			if i > 0 {
+				root = strings.Join(parts[:i], "/")
+				if root == "" {
+					root = "/"
+				}
+			}
+			break
+		}
+	}
+
+	var matches []string
+	err := walk(filepath.FromSlash(root), func(p string) {
+		if matchSegments(parts, strings.Split(filepath.ToSlash(p), "/")) {
+			matches = append(matches, p)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(matches)
+	return matches, nil
+}
+
+// isBinary reports whether data looks like a binary file: a NUL byte near
+// the start, or text that is not UTF-8
+func isBinary(data []byte) bool {
+	head := data[:min(len(data), sniffLen)]
+	if bytes.IndexByte(head, 0) >= 0 {
+		return true
+	}
+	// A multi-byte character may be cut at the end of the sample
+	for i := 0; i < utf8.UTFMax && len(head) > 0 && !utf8.Valid(head); i++ {
+		head = head[:len(head)-1]
+	}
+	return !utf8.Valid(head)
+}
+
+// languages maps file extensions to the language named on a code fence
+var languages = map[string]string{
+	".go":    "go",
+	".py":    "python",
+	".js":    "javascript",
+	".jsx":   "jsx",
+	".ts":    "typescript",
+	".tsx":   "tsx",
+	".rb":    "ruby",
+	".rs":    "rust",
+	".java":  "java",
+	".kt":    "kotlin",
+	".swift": "swift",
+	".c":     "c",
+	".h":     "c",
+	".cpp":   "cpp",
+	".cc":    "cpp",
+	".hpp":   "cpp",
+	".cs":    "csharp",
+	".php":   "php",
+	".sh":    "bash",
+	".bash":  "bash",
+	".zsh":   "zsh",
+	".sql":   "sql",
+	".html":  "html",
+	".css":   "css",
+	".json":  "json",
+	".yaml":  "yaml",
+	".yml":   "yaml",
+	".toml":  "toml",
+	".xml":   "xml",
+	".md":    "markdown",
+	".proto": "protobuf",
+	".tf":    "hcl",
+	".lua":   "lua",
+}
+
+// Language returns the code fence language for a file, or "" if unknown
+func Language(path string) string {
+	switch name := filepath.Base(path); {
+	case name == "Makefile" || name == "GNUmakefile":
+		return "makefile"
+	case name == "Dockerfile" || strings.HasPrefix(name, "Dockerfile."):
+		return "dockerfile"
+	}
+	return languages[strings.ToLower(filepath.Ext(path))]
+}
+
+// Format embeds the files in a prompt, each under its path in a code fence
+// tagged with its language
+func Format(files []File) string {
+	var b strings.Builder
+	for i, f := range files {
+		if i > 0 {
+			b.WriteString("\n\n")
+		}
+		content := strings.TrimRight(f.Content, "\n")
+		// A longer fence keeps fences inside the file, as in Markdown, intact
+		fence := "```"
+		for strings.Contains(content, fence) {
+			fence += "`"
+		}
+		fmt.Fprintf(&b, "File: %s", filepath.ToSlash(f.Path))
+		if f.Truncated {
+			b.WriteString(" (truncated)")
+		}
+		fmt.Fprintf(&b, "\n%s%s\n%s\n%s", fence, Language(f.Path), content, fence)
+	}
+	return b.String()
+}
+
+// Fit keeps as many files as fit in budget tokens, counted with count. The
+// file that crosses the budget is cut at a line boundary and marked
+// Truncated; the files after it are dropped. It returns the files kept and
+// the paths of those dropped.
+func Fit(files []File, budget int, count func(string) int) ([]File, []string) {
+	var kept []File
+	var dropped []string
+	used := 0
+	full := false
+	for _, f := range files {
+		if full {
+			dropped = append(dropped, f.Path)
+			continue
+		}
+		cost := count(Format([]File{f})) + 2 // The blank line between files
+		if used+cost <= budget {
+			kept = append(kept, f)
+			used += cost
+			continue
+		}
+		full = true
+		if cut, ok := truncate(f, budget-used, count); ok {
+			kept = append(kept, cut)
+		} else {
+			dropped = append(dropped, f.Path)
+		}
+	}
+	return kept, dropped
+}
+
+// truncate cuts f to the most whole lines that fit in budget tokens. It
+// fails when not even the first line fits.
+func truncate(f File, budget int, count func(string) int) (File, bool) {
+	lines := strings.SplitAfter(f.Content, "\n")
+	// Binary search for the number of lines that fit
+	lo, hi := 0, len(lines)
+	for lo < hi {
+		mid := (lo + hi + 1) / 2
+		cut := File{Path: f.Path, Content: strings.Join(lines[:mid], ""), Truncated: true}
+		if count(Format([]File{cut})) <= budget {
+			lo = mid
+		} else {
+			hi = mid - 1
+		}
+	}
+	if lo == 0 {
+		return File{}, false
+	}
+	return File{Path: f.Path, Content: strings.Join(lines[:lo], ""), Truncated: true}, true
+}
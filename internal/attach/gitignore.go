@@ -0,0 +1,157 @@
+package attach
+
+import (
+	"bufio"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// ignoreRule is one pattern line of a .gitignore file
+type ignoreRule struct {
+	segments []string // Pattern split at slashes
+	negate   bool     // "!" re-includes what earlier rules excluded
+	dirOnly  bool     // A trailing slash matches directories only
+	anchored bool     // Contains a slash, so it matches from the .gitignore's directory
+}
+
+// parseIgnore reads the rules of a .gitignore file. A missing file has none.
+func parseIgnore(file string) []ignoreRule {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	var rules []ignoreRule
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), " \r")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		var r ignoreRule
+		if rest, ok := strings.CutPrefix(line, "!"); ok {
+			r.negate = true
+			line = rest
+		}
+		line = strings.TrimPrefix(line, `\`)
+		if rest, ok := strings.CutSuffix(line, "/"); ok {
+			r.dirOnly = true
+			line = rest
+		}
+		r.anchored = strings.Contains(line, "/")
+		r.segments = strings.Split(strings.TrimPrefix(line, "/"), "/")
+		rules = append(rules, r)
+	}
+	return rules
+}
+
+// matches reports whether the rule applies to rel, a slash-separated path
+// relative to the .gitignore's directory
+func (r ignoreRule) matches(rel string, isDir bool) bool {
+	if r.dirOnly && !isDir {
+		return false
+	}
+	parts := strings.Split(rel, "/")
+	if !r.anchored {
+		// A bare name matches at any depth
+		ok, _ := path.Match(r.segments[0], parts[len(parts)-1])
+		return ok
+	}
+	return matchSegments(r.segments, parts)
+}
+
+// matchSegments matches path segments against pattern segments, where "**"
+// stands for any number of directories
+func matchSegments(pattern, parts []string) bool {
+	if len(pattern) == 0 {
+		return len(parts) == 0
+	}
+	if pattern[0] == "**" {
+		for i := 0; i <= len(parts); i++ {
+			if matchSegments(pattern[1:], parts[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(parts) == 0 {
+		return false
+	}
+	if ok, _ := path.Match(pattern[0], parts[0]); !ok {
+		return false
+	}
+	return matchSegments(pattern[1:], parts[1:])
+}
+
+// ignorer applies the .gitignore files between a root directory and the
+// files below it, as git does: deeper files override shallower ones, and
+// nothing inside an ignored directory is included again
+type ignorer struct {
+	root  string
+	rules map[string][]ignoreRule // By directory, read on first use
+}
+
+func newIgnorer(root string) *ignorer {
+	return &ignorer{root: root, rules: map[string][]ignoreRule{}}
+}
+
+// rulesIn returns the rules of the .gitignore in dir
+func (ig *ignorer) rulesIn(dir string) []ignoreRule {
+	rules, ok := ig.rules[dir]
+	if !ok {
+		rules = parseIgnore(filepath.Join(dir, ".gitignore"))
+		ig.rules[dir] = rules
+	}
+	return rules
+}
+
+// ignored reports whether file, an absolute path below the root, is ignored
+func (ig *ignorer) ignored(file string, isDir bool) bool {
+	rel, err := filepath.Rel(ig.root, file)
+	if err != nil || !filepath.IsLocal(rel) {
+		return false
+	}
+	parts := strings.Split(filepath.ToSlash(rel), "/")
+	// Each parent directory is checked first, since an ignored directory
+	// hides everything in it
+	for i := 1; i <= len(parts); i++ {
+		if ig.decide(parts[:i], isDir || i < len(parts)) {
+			return true
+		}
+	}
+	return false
+}
+
+// decide applies every .gitignore from the root down to the path's parent
+func (ig *ignorer) decide(parts []string, isDir bool) bool {
+	ignored := false
+	dir := ig.root
+	for depth := 0; depth < len(parts); depth++ {
+		rel := strings.Join(parts[depth:], "/")
+		for _, r := range ig.rulesIn(dir) {
+			if r.matches(rel, isDir) {
+				ignored = !r.negate
+			}
+		}
+		dir = filepath.Join(dir, parts[depth])
+	}
+	return ignored
+}
+
+// repoRoot returns the closest directory at or above dir that holds .git, or
+// "" outside a repository
+func repoRoot(dir string) string {
+	for {
+		if _, err := os.Stat(filepath.Join(dir, ".git")); err == nil {
+			return dir
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
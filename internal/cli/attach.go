@@ -0,0 +1,170 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/valdezdata/chat-cli/internal/attach"
+	"github.com/valdezdata/chat-cli/internal/providers"
+	"github.com/valdezdata/chat-cli/internal/tokens"
+
+	"github.com/fatih/color"
+)
+
+// defaultContextTokens are conservative context windows, used when
+// context_tokens is not set. Models differ; these suit the smaller ones.
+var defaultContextTokens = map[Provider]int{
+	ProviderOllama:   4096, // Ollama's default num_ctx, whatever the model supports
+	ProviderOpenAI:   128000,
+	ProviderTogether: 32768,
+	ProviderGroq:     32768,
+	ProviderSamba:    16384,
+	ProviderGemini:   1000000,
+	ProviderCompat:   8192,
+}
+
+// contextTokens returns the context window attached files must fit in
+func (opts *ChatOptions) contextTokens() int {
+	if opts.ContextTokens > 0 {
+		return opts.ContextTokens
+	}
+	return defaultContextTokens[opts.Provider]
+}
+
+// attachmentBudget returns the tokens left for attached files once the
+// system prompt, the conversation, the prompt and room for the reply are
+// counted. The reply gets max_tokens, but at most a quarter of the window.
+func attachmentBudget(opts *ChatOptions, conversation []providers.Message, prompt string) int {
+	window := opts.contextTokens()
+	used := min(opts.MaxTokens, window/4) + tokens.Estimate(prompt)
+	system := opts.SystemPrompt
+	if system == "" {
+		system = providers.DefaultSystemPrompt
+	}
+	used += tokens.Estimate(system)
+	for _, m := range conversation {
+		used += tokens.Estimate(m.Content)
+	}
+	return window - used
+}
+
+// collectFiles reads the files patterns name, warning on w about those
+// skipped
+func collectFiles(w io.Writer, patterns []string) ([]attach.File, error) {
+	files, skipped, err := attach.Collect(patterns)
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range skipped {
+		color.New(color.FgYellow).Fprintf(w, "Skipping %s (%s)\n", s.Path, s.Reason)
+	}
+	return files, nil
+}
+
+// withFiles appends files to prompt, cut to budget tokens, and warns on w
+// about any that had to be truncated or left out
+func withFiles(w io.Writer, prompt string, files []attach.File, budget int) string {
+	budget = max(budget, 0)
+	kept, dropped := attach.Fit(files, budget, tokens.Estimate)
+	warn := color.New(color.FgYellow)
+	for _, f := range kept {
+		if f.Truncated {
+			warn.Fprintf(w, "Truncated %s to the %d tokens left in the context window (see context_tokens)\n", f.Path, budget)
+		}
+	}
+	if len(dropped) > 0 {
+		warn.Fprintf(w, "Left out %s: no room left in the context window (see context_tokens)\n", strings.Join(dropped, ", "))
+	}
+	if len(kept) == 0 {
+		return prompt
+	}
+	return prompt + "\n\n" + attach.Format(kept)
+}
+
+// withAttachments adds the files staged by /add to prompt and clears them
+func (s *chatState) withAttachments(prompt string) string {
+	if prompt == "" || len(s.attached) == 0 {
+		return prompt
+	}
+	files := s.attached
+	s.attached = nil
+	budget := attachmentBudget(s.opts, s.sess.conversation.messages, prompt)
+	return withFiles(s.out, prompt, files, budget)
+}
+
+// addCommand handles "/add <path|glob>...": the files are sent with the
+// next prompt. Without arguments it lists them.
+func addCommand(s *chatState, arg string) (string, error) {
+	if arg == "" {
+		if len(s.attached) == 0 {
+			return "", errors.New("usage: /add <path|glob>...")
+		}
+		fmt.Fprintln(s.out, "Files attached to the next prompt:")
+		for _, f := range s.attached {
+			fmt.Fprintf(s.out, "  %s\n", describeFile(f))
+		}
+		return "", nil
+	}
+
+	return "", s.attach(strings.Fields(arg))
+}
+
+// attach stages the files patterns name for the next prompt
+func (s *chatState) attach(patterns []string) error {
+	files, err := collectFiles(s.out, patterns)
+	if err != nil {
+		return err
+	}
+	added := 0
+	for _, f := range files {
+		if s.hasAttached(f.Path) {
+			continue
+		}
+		s.attached = append(s.attached, f)
+		fmt.Fprintf(s.out, "Attached %s\n", describeFile(f))
+		added++
+	}
+	if added == 0 {
+		fmt.Fprintln(s.out, "No new files to attach")
+		return nil
+	}
+	total := 0
+	for _, f := range s.attached {
+		total += tokens.Estimate(f.Content)
+	}
+	count := "1 file"
+	if len(s.attached) != 1 {
+		count = fmt.Sprintf("%d files", len(s.attached))
+	}
+	fmt.Fprintf(s.out, "%s, about %d tokens, will be sent with your next prompt\n", count, total)
+	return nil
+}
+
+// hasAttached reports whether path is already staged
+func (s *chatState) hasAttached(path string) bool {
+	for _, f := range s.attached {
+		if filepath.Clean(f.Path) == filepath.Clean(path) {
+			return true
+		}
+	}
+	return false
+}
+
+// describeFile summarizes an attached file, e.g. "main.go (120 lines, ~900 tokens)"
+func describeFile(f attach.File) string {
+	b := codeBlock{code: strings.TrimRight(f.Content, "\n")}
+	return fmt.Sprintf("%s (%s, ~%d tokens)", f.Path, b.lines(), tokens.Estimate(f.Content))
+}
+
+// completeLastPath completes the last of the paths in arg
+func completeLastPath(arg string) []string {
+	i := strings.LastIndex(arg, " ") + 1
+	var lines []string
+	for _, p := range completePath(arg[i:]) {
+		lines = append(lines, arg[:i]+p)
+	}
+	return lines
+}
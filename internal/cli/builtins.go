@@ -0,0 +1,522 @@
+package cli
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/valdezdata/chat-cli/internal/consts"
+	"github.com/valdezdata/chat-cli/internal/history"
+	"github.com/valdezdata/chat-cli/internal/providers"
+	"github.com/valdezdata/chat-cli/internal/templates"
+
+	"github.com/atotto/clipboard"
+	"github.com/fatih/color"
+	"github.com/mattn/go-isatty"
+)
+
+// completionTimeout bounds the model listing behind /model completion
+const completionTimeout = 5 * time.Second
+
+var errNoExchange = errors.New("there is no exchange in this conversation yet")
+
+func init() {
+	for _, c := range []*command{
+		{
+			name: "help", args: "[command]",
+			help: "Show the commands, or details for one.",
+			run: func(s *chatState, arg string) (string, error) {
+				return "", commands.printHelp(s.out, arg, s.keys)
+			},
+			complete: func(s *chatState, arg string) []string {
+				var names []string
+				for _, c := range commands.commands {
+					names = append(names, c.name)
+				}
+				return completeWords(arg, names...)
+			},
+		},
+		{
+			name: "exit", aliases: []string{"quit"},
+			help: "Leave the chat.",
+			run: func(s *chatState, arg string) (string, error) {
+				s.done = true
+				return "", nil
+			},
+		},
+		{
+			name: "clear",
+			help: "Clear the screen. The conversation is kept.",
+			run: func(s *chatState, arg string) (string, error) {
+				s.clear()
+				return "", nil
+			},
+		},
+		{
+			name: "paste",
+			help: "Enter multiline text, ending with a line containing only \"done\".",
+			run: func(s *chatState, arg string) (string, error) {
+				return s.readBlock("Enter your text (type 'done' on a new line when finished):\n"), nil
+			},
+		},
+		{
+			name: "model", args: "[name]",
+			help: "Show the model, or switch to another one. The conversation is kept.",
+			run:  modelCommand,
+			complete: func(s *chatState, arg string) []string {
+				return completeWords(arg, s.modelNames()...)
+			},
+		},
+		{
+			name: "provider", args: "[name [model]]",
+			help: "Show the provider, or switch to another one and its default or the given model. The conversation is kept.",
+			run:  providerCommand,
+			complete: func(s *chatState, arg string) []string {
+				return completeWords(arg, providerNames...)
+			},
+		},
+		{
+			name: "temp", args: "[value]",
+			help: "Show the temperature, or set it for the following requests.",
+			run:  tempCommand,
+		},
+		{
+			name: "system", args: "[prompt|reset]",
+			help: "Show the system prompt, or replace it. \"reset\" restores the default.",
+			run:  systemCommand,
+			complete: func(s *chatState, arg string) []string {
+				return completeWords(arg, "reset")
+			},
+		},
+		{
+			name: "save", args: "<file>",
+			help: "Save the conversation as JSON, as sent with secrets masked. \"chat-cli history import\" reads it too.",
+			run:  saveCommand,
+			complete: func(s *chatState, arg string) []string {
+				return completePath(arg)
+			},
+		},
+		{
+			name: "load", args: "<file|session-id|last>",
+			help: "Replace the conversation with one saved by /save, or with a session from history.",
+			run:  loadCommand,
+			complete: func(s *chatState, arg string) []string {
+				return append(completeWords(arg, "last"), completePath(arg)...)
+			},
+		},
+		{
+			name: "reset",
+			help: "Start a new conversation in a new history session.",
+			run: func(s *chatState, arg string) (string, error) {
+				s.sess = newSession()
+				fmt.Fprintf(s.out, "Started a new conversation (session %s)\n", s.sess.id)
+				return "", nil
+			},
+		},
+		{
+			name: "undo",
+			help: "Remove the last exchange from the conversation. History keeps it.",
+			run: func(s *chatState, arg string) (string, error) {
+				if _, ok := s.sess.conversation.dropLast(); !ok {
+					return "", errNoExchange
+				}
+				fmt.Fprintln(s.out, "Removed the last exchange")
+				return "", nil
+			},
+		},
+		{
+			name: "retry",
+			help: "Remove the last exchange and send its prompt again.",
+			run: func(s *chatState, arg string) (string, error) {
+				prompt, ok := s.sess.conversation.dropLast()
+				if !ok {
+					return "", errNoExchange
+				}
+				return s.sess.redactorFor(s.opts).Unmask(prompt), nil
+			},
+		},
+		{
+			name: "copy",
+			help: "Copy the last reply to the clipboard.",
+			run:  copyCommand,
+		},
+		{
+			name: "save-code", args: "[n <file>]",
+			help: "Save code block n of the last reply to a file, or list the blocks.",
+			run:  saveCodeCommand,
+			complete: func(s *chatState, arg string) []string {
+				return completeCodePath(arg)
+			},
+		},
+		{
+			name: "apply", args: "[n] <file>",
+			help: "Show how a code block of the last reply would change a file, and write it once confirmed. Without n, the block that names the file, or the only one, is used.",
+			run:  applyCommand,
+			complete: func(s *chatState, arg string) []string {
+				return completeCodePath(arg)
+			},
+		},
+		{
+			name: "add", args: "[path|glob...]",
+			help: "Attach files to the next prompt. Globs and directories are expanded; binary and git-ignored files are skipped. Without arguments, list the attached files.",
+			run:  addCommand,
+			complete: func(s *chatState, arg string) []string {
+				return completeLastPath(arg)
+			},
+		},
+		{
+			name: "history", args: "[count]",
+			help: "Show the exchanges in this conversation, or the last count of them.",
+			run:  historyCommand,
+		},
+		{
+			name: "assess", args: "[on|off]",
+			help: "Turn prompt assessment on or off, or toggle it.",
+			run:  assessCommand,
+			complete: func(s *chatState, arg string) []string {
+				return completeWords(arg, "on", "off")
+			},
+		},
+		{
+			name: "template", args: "<name> [key=value...]",
+			help: "Render a prompt template and send it. If it uses {{.input}}, you are asked to paste the input.",
+			run:  templateCommand,
+			complete: func(s *chatState, arg string) []string {
+				list, err := templates.List()
+				if err != nil || strings.Contains(arg, " ") {
+					return nil
+				}
+				var names []string
+				for _, t := range list {
+					names = append(names, t.Name)
+				}
+				return completeWords(arg, names...)
+			},
+		},
+	} {
+		commands.register(c)
+	}
+}
+
+func modelCommand(s *chatState, arg string) (string, error) {
+	if arg == "" {
+		fmt.Fprintf(s.out, "Model: %s (%s)\n", s.client.GetModelName(), s.opts.Provider)
+		return "", nil
+	}
+	next := *s.opts
+	next.Model = arg
+	if err := s.reconnect(next); err != nil {
+		return "", err
+	}
+	fmt.Fprintf(s.out, "Switched to model %s\n", s.client.GetModelName())
+	return "", nil
+}
+
+func providerCommand(s *chatState, arg string) (string, error) {
+	fields := strings.Fields(arg)
+	if len(fields) == 0 {
+		fmt.Fprintf(s.out, "Provider: %s (model %s)\n", s.opts.Provider, s.client.GetModelName())
+		return "", nil
+	}
+	if len(fields) > 2 {
+		return "", errors.New("usage: /provider [name [model]]")
+	}
+	var provider ProviderFlag
+	if err := provider.Set(fields[0]); err != nil {
+		return "", fmt.Errorf("invalid provider %q: %w", fields[0], err)
+	}
+
+	next := *s.opts
+	if Provider(provider) != s.opts.Provider {
+		// The base URL and key variable belong to the old provider
+		next.BaseURL = ""
+		next.APIKeyEnv = ""
+	}
+	next.Provider = Provider(provider)
+	next.Model = ""
+	if len(fields) == 2 {
+		next.Model = fields[1]
+	}
+	if err := s.reconnect(next); err != nil {
+		return "", err
+	}
+	fmt.Fprintf(s.out, "Switched to %s (model %s)\n", next.Provider, s.client.GetModelName())
+	return "", nil
+}
+
+func tempCommand(s *chatState, arg string) (string, error) {
+	if arg == "" {
+		fmt.Fprintf(s.out, "Temperature: %.2f\n", s.opts.Temperature)
+		return "", nil
+	}
+	temperature, err := strconv.ParseFloat(arg, 64)
+	if err != nil || temperature < 0 || temperature > 2 {
+		return "", fmt.Errorf("temperature must be a number between 0 and 2, got %q", arg)
+	}
+	s.opts.Temperature = temperature
+	fmt.Fprintf(s.out, "Temperature set to %.2f\n", temperature)
+	return "", nil
+}
+
+func systemCommand(s *chatState, arg string) (string, error) {
+	if arg == "" {
+		if s.opts.SystemPrompt == "" {
+			fmt.Fprintf(s.out, "System prompt (default): %s\n", providers.DefaultSystemPrompt)
+		} else {
+			fmt.Fprintf(s.out, "System prompt: %s\n", s.opts.SystemPrompt)
+		}
+		return "", nil
+	}
+	next := *s.opts
+	next.SystemPrompt = arg
+	if arg == "reset" {
+		next.SystemPrompt = ""
+	}
+	if err := s.reconnect(next); err != nil {
+		return "", err
+	}
+	fmt.Fprintln(s.out, "System prompt updated")
+	return "", nil
+}
+
+// transcript is the file format of /save and /load. It matches the
+// {"messages": [...]} form that "history import" reads.
+type transcript struct {
+	Provider string              `json:"provider,omitempty"`
+	Model    string              `json:"model,omitempty"`
+	Messages []providers.Message `json:"messages"`
+}
+
+func saveCommand(s *chatState, arg string) (string, error) {
+	if arg == "" {
+		return "", errors.New("usage: /save <file>")
+	}
+	t := transcript{
+		Provider: string(s.opts.Provider),
+		Model:    s.client.GetModelName(),
+	}
+	if s.opts.SystemPrompt != "" {
+		t.Messages = append(t.Messages, providers.Message{Role: consts.SystemRole, Content: s.opts.SystemPrompt})
+	}
+	t.Messages = append(t.Messages, s.sess.conversation.messages...)
+
+	data, err := json.MarshalIndent(t, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	path := expandHome(arg)
+	if err := os.WriteFile(path, append(data, '\n'), 0600); err != nil {
+		return "", fmt.Errorf("failed to save conversation: %w", err)
+	}
+	fmt.Fprintf(s.out, "Saved %d messages to %s\n", len(t.Messages), path)
+	return "", nil
+}
+
+func loadCommand(s *chatState, arg string) (string, error) {
+	if arg == "" {
+		return "", errors.New("usage: /load <file|session-id|last>")
+	}
+
+	path := expandHome(arg)
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		sessionID, entries, err := history.FindSession(arg)
+		if err != nil {
+			return "", fmt.Errorf("%s is neither a file nor a history session: %w", arg, err)
+		}
+		s.sess = resumeSession(sessionID, entries)
+		fmt.Fprintf(s.out, "Loaded session %s (%d turns)\n", sessionID, len(entries))
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	var t transcript
+	if err := json.Unmarshal(data, &t); err != nil {
+		return "", fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	sess := newSession()
+	system := s.opts.SystemPrompt
+	for _, m := range t.Messages {
+		switch m.Role {
+		case consts.SystemRole:
+			system = m.Content
+		case consts.UserRole, consts.AssistantRole:
+			sess.conversation.messages = append(sess.conversation.messages, m)
+		default:
+			return "", fmt.Errorf("%s: unknown message role %q", path, m.Role)
+		}
+	}
+
+	if system != s.opts.SystemPrompt {
+		next := *s.opts
+		next.SystemPrompt = system
+		if err := s.reconnect(next); err != nil {
+			return "", err
+		}
+	}
+	s.sess = sess
+	fmt.Fprintf(s.out, "Loaded %d messages from %s\n", len(sess.conversation.messages), path)
+	return "", nil
+}
+
+func copyCommand(s *chatState, arg string) (string, error) {
+	reply := s.sess.conversation.lastReply()
+	if reply == "" {
+		return "", errors.New("there is no reply to copy yet")
+	}
+	reply = s.sess.redactorFor(s.opts).Unmask(reply)
+
+	if err := copyToClipboard(reply); err != nil {
+		return "", err
+	}
+	fmt.Fprintf(s.out, "Copied %d characters\n", len(reply))
+	return "", nil
+}
+
+// copyToClipboard uses the system clipboard, falling back to the OSC 52
+// escape sequence, which most terminals support, also over SSH
+func copyToClipboard(text string) error {
+	err := clipboard.WriteAll(text)
+	if err == nil {
+		return nil
+	}
+	if !isatty.IsTerminal(os.Stdout.Fd()) {
+		return fmt.Errorf("failed to copy to the clipboard: %w", err)
+	}
+	fmt.Printf("\x1b]52;c;%s\a", base64.StdEncoding.EncodeToString([]byte(text)))
+	return nil
+}
+
+func historyCommand(s *chatState, arg string) (string, error) {
+	count := 0
+	if arg != "" {
+		n, err := strconv.Atoi(arg)
+		if err != nil || n < 1 {
+			return "", fmt.Errorf("count must be a positive number, got %q", arg)
+		}
+		count = n
+	}
+
+	type exchange struct{ prompt, reply string }
+	var exchanges []exchange
+	for _, m := range s.sess.conversation.messages {
+		switch {
+		case m.Role == consts.UserRole:
+			exchanges = append(exchanges, exchange{prompt: m.Content})
+		case len(exchanges) > 0:
+			exchanges[len(exchanges)-1].reply = m.Content
+		}
+	}
+	if len(exchanges) == 0 {
+		fmt.Fprintln(s.out, "No exchanges in this conversation yet")
+		return "", nil
+	}
+
+	first := 0
+	if count > 0 && count < len(exchanges) {
+		first = len(exchanges) - count
+	}
+	redactor := s.sess.redactorFor(s.opts)
+	fmt.Fprintf(s.out, "Session %s (%d exchanges):\n", s.sess.id, len(exchanges))
+	for i, e := range exchanges[first:] {
+		color.New(color.FgHiGreen).Fprintf(s.out, "%3d. You: ", first+i+1)
+		fmt.Fprintln(s.out, summarize(redactor.Unmask(e.prompt), 70))
+		color.New(color.FgMagenta).Fprint(s.out, "     Assistant: ")
+		fmt.Fprintln(s.out, summarize(redactor.Unmask(e.reply), 70))
+	}
+	return "", nil
+}
+
+func assessCommand(s *chatState, arg string) (string, error) {
+	switch arg {
+	case "":
+		s.opts.Assess = !s.opts.Assess
+	case "on":
+		s.opts.Assess = true
+	case "off":
+		s.opts.Assess = false
+	default:
+		return "", errors.New("usage: /assess [on|off]")
+	}
+	if s.opts.Assess {
+		fmt.Fprintln(s.out, "Prompt assessment on")
+	} else {
+		fmt.Fprintln(s.out, "Prompt assessment off")
+	}
+	return "", nil
+}
+
+// reconnect replaces the client with one created from next. The conversation
+// is sent with every request, so it carries over. The options are only
+// updated if that succeeds.
+func (s *chatState) reconnect(next ChatOptions) error {
+	client, err := CreateChatClient(next.Provider, next.clientConfig(), s.logger)
+	if err != nil {
+		return err
+	}
+	*s.opts = next
+	s.client = client
+	s.logger.Info("Switched to %s model %s", next.Provider, client.GetModelName())
+	return nil
+}
+
+// modelNames lists the active provider's models, asking the server once
+func (s *chatState) modelNames() []string {
+	if s == nil {
+		return nil
+	}
+	if models, ok := s.models[s.opts.Provider]; ok {
+		return models
+	}
+	var models []string
+	if lister, ok := s.client.(providers.ModelLister); ok {
+		ctx, cancel := context.WithTimeout(context.Background(), completionTimeout)
+		defer cancel()
+		listed, err := lister.ListModels(ctx)
+		if err != nil {
+			s.logger.Debug("Model completion unavailable: %v", err)
+		}
+		models = listed
+	}
+	s.models[s.opts.Provider] = models
+	return models
+}
+
+// completePath returns the files and directories that start with prefix
+func completePath(prefix string) []string {
+	matches, _ := filepath.Glob(expandHome(prefix) + "*")
+	for i, m := range matches {
+		if info, err := os.Stat(m); err == nil && info.IsDir() {
+			matches[i] = m + string(filepath.Separator)
+		}
+	}
+	return matches
+}
+
+// expandHome expands a leading ~/ to the home directory
+func expandHome(path string) string {
+	if rest, ok := strings.CutPrefix(path, "~/"); ok {
+		if home, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(home, rest)
+		}
+	}
+	return path
+}
+
+// summarize shortens text to one line of at most n characters
+func summarize(text string, n int) string {
+	text = strings.Join(strings.Fields(text), " ")
+	if runes := []rune(text); len(runes) > n {
+		return string(runes[:n-3]) + "..."
+	}
+	return text
+}
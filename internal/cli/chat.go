@@ -1,21 +1,27 @@
 package cli
 
 import (
-	"bufio"
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	"os/exec"
+	"os/signal"
 	"runtime"
 	"strings"
 	"time"
 
 	"github.com/valdezdata/chat-cli/internal/assessment"
+	"github.com/valdezdata/chat-cli/internal/config"
 	"github.com/valdezdata/chat-cli/internal/consts"
 	"github.com/valdezdata/chat-cli/internal/history"
 	"github.com/valdezdata/chat-cli/internal/logging"
 	"github.com/valdezdata/chat-cli/internal/providers"
+	"github.com/valdezdata/chat-cli/internal/tokens"
+	"github.com/valdezdata/chat-cli/internal/utils"
 
+	"github.com/charmbracelet/glamour"
 	"github.com/fatih/color"
 )
 
@@ -28,21 +34,105 @@ const (
 	ProviderSamba    Provider = "samba"
 	ProviderOpenAI   Provider = "openai"
 	ProviderGemini   Provider = "gemini"
+	ProviderCompat   Provider = "compat" // Any OpenAI-compatible server
 )
 
+// providerNames lists the supported providers, for completion
+var providerNames = []string{
+	string(ProviderTogether), string(ProviderOllama), string(ProviderGroq), string(ProviderSamba),
+	string(ProviderOpenAI), string(ProviderGemini), string(ProviderCompat),
+}
+
 type ChatOptions struct {
-	Verbose      bool
-	Provider     Provider
-	Assess       bool
-	Shell        bool
-	ShellPrompt  string
-	Temperature  float64
-	MaxTokens    int
-	OutputFormat string
-	LogLevel     string
-	LogToFile    bool
-	LogToConsole bool
-	SkipHistory  bool
+	Verbose       bool
+	Profile       string
+	Provider      Provider
+	Model         string
+	BaseURL       string
+	APIKeyEnv     string
+	SystemPrompt  string
+	Assess        bool
+	Shell         bool
+	ShellPrompt   string
+	Temperature   float64
+	MaxTokens     int
+	TopP          float64
+	Stop          []string
+	Seed          *int
+	OutputFormat  string
+	Quiet         bool
+	LogLevel      string
+	LogToFile     bool
+	LogToConsole  bool
+	SkipHistory   bool
+	Template      string             // Prompt template name for shell mode
+	TemplateVars  map[string]string  // Template variables from --var
+	Redaction     []utils.Detector   // Applied before prompts are sent or saved; nil uses the defaults
+	Input         config.InputConfig // Line editor settings for interactive mode
+	Render        RenderMode         // How replies are printed in interactive and text shell output
+	ExtractCode   string             // Shell mode: print only the code blocks in this language, or AnyLanguage
+	CodeDir       string             // With ExtractCode, write each block to a file in this directory
+	Files         []string           // Paths and globs attached to the shell prompt, or to the first interactive one
+	ContextTokens int                // Context window attached files must fit in; 0 uses a provider default
+}
+
+// ApplySettings copies the resolved configuration into the options
+func (opts *ChatOptions) ApplySettings(settings *config.Settings) error {
+	var provider ProviderFlag
+	if err := provider.Set(settings.Get(config.KeyProvider)); err != nil {
+		return fmt.Errorf("invalid provider %q: %w", settings.Get(config.KeyProvider), err)
+	}
+	temperature, err := settings.Float(config.KeyTemperature)
+	if err != nil {
+		return err
+	}
+	maxTokens, err := settings.Int(config.KeyMaxTokens)
+	if err != nil {
+		return err
+	}
+
+	opts.Profile = settings.Profile
+	opts.Provider = Provider(provider)
+	opts.Model = settings.Get(config.KeyModel)
+	opts.BaseURL = settings.Get(config.KeyBaseURL)
+	opts.APIKeyEnv = settings.Get(config.KeyAPIKeyEnv)
+	opts.Temperature = temperature
+	opts.MaxTokens = maxTokens
+	opts.SystemPrompt = settings.Get(config.KeySystemPrompt)
+	opts.OutputFormat = settings.Get(config.KeyFormat)
+	opts.ContextTokens = 0
+	if settings.Get(config.KeyContextTokens) != "" {
+		contextTokens, err := settings.Int(config.KeyContextTokens)
+		if err != nil {
+			return err
+		}
+		if contextTokens <= 0 {
+			return fmt.Errorf("invalid %s %d: must be positive", config.KeyContextTokens, contextTokens)
+		}
+		opts.ContextTokens = contextTokens
+	}
+	return nil
+}
+
+// clientConfig collects the settings used to initialize the provider client
+func (opts *ChatOptions) clientConfig() providers.Config {
+	return providers.Config{
+		Model:        opts.Model,
+		BaseURL:      opts.BaseURL,
+		APIKeyEnv:    opts.APIKeyEnv,
+		SystemPrompt: opts.SystemPrompt,
+	}
+}
+
+// messageParams collects the per-request model parameters from the options
+func (opts *ChatOptions) messageParams() providers.MessageParams {
+	return providers.MessageParams{
+		Temperature: opts.Temperature,
+		MaxTokens:   opts.MaxTokens,
+		TopP:        opts.TopP,
+		Stop:        opts.Stop,
+		Seed:        opts.Seed,
+	}
 }
 
 func setupLogging(opts *ChatOptions) (*logging.Logger, error) {
@@ -88,11 +178,11 @@ func (p *ProviderFlag) String() string {
 
 func (p *ProviderFlag) Set(value string) error {
 	switch value {
-	case string(ProviderTogether), string(ProviderOllama), string(ProviderGroq), string(ProviderSamba), string(ProviderOpenAI), string(ProviderGemini):
+	case string(ProviderTogether), string(ProviderOllama), string(ProviderGroq), string(ProviderSamba), string(ProviderOpenAI), string(ProviderGemini), string(ProviderCompat):
 		*p = ProviderFlag(value)
 		return nil
 	default:
-		return fmt.Errorf("must be one of: together, ollama, groq, samba, openai")
+		return fmt.Errorf("must be one of: together, ollama, groq, samba, openai, gemini, compat")
 	}
 }
 
@@ -125,7 +215,17 @@ func formatOutput(response, format string) string {
 	}
 }
 
-func CreateChatClient(provider Provider, logger *logging.Logger) (providers.ChatInterface, error) {
+// printShellReply prints a shell mode reply that was not streamed: its code
+// blocks with --extract-code, otherwise the formatted reply
+func printShellReply(response string, opts *ChatOptions) error {
+	if opts.ExtractCode != "" {
+		return extractCode(os.Stdout, response, opts.ExtractCode, opts.CodeDir, opts.Quiet)
+	}
+	fmt.Println(formatOutput(response, opts.OutputFormat))
+	return nil
+}
+
+func CreateChatClient(provider Provider, cfg providers.Config, logger *logging.Logger) (providers.ChatInterface, error) {
 	logger.Debug("Creating chat client for provider: %s", provider)
 
 	var client providers.ChatInterface
@@ -136,7 +236,6 @@ func CreateChatClient(provider Provider, logger *logging.Logger) (providers.Chat
 		if os.Getenv("TOGETHER_API_KEY") != "" {
 			logger.Debug("Initializing Together client")
 			client = &providers.TogetherClient{}
-			err = client.Initialize()
 		} else {
 			logger.Error("TOGETHER_API_KEY not set for Together provider")
 			return nil, fmt.Errorf("TOGETHER_API_KEY not set for Together provider")
@@ -145,7 +244,6 @@ func CreateChatClient(provider Provider, logger *logging.Logger) (providers.Chat
 		if os.Getenv("GROQ_API_KEY") != "" {
 			logger.Debug("Initializing Groq client")
 			client = &providers.GroqClient{}
-			err = client.Initialize()
 		} else {
 			logger.Error("GROQ_API_KEY not set for Groq provider")
 			return nil, fmt.Errorf("GROQ_API_KEY not set for Groq provider")
@@ -154,7 +252,6 @@ func CreateChatClient(provider Provider, logger *logging.Logger) (providers.Chat
 		if os.Getenv("SAMBA_API_KEY") != "" {
 			logger.Debug("Initializing Samba client")
 			client = &providers.SambaClient{}
-			err = client.Initialize()
 		} else {
 			logger.Error("SAMBA_API_KEY not set for Samba provider")
 			return nil, fmt.Errorf("SAMBA_API_KEY not set for Samba provider")
@@ -163,7 +260,6 @@ func CreateChatClient(provider Provider, logger *logging.Logger) (providers.Chat
 		if os.Getenv("OPENAI_API_KEY") != "" {
 			logger.Debug("Initializing OpenAI client")
 			client = &providers.OpenAIClient{}
-			err = client.Initialize()
 		} else {
 			logger.Error("OPENAI_API_KEY not set for OpenAI provider")
 			return nil, fmt.Errorf("OPENAI_API_KEY not set for OpenAI provider")
@@ -172,71 +268,102 @@ func CreateChatClient(provider Provider, logger *logging.Logger) (providers.Chat
 		if os.Getenv("GEMINI_API_KEY") != "" {
 			logger.Debug("Initializing Gemini client")
 			client = &providers.GeminiClient{}
-			err = client.Initialize()
 		} else {
 			logger.Error("GEMINI_API_KEY not set for Gemini provider")
 			return nil, fmt.Errorf("GEMINI_API_KEY not set for Gemini provider")
 		}
+	case ProviderCompat:
+		// The API key is optional and its variable is configurable, so
+		// Initialize reports a missing base URL or model instead
+		logger.Debug("Initializing OpenAI-compatible client")
+		client = &providers.CompatClient{}
 	case ProviderOllama:
 		logger.Debug("Initializing Ollama client")
 		client = &providers.OllamaClient{}
-		err = client.Initialize()
 	default:
 		logger.Error("Unsupported provider: %s", provider)
 		return nil, fmt.Errorf("unsupported provider: %s", provider)
 	}
 
-	if err != nil {
-		logger.Error("Failed to initialize client: %v", err)
-		return nil, err
-	}
-
-	// If the client supports setting a logger, set it
+	// If the client supports setting a logger, set it before initializing
 	if loggerAware, ok := client.(interface{ SetLogger(*logging.Logger) }); ok {
 		logger.Debug("Setting logger for client")
 		loggerAware.SetLogger(logger)
 	}
 
+	err = client.Initialize(cfg)
+	if err != nil {
+		logger.Error("Failed to initialize client: %v", err)
+		return nil, err
+	}
+
 	logger.Info("Successfully created chat client for %s provider", provider)
 	return client, nil
 }
 
-// sendMessageAndLogHistory sends a message to the LLM and logs the interaction to history
-func sendMessageAndLogHistory(client providers.ChatInterface, text string, opts *ChatOptions, logger *logging.Logger) (string, time.Duration, error) {
-	// Send the message using the existing client
-	response, elapsed, err := client.SendMessage(text)
+// sendMessageAndLogHistory sends a message to the LLM and logs the interaction to history.
+// Streamed chunks are delivered to sink, which may be nil. If ctx is canceled, the
+// partial response is still logged and returned along with the context error.
+// The returned usage is always filled in, estimated locally if the provider did not report it.
+func sendMessageAndLogHistory(ctx context.Context, client providers.ChatInterface, text string, opts *ChatOptions, sess *session, sink providers.Sink, logger *logging.Logger) (providers.Response, error) {
+	// Mask secrets before the prompt leaves the machine; the reply is
+	// un-masked for display but stored masked
+	redactor := sess.redactorFor(opts)
+	masked, findings, err := redactor.Redact(text)
+	reportFindings(findings, logger)
 	if err != nil {
-		return "", elapsed, err
+		return providers.Response{}, err
+	}
+
+	// Send the message using the existing client
+	messages := sess.conversation.with(masked)
+	unmasked, flush := unmaskSink(redactor, sink)
+	resp, err := client.SendMessage(ctx, messages, opts.messageParams(), unmasked)
+	flush()
+	if err != nil && !errors.Is(err, context.Canceled) {
+		resp.Content = redactor.Unmask(resp.Content)
+		return resp, err
+	}
+	// A partial reply to a canceled request stays in the conversation
+	sess.conversation.record(masked, resp.Content)
+	if resp.Usage.Source == "" {
+		logger.Debug("Provider did not report usage, estimating token counts")
+		resp.Usage = estimateUsage(masked, resp.Content)
 	}
 
-	// Skip history if requested
 	if opts.SkipHistory {
 		logger.Debug("Skipping history logging as requested")
-		return response, elapsed, nil
+	} else {
+		logHistory(client, masked, resp, opts, sess, logger)
 	}
+	resp.Content = redactor.Unmask(resp.Content)
+	return resp, err
+}
 
-	// Calculate approximate token counts (simple word-based approximation)
-	inputTokens := len(strings.Split(text, " "))
-	outputTokens := len(strings.Split(response, " "))
-	totalTokens := inputTokens + outputTokens
+// logHistory records a turn. prompt and resp hold masked text.
+func logHistory(client providers.ChatInterface, prompt string, resp providers.Response, opts *ChatOptions, sess *session, logger *logging.Logger) {
 
 	// Create history entry
 	entry := history.Entry{
 		Timestamp:    time.Now(),
+		SessionID:    sess.id,
+		Turn:         sess.nextTurn(),
 		Provider:     string(opts.Provider),
 		ModelName:    client.GetModelName(),
-		Prompt:       text,
-		Response:     response,
-		InputTokens:  inputTokens,
-		OutputTokens: outputTokens,
-		TotalTokens:  totalTokens,
-		TimeTaken:    elapsed.Seconds(),
+		SystemPrompt: opts.SystemPrompt,
+		Prompt:       prompt,
+		Response:     resp.Content,
+		InputTokens:  resp.Usage.InputTokens,
+		OutputTokens: resp.Usage.OutputTokens,
+		TotalTokens:  resp.Usage.TotalTokens,
+		TokenSource:  resp.Usage.Source,
+		TimeTaken:    resp.Elapsed.Seconds(),
 	}
 
 	// Add assessment if enabled
 	if opts.Assess {
 		// Create an assessment from the assessment package results
-		promptAssessment := assessment.EvaluatePromptForHistory(text)
+		promptAssessment := assessment.EvaluatePromptForHistory(prompt)
 
 		// Convert to history assessment format
 		assessmentEntry := &history.Assessment{
@@ -261,61 +388,155 @@ func sendMessageAndLogHistory(client providers.ChatInterface, text string, opts
 	if err := history.AddEntry(entry); err != nil {
 		logger.Error("Failed to log history: %v", err)
 	}
+}
 
-	return response, elapsed, nil
+// estimateUsage approximates token counts with the local estimator
+func estimateUsage(prompt, response string) providers.Usage {
+	estimator := tokens.Current()
+	input := estimator.Count(prompt)
+	output := estimator.Count(response)
+	return providers.Usage{
+		InputTokens:  input,
+		OutputTokens: output,
+		TotalTokens:  input + output,
+		Source:       "estimate:" + estimator.Name(),
+	}
 }
 
-func printMetrics(text, response string, elapsed time.Duration, assess bool) {
+func printMetrics(text string, resp providers.Response, assess bool) {
 	metricsColor := color.New(color.FgHiYellow)
 
-	inputTokens := len(strings.Split(text, " "))
-	outputTokens := len(strings.Split(response, " "))
-	totalTokens := inputTokens + outputTokens
-	tokensPerSecond := float64(totalTokens) / elapsed.Seconds()
+	usage := resp.Usage
+	label := history.TokenSourceLabel(usage.Source)
 
 	metricsColor.Println("\nMetrics:")
-	metricsColor.Printf("Time taken: %.2f seconds\n", elapsed.Seconds())
-	metricsColor.Printf("Speed: %.2f tokens/second\n", tokensPerSecond)
-	metricsColor.Printf("Input tokens: %d (approximate)\n", inputTokens)
-	metricsColor.Printf("Output tokens: %d (approximate)\n", outputTokens)
-	metricsColor.Printf("Total tokens: %d (approximate)\n", totalTokens)
+	metricsColor.Printf("Time taken: %.2f seconds\n", resp.Elapsed.Seconds())
+	if speed := outputSpeed(resp); speed > 0 {
+		metricsColor.Printf("Speed: %.2f output tokens/second\n", speed)
+	}
+	metricsColor.Printf("Input tokens: %d (%s)\n", usage.InputTokens, label)
+	metricsColor.Printf("Output tokens: %d (%s)\n", usage.OutputTokens, label)
+	metricsColor.Printf("Total tokens: %d (%s)\n", usage.TotalTokens, label)
 
 	if assess {
 		assessment.AssessPrompt(text)
 	}
 }
 
-func handleUserInput(scanner *bufio.Scanner, userPrompt func(format string, a ...interface{})) (string, bool) {
-	userPrompt("\n%s You: ", consts.PersonEmoji)
-	scanner.Scan()
-	text := scanner.Text()
-
-	switch text {
-	case "exit":
-		return "", true
-	case "clear":
-		clearScreen()
-		return "", false
-	case "paste":
-		userPrompt("Enter your text (type 'done' on a new line when finished):\n")
-		var builder strings.Builder
-		for scanner.Scan() {
-			line := scanner.Text()
-			if line == "done" {
-				break
-			}
-			builder.WriteString(line + "\n")
+// outputSpeed returns the output tokens per second of a response, or 0 when
+// it took no measurable time
+func outputSpeed(resp providers.Response) float64 {
+	if resp.Elapsed <= 0 {
+		return 0
+	}
+	return float64(resp.Usage.OutputTokens) / resp.Elapsed.Seconds()
+}
+
+// printLastTurn shows where a resumed session left off
+func printLastTurn(entry history.Entry, renderer *glamour.TermRenderer) {
+	color.New(color.FgHiGreen).Printf("\n%s You: ", consts.PersonEmoji)
+	fmt.Println(entry.Prompt)
+	if renderer == nil {
+		color.New(color.FgMagenta).Printf("%s Assistant: ", consts.RobotEmoji)
+		fmt.Println(entry.Response)
+		return
+	}
+	printer := newReplyPrinter(renderer, fmt.Sprintf("%s Assistant: ", consts.RobotEmoji))
+	printer.sink()(providers.Event{Type: providers.EventDelta, Delta: entry.Response})
+	printer.finish()
+}
+
+// readInput prompts for the next input. A trailing backslash continues it on
+// the next line.
+func (s *chatState) readInput() (string, error) {
+	fmt.Println()
+	text, err := s.input.readLine(color.HiGreenString("%s You: ", consts.PersonEmoji))
+	for err == nil && strings.HasSuffix(text, `\`) {
+		var next string
+		next, err = s.input.readLine(color.HiGreenString("... "))
+		text = strings.TrimSuffix(text, `\`) + "\n" + next
+	}
+	return text, err
+}
+
+// readBlock reads lines until one containing only "done"
+func (s *chatState) readBlock(format string, a ...interface{}) string {
+	color.New(color.FgHiGreen).Fprintf(s.out, format, a...)
+	var builder strings.Builder
+	for {
+		line, err := s.input.readLine("")
+		if err != nil || line == "done" {
+			break
 		}
-		return strings.TrimSpace(builder.String()), false
-	default:
-		return text, false
+		builder.WriteString(line + "\n")
+	}
+	return strings.TrimSpace(builder.String())
+}
+
+// handleInput runs a slash command or returns the prompt to send. It returns
+// "" when there is nothing to send.
+func (s *chatState) handleInput(text string) string {
+	c, name, arg, ok := commands.parse(text)
+	if !ok {
+		// "//" escapes a prompt that starts with a slash
+		if strings.HasPrefix(text, "//") {
+			text = text[1:]
+		}
+		return s.withAttachments(text)
+	}
+	if c == nil {
+		fmt.Fprintln(s.out, color.RedString("Unknown command /%s (type /help for the list)", name))
+		return ""
+	}
+
+	s.logger.Debug("Running command /%s", c.name)
+	prompt, err := c.run(s, arg)
+	if err != nil {
+		s.logger.Error("Command /%s failed: %v", c.name, err)
+		fmt.Fprintln(s.out, color.RedString("Error: %v", err))
+		return ""
+	}
+	return s.withAttachments(prompt)
+}
+
+// send sends one prompt and prints the streamed reply and metrics
+func (s *chatState) send(text string) {
+	s.logger.Debug("Processing user input (%d chars)", len(text))
+
+	printer := newReplyPrinter(s.renderer, fmt.Sprintf("%s Assistant: ", consts.RobotEmoji))
+	ctx, done := s.interrupts.begin()
+	resp, err := sendMessageAndLogHistory(ctx, s.client, text, s.opts, s.sess, printer.sink(), s.logger)
+	response, elapsed := resp.Content, resp.Elapsed
+	done()
+	printer.finish()
+	if errors.Is(err, context.Canceled) {
+		s.logger.Info("Response interrupted after %.2f seconds (%d chars)", elapsed.Seconds(), len(response))
+		color.Yellow("[interrupted - press Ctrl-C again to exit]")
+		return
+	}
+	if err != nil {
+		s.logger.Error("Error during message processing: %v", err)
+		color.Red("Error: %v", err)
+		return
+	}
+
+	s.logger.Info("Response received in %.2f seconds (%d chars)", elapsed.Seconds(), len(response))
+
+	fmt.Println()
+
+	if s.opts.Verbose {
+		s.logger.Debug("Displaying metrics (verbose mode enabled)")
+		printMetrics(text, resp, s.opts.Assess)
+	} else if s.opts.Assess {
+		s.logger.Debug("Running prompt assessment")
+		assessment.AssessPrompt(text)
 	}
 }
 
 func ShellMode(opts *ChatOptions, logger *logging.Logger) {
 	logger.Debug("Initializing shell mode with options: %+v", opts)
 
-	client, err := CreateChatClient(opts.Provider, logger)
+	client, err := CreateChatClient(opts.Provider, opts.clientConfig(), logger)
 	if err != nil {
 		logger.Error("Failed to create chat client: %v", err)
 		color.Red("Error: %v", err)
@@ -352,7 +573,19 @@ func ShellMode(opts *ChatOptions, logger *logging.Logger) {
 
 	// Use the prompt from the ShellPrompt field
 	var prompt string
-	if opts.ShellPrompt != "" {
+	if opts.Template != "" {
+		rendered, usedInput, err := renderTemplate(opts.Template, opts.TemplateVars, opts.ShellPrompt, stdinContent)
+		if err != nil {
+			logger.Error("Template error: %v", err)
+			color.Red("Error: %v", err)
+			return
+		}
+		prompt = rendered
+		if usedInput {
+			stdinContent = ""
+		}
+		logger.Debug("Using prompt from template %s (%d chars)", opts.Template, len(prompt))
+	} else if opts.ShellPrompt != "" {
 		prompt = opts.ShellPrompt
 		logger.Debug("Using prompt from -s flag: %s", prompt)
 	} else {
@@ -376,24 +609,68 @@ func ShellMode(opts *ChatOptions, logger *logging.Logger) {
 		logger.Debug("Using prompt as input (%d chars)", len(input))
 	}
 
-	// Print a message indicating that the model is working
+	// Attached files follow, within what the context window leaves
+	if len(opts.Files) > 0 {
+		files, err := collectFiles(os.Stderr, opts.Files)
+		if err != nil {
+			logger.Error("Failed to read files: %v", err)
+			color.Red("Error: %v", err)
+			return
+		}
+		input = withFiles(os.Stderr, input, files, attachmentBudget(opts, nil, input))
+		logger.Debug("Attached %d files (%d total chars)", len(files), len(input))
+	}
+
+	// Only plain text output is streamed; other formats and extracted code are
+	// printed once complete so that stdout contains nothing but the result
 	modelName := client.GetModelName()
-	fmt.Printf("Using model: %s (temp: %.1f, max tokens: %d)\n",
-		modelName, opts.Temperature, opts.MaxTokens)
+	streamed := opts.OutputFormat == "text" && opts.ExtractCode == ""
+	var printer replyPrinter
+	if streamed {
+		renderer, err := newMarkdownRenderer(opts.Render)
+		if err != nil {
+			logger.Error("Failed to set up rendering: %v", err)
+			color.Red("Error: %v", err)
+			return
+		}
+		if opts.Quiet {
+			printer = newReplyPrinter(renderer, "")
+		} else {
+			// Print a message indicating that the model is working
+			fmt.Printf("Using model: %s (temp: %.1f, max tokens: %d)\n",
+				modelName, opts.Temperature, opts.MaxTokens)
+			printer = newReplyPrinter(renderer, fmt.Sprintf("%s Response: ", consts.RobotEmoji))
+		}
+	}
 	logger.Info("Using model: %s (temp: %.1f, max tokens: %d)",
 		modelName, opts.Temperature, opts.MaxTokens)
 
-	// Send the message and get the response
-	assistantColor := color.New(color.FgHiMagenta)
-	assistantPrompt := assistantColor.PrintfFunc()
-
-	// If output format is plain text, show the streaming response
-	if opts.OutputFormat == "text" {
-		assistantPrompt("%s Response: ", consts.RobotEmoji)
+	var sink providers.Sink
+	if printer != nil {
+		sink = printer.sink()
 	}
 
+	// Ctrl-C cancels the request; the partial response is still printed and logged
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	// Send the message and get the response
 	logger.Debug("Sending message to %s provider", opts.Provider)
-	response, elapsed, err := sendMessageAndLogHistory(client, input, opts, logger)
+	resp, err := sendMessageAndLogHistory(ctx, client, input, opts, newSession(), sink, logger)
+	response, elapsed := resp.Content, resp.Elapsed
+	if printer != nil {
+		printer.finish()
+	}
+	if errors.Is(err, context.Canceled) {
+		logger.Info("Request interrupted after %.2f seconds (%d chars)", elapsed.Seconds(), len(response))
+		if !streamed {
+			if err := printShellReply(response, opts); err != nil {
+				color.Red("Error: %v", err)
+			}
+		}
+		color.Yellow("Interrupted")
+		return
+	}
 	if err != nil {
 		logger.Error("Error during message processing: %v", err)
 		color.Red("\nError: %v", err)
@@ -401,21 +678,20 @@ func ShellMode(opts *ChatOptions, logger *logging.Logger) {
 	}
 	logger.Info("Response received in %.2f seconds (%d chars)", elapsed.Seconds(), len(response))
 
-	// Format the output according to the requested format
-	formattedResponse := formatOutput(response, opts.OutputFormat)
-	logger.Debug("Formatted response using %s format", opts.OutputFormat)
-
-	// For non-text formats or if the format isn't text, print the formatted output
-	if opts.OutputFormat != "text" {
-		fmt.Println(formattedResponse)
-	} else {
+	// For non-text formats, print the formatted output
+	if !streamed {
+		if err := printShellReply(response, opts); err != nil {
+			logger.Error("Failed to extract code: %v", err)
+			color.Red("Error: %v", err)
+		}
+	} else if !opts.Quiet {
 		fmt.Println() // Just add a newline for text format since response was already streamed
 	}
 
 	// Display metrics if verbose mode is enabled
 	if opts.Verbose {
 		logger.Debug("Displaying metrics (verbose mode enabled)")
-		printMetrics(input, response, elapsed, opts.Assess)
+		printMetrics(input, resp, opts.Assess)
 	} else if opts.Assess {
 		logger.Debug("Running prompt assessment")
 		assessment.AssessPrompt(input)
@@ -424,7 +700,19 @@ func ShellMode(opts *ChatOptions, logger *logging.Logger) {
 	logger.Debug("Shell mode completed successfully")
 }
 
+// Chat starts an interactive chat, or answers once in shell mode
 func Chat(opts *ChatOptions) {
+	startChat(opts, newSession(), nil)
+}
+
+// Resume continues a session recorded in history. The conversation is replayed
+// into the client so the provider sees the earlier turns.
+func Resume(opts *ChatOptions, sessionID string, entries []history.Entry) {
+	startChat(opts, resumeSession(sessionID, entries), entries)
+}
+
+// startChat runs the chat for sess, restoring the turns in previous first
+func startChat(opts *ChatOptions, sess *session, previous []history.Entry) {
 	// Initialize logging
 	logger, err := setupLogging(opts)
 	if err != nil {
@@ -443,58 +731,94 @@ func Chat(opts *ChatOptions) {
 
 	logger.Debug("Running in interactive chat mode")
 
-	client, err := CreateChatClient(opts.Provider, logger)
+	client, err := CreateChatClient(opts.Provider, opts.clientConfig(), logger)
 	if err != nil {
 		logger.Error("Failed to create chat client: %v", err)
 		color.Red("Error: %v", err)
 		return
 	}
 
-	scanner := bufio.NewScanner(os.Stdin)
-	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	if len(previous) > 0 {
+		logger.Info("Restored session %s (%d turns)", sess.id, len(previous))
+	}
 
-	userColor := color.New(color.FgHiGreen)
-	userPrompt := userColor.PrintfFunc()
+	renderer, err := newMarkdownRenderer(opts.Render)
+	if err != nil {
+		logger.Error("Failed to set up rendering: %v", err)
+		color.Red("Error: %v", err)
+		return
+	}
 
 	clearScreen()
-	fmt.Printf("Chat started using model: %s (type 'exit' to quit)\n", client.GetModelName())
-	fmt.Println("Type 'clear' to clear the screen")
-	fmt.Println("For multiline input, type 'paste' and press Enter")
+	if len(previous) > 0 {
+		fmt.Printf("Resumed session %s (%d turns) using model: %s\n", sess.id, len(previous), client.GetModelName())
+		printLastTurn(previous[len(previous)-1], renderer)
+	} else {
+		fmt.Printf("Chat started using model: %s\n", client.GetModelName())
+	}
+	fmt.Println("Type /help for commands and /exit to quit. End a line with \\ to continue it on the next one")
 	fmt.Println("Use '--verbose' or '-v' for metrics, '--assess' or '-a' for prompt assessment")
 
-	logger.Info("Interactive chat session started with model: %s", client.GetModelName())
+	logger.Info("Interactive chat session %s started with model: %s", sess.id, client.GetModelName())
 
-	for {
-		text, exit := handleUserInput(scanner, userPrompt)
-		if exit {
-			logger.Info("User requested exit")
-			break
+	// The first Ctrl-C cancels the current response, a second one exits
+	interrupts := newInterruptHandler(func() {
+		logger.Info("Chat session interrupted")
+		fmt.Println()
+		os.Exit(130)
+	})
+	defer interrupts.stop()
+
+	s := &chatState{
+		opts:       opts,
+		client:     client,
+		sess:       sess,
+		logger:     logger,
+		renderer:   renderer,
+		interrupts: interrupts,
+		out:        color.Output,
+		clear:      clearScreen,
+		keys:       "Press Tab to complete a command, Ctrl-R to search earlier prompts.",
+		models:     map[Provider][]string{},
+	}
+	s.input, err = newLineReader(opts, func(line string) []string {
+		return commands.complete(s, line)
+	})
+	if err != nil {
+		logger.Error("Failed to set up input: %v", err)
+		color.Red("Error: %v", err)
+		return
+	}
+	defer s.input.close()
+
+	if len(opts.Files) > 0 {
+		if err := s.attach(opts.Files); err != nil {
+			logger.Error("Failed to read files: %v", err)
+			color.Red("Error: %v", err)
+			return
 		}
-		if text == "" {
-			logger.Debug("Empty input, continuing")
+	}
+
+	for !s.done {
+		text, err := s.readInput()
+		if errors.Is(err, errInterrupted) && text != "" {
+			// Ctrl-C discards the line; on an empty line it exits
 			continue
 		}
-
-		logger.Debug("Processing user input (%d chars)", len(text))
-
-		response, elapsed, err := sendMessageAndLogHistory(client, text, opts, logger)
 		if err != nil {
-			logger.Error("Error during message processing: %v", err)
-			color.Red("Error: %v", err)
-			continue
+			logger.Info("Input ended: %v", err)
+			fmt.Println()
+			break
 		}
-
-		logger.Info("Response received in %.2f seconds (%d chars)", elapsed.Seconds(), len(response))
-
-		fmt.Println()
-
-		if opts.Verbose {
-			logger.Debug("Displaying metrics (verbose mode enabled)")
-			printMetrics(text, response, elapsed, opts.Assess)
-		} else if opts.Assess {
-			logger.Debug("Running prompt assessment")
-			assessment.AssessPrompt(text)
+		if strings.TrimSpace(text) != "" {
+			s.input.remember(text)
+		}
+		text = s.handleInput(text)
+		if text == "" {
+			logger.Debug("Nothing to send, continuing")
+			continue
 		}
+		s.send(text)
 	}
 
 	logger.Info("Chat session ended")
@@ -0,0 +1,419 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/fatih/color"
+	"github.com/pmezard/go-difflib/difflib"
+)
+
+// AnyLanguage selects the code blocks of every language for --extract-code
+const AnyLanguage = "*"
+
+// codeBlock is a fenced code block in a reply
+type codeBlock struct {
+	lang string // First word of the info string, e.g. "go"; may be empty
+	file string // File name given after the language, e.g. "go main.go"; may be empty
+	code string
+}
+
+// codeBlocks returns the fenced code blocks in text, in order. A block left
+// open, as in an interrupted reply, runs to the end of the text.
+func codeBlocks(text string) []codeBlock {
+	var blocks []codeBlock
+	var fence string
+	var current codeBlock
+	var lines []string
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSuffix(line, "\r")
+		if fence == "" {
+			if m := fencePattern.FindStringSubmatch(line); m != nil {
+				fence = m[1]
+				info := strings.Fields(strings.TrimSpace(line)[len(fence):])
+				current = codeBlock{}
+				if len(info) > 0 {
+					current.lang = strings.ToLower(info[0])
+					current.file = fileHint(info[1:])
+				}
+				lines = nil
+			}
+			continue
+		}
+		if closesFence(line, fence) {
+			current.code = strings.Join(lines, "\n")
+			blocks = append(blocks, current)
+			fence = ""
+			continue
+		}
+		lines = append(lines, line)
+	}
+	if fence != "" && len(lines) > 0 {
+		current.code = strings.Join(lines, "\n")
+		blocks = append(blocks, current)
+	}
+	return blocks
+}
+
+// closesFence reports whether line ends the code block opened by fence: a
+// run of the same character that is at least as long
+func closesFence(line, fence string) bool {
+	trimmed := strings.TrimSpace(line)
+	return strings.HasPrefix(trimmed, fence) && strings.Trim(trimmed, fence[:1]) == ""
+}
+
+// fileHint finds a file name in the rest of an info string, as in
+// "go main.go" or "python title=\"app.py\""
+func fileHint(words []string) string {
+	for _, word := range words {
+		if _, value, ok := strings.Cut(word, "="); ok {
+			word = value
+		}
+		word = strings.Trim(word, `"'`)
+		if strings.ContainsAny(word, "./") {
+			return word
+		}
+	}
+	return ""
+}
+
+// langAliases maps other spellings of a language to the one used below
+var langAliases = map[string]string{
+	"golang":  "go",
+	"py":      "python",
+	"python3": "python",
+	"sh":      "bash",
+	"shell":   "bash",
+	"zsh":     "bash",
+	"js":      "javascript",
+	"jsx":     "javascript",
+	"ts":      "typescript",
+	"tsx":     "typescript",
+	"yml":     "yaml",
+	"rb":      "ruby",
+	"rs":      "rust",
+	"c++":     "cpp",
+	"cs":      "csharp",
+	"kt":      "kotlin",
+	"md":      "markdown",
+}
+
+// langExtensions gives the file extension for code in a language
+var langExtensions = map[string]string{
+	"go":         ".go",
+	"python":     ".py",
+	"bash":       ".sh",
+	"javascript": ".js",
+	"typescript": ".ts",
+	"yaml":       ".yaml",
+	"json":       ".json",
+	"toml":       ".toml",
+	"ruby":       ".rb",
+	"rust":       ".rs",
+	"c":          ".c",
+	"cpp":        ".cpp",
+	"csharp":     ".cs",
+	"java":       ".java",
+	"kotlin":     ".kt",
+	"swift":      ".swift",
+	"php":        ".php",
+	"sql":        ".sql",
+	"html":       ".html",
+	"css":        ".css",
+	"markdown":   ".md",
+}
+
+// canonicalLang returns the usual name for a language, e.g. "python" for "py"
+func canonicalLang(lang string) string {
+	lang = strings.ToLower(lang)
+	if name, ok := langAliases[lang]; ok {
+		return name
+	}
+	return lang
+}
+
+// selectCodeBlocks returns the blocks in lang, or all of them for AnyLanguage
+func selectCodeBlocks(blocks []codeBlock, lang string) []codeBlock {
+	if lang == AnyLanguage {
+		return blocks
+	}
+	var selected []codeBlock
+	for _, b := range blocks {
+		if canonicalLang(b.lang) == canonicalLang(lang) {
+			selected = append(selected, b)
+		}
+	}
+	return selected
+}
+
+// fileName returns the file the block names, or code-n with an extension
+// for its language. Names that would leave the directory are not used.
+func (b codeBlock) fileName(n int) string {
+	if b.file != "" && filepath.IsLocal(b.file) {
+		return b.file
+	}
+	ext, ok := langExtensions[canonicalLang(b.lang)]
+	if !ok {
+		ext = ".txt"
+	}
+	return fmt.Sprintf("code-%d%s", n, ext)
+}
+
+// lines returns the length of the block, e.g. "12 lines"
+func (b codeBlock) lines() string {
+	if n := strings.Count(b.code, "\n") + 1; n != 1 {
+		return fmt.Sprintf("%d lines", n)
+	}
+	return "1 line"
+}
+
+// describe summarizes the block for a list, e.g. "go, 12 lines: package main"
+func (b codeBlock) describe() string {
+	lang := b.lang
+	if lang == "" {
+		lang = "no language"
+	}
+	first, _, _ := strings.Cut(strings.TrimSpace(b.code), "\n")
+	return fmt.Sprintf("%s, %s: %s", lang, b.lines(), summarize(first, 50))
+}
+
+// errNoCodeBlocks is returned when a reply has no code to extract
+var errNoCodeBlocks = errors.New("the reply has no code blocks")
+
+// extractCode writes the blocks of reply in lang to w, separated by blank
+// lines, or with dir set, each to a file of its own in dir
+func extractCode(w io.Writer, reply, lang, dir string, quiet bool) error {
+	blocks := selectCodeBlocks(codeBlocks(reply), lang)
+	if len(blocks) == 0 {
+		if lang != AnyLanguage {
+			return fmt.Errorf("the reply has no %s code blocks", lang)
+		}
+		return errNoCodeBlocks
+	}
+
+	if dir == "" {
+		for i, b := range blocks {
+			if i > 0 {
+				fmt.Fprintln(w)
+			}
+			fmt.Fprintln(w, b.code)
+		}
+		return nil
+	}
+
+	used := map[string]bool{}
+	for i, b := range blocks {
+		name := b.fileName(i + 1)
+		if used[name] {
+			// A second version of the same file keeps a name of its own
+			name = codeBlock{lang: b.lang}.fileName(i + 1)
+		}
+		used[name] = true
+		path := filepath.Join(dir, name)
+		if err := writeCodeFile(path, b.code); err != nil {
+			return err
+		}
+		if !quiet {
+			fmt.Fprintf(w, "Wrote %s (%s)\n", path, b.lines())
+		}
+	}
+	return nil
+}
+
+// writeCodeFile writes code to path, creating its directory
+func writeCodeFile(path, code string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create directory for %s: %w", path, err)
+	}
+	if err := os.WriteFile(path, []byte(code+"\n"), 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return nil
+}
+
+// lastCodeBlocks returns the code blocks of the last reply, with any masked
+// secrets restored
+func (s *chatState) lastCodeBlocks() ([]codeBlock, error) {
+	reply := s.sess.conversation.lastReply()
+	if reply == "" {
+		return nil, errors.New("there is no reply yet")
+	}
+	blocks := codeBlocks(s.sess.redactorFor(s.opts).Unmask(reply))
+	if len(blocks) == 0 {
+		return nil, errNoCodeBlocks
+	}
+	return blocks, nil
+}
+
+// listCodeBlocks prints the numbered blocks of the last reply
+func (s *chatState) listCodeBlocks(blocks []codeBlock) {
+	for i, b := range blocks {
+		fmt.Fprintf(s.out, "  %d. %s\n", i+1, b.describe())
+	}
+}
+
+// pickCodeBlock returns block n, counted from 1
+func pickCodeBlock(blocks []codeBlock, n string) (codeBlock, error) {
+	i, err := strconv.Atoi(n)
+	if err != nil || i < 1 || i > len(blocks) {
+		return codeBlock{}, fmt.Errorf("block must be a number from 1 to %d, got %q", len(blocks), n)
+	}
+	return blocks[i-1], nil
+}
+
+// saveCodeCommand handles "/save-code [n <file>]"; without arguments it
+// lists the blocks of the last reply
+func saveCodeCommand(s *chatState, arg string) (string, error) {
+	blocks, err := s.lastCodeBlocks()
+	if err != nil {
+		return "", err
+	}
+	fields := strings.Fields(arg)
+	switch len(fields) {
+	case 0:
+		fmt.Fprintln(s.out, "Code blocks in the last reply:")
+		s.listCodeBlocks(blocks)
+		return "", nil
+	case 2:
+	default:
+		return "", errors.New("usage: /save-code <n> <file>")
+	}
+
+	b, err := pickCodeBlock(blocks, fields[0])
+	if err != nil {
+		return "", err
+	}
+	path := expandHome(fields[1])
+	if err := writeCodeFile(path, b.code); err != nil {
+		return "", err
+	}
+	fmt.Fprintf(s.out, "Saved block %s (%s) to %s\n", fields[0], b.lines(), path)
+	return "", nil
+}
+
+// applyCommand handles "/apply [n] <file>": it shows how a block of the last
+// reply would change the file and writes it once confirmed. Without n, the
+// block that names the file is used, or the only block.
+func applyCommand(s *chatState, arg string) (string, error) {
+	fields := strings.Fields(arg)
+	if len(fields) == 0 || len(fields) > 2 {
+		return "", errors.New("usage: /apply [n] <file>")
+	}
+	blocks, err := s.lastCodeBlocks()
+	if err != nil {
+		return "", err
+	}
+
+	file := fields[len(fields)-1]
+	var b codeBlock
+	if len(fields) == 2 {
+		if b, err = pickCodeBlock(blocks, fields[0]); err != nil {
+			return "", err
+		}
+	} else if b, err = blockForFile(blocks, file); err != nil {
+		fmt.Fprintln(s.out, "Code blocks in the last reply:")
+		s.listCodeBlocks(blocks)
+		return "", err
+	}
+
+	path := expandHome(file)
+	current, err := os.ReadFile(path)
+	exists := err == nil
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return "", err
+	}
+	updated := b.code + "\n"
+	if exists && string(current) == updated {
+		fmt.Fprintf(s.out, "%s already matches the block\n", path)
+		return "", nil
+	}
+	if !exists {
+		fmt.Fprintf(s.out, "%s does not exist yet; it will contain %s\n", path, b.lines())
+	} else {
+		diff, err := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+			A:        diffLines(string(current)),
+			B:        diffLines(updated),
+			FromFile: path,
+			ToFile:   path + " (reply)",
+			Context:  3,
+		})
+		if err != nil {
+			return "", err
+		}
+		printDiff(s.out, diff)
+	}
+
+	answer, err := s.input.readLine(fmt.Sprintf("Write %s? [y/N] ", path))
+	if err != nil || !strings.EqualFold(strings.TrimSpace(answer), "y") {
+		fmt.Fprintln(s.out, "Not written")
+		return "", nil
+	}
+	if err := writeCodeFile(path, b.code); err != nil {
+		return "", err
+	}
+	fmt.Fprintf(s.out, "Wrote %s\n", path)
+	return "", nil
+}
+
+// completeCodePath completes the file of "/save-code n <file>" and
+// "/apply [n] <file>"
+func completeCodePath(arg string) []string {
+	n, path, ok := strings.Cut(arg, " ")
+	if !ok {
+		if _, err := strconv.Atoi(arg); err == nil {
+			return nil
+		}
+		return completePath(arg)
+	}
+	var lines []string
+	for _, p := range completePath(path) {
+		lines = append(lines, n+" "+p)
+	}
+	return lines
+}
+
+// blockForFile picks the block whose info string names file, or the only block
+func blockForFile(blocks []codeBlock, file string) (codeBlock, error) {
+	for _, b := range blocks {
+		if b.file != "" && (b.file == file || filepath.Base(b.file) == filepath.Base(file)) {
+			return b, nil
+		}
+	}
+	if len(blocks) == 1 {
+		return blocks[0], nil
+	}
+	return codeBlock{}, errors.New("the reply has several code blocks; use /apply <n> <file>")
+}
+
+// diffLines splits text into lines that keep their newlines. Unlike
+// difflib.SplitLines, it adds no empty line after a final newline.
+func diffLines(text string) []string {
+	lines := strings.SplitAfter(text, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// printDiff prints a unified diff, colored when the output allows it
+func printDiff(w io.Writer, diff string) {
+	for _, line := range strings.SplitAfter(diff, "\n") {
+		switch {
+		case strings.HasPrefix(line, "+++"), strings.HasPrefix(line, "---"):
+			color.New(color.Bold).Fprint(w, line)
+		case strings.HasPrefix(line, "@@"):
+			color.New(color.FgCyan).Fprint(w, line)
+		case strings.HasPrefix(line, "+"):
+			color.New(color.FgGreen).Fprint(w, line)
+		case strings.HasPrefix(line, "-"):
+			color.New(color.FgRed).Fprint(w, line)
+		default:
+			fmt.Fprint(w, line)
+		}
+	}
+}
@@ -0,0 +1,179 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/valdezdata/chat-cli/internal/attach"
+	"github.com/valdezdata/chat-cli/internal/logging"
+	"github.com/valdezdata/chat-cli/internal/providers"
+
+	"github.com/charmbracelet/glamour"
+)
+
+// chatState is the interactive chat that slash commands act on
+type chatState struct {
+	opts       *ChatOptions
+	client     providers.ChatInterface
+	sess       *session
+	logger     *logging.Logger
+	renderer   *glamour.TermRenderer // nil prints replies raw
+	input      lineReader
+	out        io.Writer     // Command output
+	clear      func()        // Clears the screen for /clear
+	keys       string        // Key bindings, described at the end of /help
+	attached   []attach.File // Added by /add, sent with the next prompt
+	interrupts *interruptHandler
+	models     map[Provider][]string // Listed models, cached for completion
+	done       bool                  // Set by /exit
+}
+
+// command is a slash command available in interactive mode
+type command struct {
+	name    string
+	aliases []string
+	args    string // Argument synopsis shown in help, e.g. "<file>"
+	help    string
+	// run executes the command with the rest of the line as arg. A non-empty
+	// result is sent to the model as the next prompt.
+	run func(s *chatState, arg string) (string, error)
+	// complete returns candidates for a partially typed arg; it may be nil
+	complete func(s *chatState, arg string) []string
+}
+
+// commandRegistry holds the slash commands by name and alias
+type commandRegistry struct {
+	commands []*command
+	byName   map[string]*command
+}
+
+// commands is the registry interactive mode dispatches to. Commands are
+// registered from init functions, so a new one needs no other wiring.
+var commands = &commandRegistry{byName: map[string]*command{}}
+
+// commandPattern matches input that is meant as a command rather than a
+// prompt that happens to start with a path like /etc/hosts
+var commandPattern = regexp.MustCompile(`^/[a-z][a-z-]*$`)
+
+// register adds c to the registry. Names must be unique.
+func (r *commandRegistry) register(c *command) {
+	for _, name := range append([]string{c.name}, c.aliases...) {
+		if _, ok := r.byName[name]; ok {
+			panic("duplicate slash command /" + name)
+		}
+		r.byName[name] = c
+	}
+	r.commands = append(r.commands, c)
+}
+
+// lookup finds a command by name or alias, without the leading slash
+func (r *commandRegistry) lookup(name string) (*command, bool) {
+	c, ok := r.byName[name]
+	return c, ok
+}
+
+// parse splits a line into a command and its argument. ok is false when the
+// line is a prompt: it does not start with a slash, starts with "//" (an
+// escaped slash), or looks like a path. Unknown commands are returned with a
+// nil command so the caller can report them.
+func (r *commandRegistry) parse(line string) (c *command, name, arg string, ok bool) {
+	word, arg, _ := strings.Cut(strings.TrimSpace(line), " ")
+	if !commandPattern.MatchString(word) {
+		return nil, "", "", false
+	}
+	name = strings.TrimPrefix(word, "/")
+	c, _ = r.lookup(name)
+	return c, name, strings.TrimSpace(arg), true
+}
+
+// complete returns the completed lines for a partially typed command line.
+// s supplies dynamic candidates such as model names and may be nil.
+func (r *commandRegistry) complete(s *chatState, line string) []string {
+	if !strings.HasPrefix(line, "/") {
+		return nil
+	}
+	word, arg, hasArg := strings.Cut(line, " ")
+	if !hasArg {
+		var names []string
+		for _, c := range r.commands {
+			for _, name := range append([]string{c.name}, c.aliases...) {
+				if strings.HasPrefix("/"+name, word) {
+					names = append(names, "/"+name+" ")
+					break
+				}
+			}
+		}
+		sort.Strings(names)
+		return names
+	}
+
+	c, ok := r.lookup(strings.TrimPrefix(word, "/"))
+	if !ok || c.complete == nil {
+		return nil
+	}
+	var lines []string
+	for _, candidate := range c.complete(s, strings.TrimLeft(arg, " ")) {
+		lines = append(lines, word+" "+candidate)
+	}
+	sort.Strings(lines)
+	return lines
+}
+
+// printHelp lists the commands, followed by keys, or describes the named one
+func (r *commandRegistry) printHelp(w io.Writer, name, keys string) error {
+	if name != "" {
+		c, ok := r.lookup(strings.TrimPrefix(name, "/"))
+		if !ok {
+			return fmt.Errorf("unknown command /%s", strings.TrimPrefix(name, "/"))
+		}
+		fmt.Fprintf(w, "%s\n  %s\n", c.synopsis(), c.help)
+		if len(c.aliases) > 0 {
+			fmt.Fprintf(w, "  Aliases: /%s\n", strings.Join(c.aliases, ", /"))
+		}
+		return nil
+	}
+
+	width := 0
+	for _, c := range r.commands {
+		width = max(width, len(c.synopsis()))
+	}
+	fmt.Fprintln(w, "Commands:")
+	for _, c := range r.commands {
+		summary, _, _ := strings.Cut(c.help, ". ")
+		fmt.Fprintf(w, "  %-*s  %s\n", width, c.synopsis(), strings.TrimSuffix(summary, "."))
+	}
+	fmt.Fprintln(w, "Start a prompt with // to send a literal leading slash.")
+	if keys != "" {
+		fmt.Fprintln(w, keys)
+	}
+	return nil
+}
+
+// synopsis returns the command with its arguments, e.g. "/save <file>"
+func (c *command) synopsis() string {
+	if c.args == "" {
+		return "/" + c.name
+	}
+	return "/" + c.name + " " + c.args
+}
+
+// CompleteCommand returns the completions for a partially typed slash command
+// line, as offered by Tab in interactive mode. Candidates that need a live
+// session, such as the models a server offers, are left out.
+func CompleteCommand(line string) []string {
+	return commands.complete(nil, line)
+}
+
+// completeWords returns the words that start with prefix
+func completeWords(prefix string, words ...string) []string {
+	var matches []string
+	for _, w := range words {
+		if strings.HasPrefix(w, prefix) {
+			matches = append(matches, w)
+		}
+	}
+	return matches
+}
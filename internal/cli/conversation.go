@@ -0,0 +1,63 @@
+package cli
+
+import (
+	"github.com/valdezdata/chat-cli/internal/consts"
+	"github.com/valdezdata/chat-cli/internal/history"
+	"github.com/valdezdata/chat-cli/internal/providers"
+)
+
+// conversation is the provider-neutral transcript of a chat. The CLI owns it
+// and sends it in full with every request, so the client can be replaced
+// mid-session, for example to escalate from a local model to a hosted one.
+type conversation struct {
+	messages []providers.Message
+}
+
+// conversationFrom rebuilds the conversation recorded in history entries
+func conversationFrom(entries []history.Entry) conversation {
+	var c conversation
+	for _, entry := range entries {
+		c.record(entry.Prompt, entry.Response)
+	}
+	return c
+}
+
+// with returns the messages to send for a new prompt, leaving the
+// conversation unchanged
+func (c *conversation) with(prompt string) []providers.Message {
+	messages := make([]providers.Message, 0, len(c.messages)+1)
+	messages = append(messages, c.messages...)
+	return append(messages, providers.Message{Role: consts.UserRole, Content: prompt})
+}
+
+// record appends an exchange. Replies interrupted before any text arrived
+// are left out.
+func (c *conversation) record(prompt, response string) {
+	c.messages = append(c.messages, providers.Message{Role: consts.UserRole, Content: prompt})
+	if response != "" {
+		c.messages = append(c.messages, providers.Message{Role: consts.AssistantRole, Content: response})
+	}
+}
+
+// dropLast removes the last exchange and returns its prompt. ok is false if
+// the conversation is empty.
+func (c *conversation) dropLast() (prompt string, ok bool) {
+	for i := len(c.messages) - 1; i >= 0; i-- {
+		if c.messages[i].Role == consts.UserRole {
+			prompt = c.messages[i].Content
+			c.messages = c.messages[:i]
+			return prompt, true
+		}
+	}
+	return "", false
+}
+
+// lastReply returns the most recent assistant message, or ""
+func (c *conversation) lastReply() string {
+	for i := len(c.messages) - 1; i >= 0; i-- {
+		if c.messages[i].Role == consts.AssistantRole {
+			return c.messages[i].Content
+		}
+	}
+	return ""
+}
@@ -0,0 +1,339 @@
+package cli
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/valdezdata/chat-cli/internal/config"
+	"github.com/valdezdata/chat-cli/internal/utils"
+
+	"github.com/chzyer/readline"
+	"github.com/fatih/color"
+	"github.com/mattn/go-isatty"
+)
+
+// errInterrupted reports Ctrl-C at the prompt. The line typed so far is
+// returned with it.
+var errInterrupted = errors.New("interrupted")
+
+// Markers that stand for a newline or tab inside a single edited line, so
+// pasted text and Shift-Enter don't submit the prompt early
+const (
+	newlineMarker = '↵'
+	tabMarker     = '⇥'
+)
+
+// Bracketed paste mode makes the terminal wrap pasted text in pasteStart and
+// pasteEnd
+const (
+	bracketedPasteOn  = "\x1b[?2004h"
+	bracketedPasteOff = "\x1b[?2004l"
+)
+
+var (
+	pasteStart = []byte("\x1b[200~")
+	pasteEnd   = []byte("\x1b[201~")
+	// Shift-Enter as sent by terminals with the CSI u or modifyOtherKeys
+	// encodings
+	newlineKeys = [][]byte{[]byte("\x1b[13;2u"), []byte("\x1b[27;2;13~")}
+	// Alt-Enter, which other terminals can be set to send instead. In vi mode
+	// the same bytes are Esc then Enter, so there it is not a newline key.
+	altEnter = []byte("\x1b\r")
+)
+
+// escapeTimeout is how long input that may start an escape sequence, such as
+// a lone Esc, waits for the rest before it is passed on as typed
+const escapeTimeout = 50 * time.Millisecond
+
+// lineReader reads input lines in interactive mode
+type lineReader interface {
+	// readLine shows prompt and returns the next line. It returns io.EOF at
+	// the end of the input and errInterrupted on Ctrl-C.
+	readLine(prompt string) (string, error)
+	// remember adds a submitted prompt to the input history
+	remember(text string)
+	close() error
+}
+
+// newLineReader returns the line editor when stdin and stdout are a terminal,
+// and a plain line scanner otherwise
+func newLineReader(opts *ChatOptions, complete func(line string) []string) (lineReader, error) {
+	if !isatty.IsTerminal(os.Stdin.Fd()) || !isatty.IsTerminal(os.Stdout.Fd()) {
+		scanner := bufio.NewScanner(os.Stdin)
+		scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+		return &scannerReader{scanner: scanner}, nil
+	}
+	return newLineEditor(opts, complete)
+}
+
+// scannerReader reads piped input line by line
+type scannerReader struct {
+	scanner *bufio.Scanner
+}
+
+func (r *scannerReader) readLine(prompt string) (string, error) {
+	fmt.Fprint(color.Output, prompt)
+	if !r.scanner.Scan() {
+		if err := r.scanner.Err(); err != nil {
+			return "", err
+		}
+		return "", io.EOF
+	}
+	return r.scanner.Text(), nil
+}
+
+func (r *scannerReader) remember(string) {}
+
+func (r *scannerReader) close() error { return nil }
+
+// lineEditor edits input with Emacs or vi keybindings, completion, reverse
+// search and a history kept in ~/.chat-cli/input_history
+type lineEditor struct {
+	rl       *readline.Instance
+	redactor *utils.Redactor // Prompts with secrets are kept out of the history
+}
+
+func newLineEditor(opts *ChatOptions, complete func(line string) []string) (*lineEditor, error) {
+	cfg := &readline.Config{
+		Stdin:                  readline.NewCancelableStdin(&multilineReader{r: os.Stdin, altEnter: opts.Input.Keymap != config.KeymapVi}),
+		AutoComplete:           completer(complete),
+		VimMode:                opts.Input.Keymap == config.KeymapVi,
+		HistorySearchFold:      true,
+		DisableAutoSaveHistory: true,
+		InterruptPrompt:        "^C",
+		EOFPrompt:              "\n",
+	}
+	if limit := opts.Input.HistoryLimit(); limit > 0 && !opts.SkipHistory {
+		path, err := inputHistoryPath()
+		if err != nil {
+			return nil, err
+		}
+		cfg.HistoryFile = path
+		cfg.HistoryLimit = limit
+	}
+
+	rl, err := readline.NewEx(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start the line editor: %w", err)
+	}
+	if cfg.HistoryFile != "" {
+		// readline rewrites the file with default permissions when compacting
+		os.Chmod(cfg.HistoryFile, 0600)
+	}
+
+	detectors := opts.Redaction
+	if detectors == nil {
+		detectors = utils.DefaultDetectors()
+	}
+	return &lineEditor{rl: rl, redactor: utils.NewRedactor(detectors)}, nil
+}
+
+// inputHistoryPath returns the input history file, created private to its
+// owner
+func inputHistoryPath() (string, error) {
+	chatDir, err := utils.ChatDir()
+	if err != nil {
+		return "", err
+	}
+	path := filepath.Join(chatDir, "input_history")
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return "", fmt.Errorf("failed to open input history: %w", err)
+	}
+	return path, f.Close()
+}
+
+func (e *lineEditor) readLine(prompt string) (string, error) {
+	e.rl.SetPrompt(prompt)
+	fmt.Fprint(os.Stdout, bracketedPasteOn)
+	line, err := e.rl.Readline()
+	fmt.Fprint(os.Stdout, bracketedPasteOff)
+
+	line = expandMarkers(line)
+	if errors.Is(err, readline.ErrInterrupt) {
+		return line, errInterrupted
+	}
+	return line, err
+}
+
+func (e *lineEditor) remember(text string) {
+	// Anything redaction would touch stays out of the plain-text history
+	if masked, _, err := e.redactor.Redact(text); err != nil || masked != text {
+		return
+	}
+	e.rl.SaveHistory(collapseMarkers(text))
+}
+
+func (e *lineEditor) close() error {
+	return e.rl.Close()
+}
+
+// expandMarkers turns the markers in an edited line back into newlines and tabs
+func expandMarkers(line string) string {
+	return strings.NewReplacer(string(newlineMarker), "\n", string(tabMarker), "\t").Replace(line)
+}
+
+// collapseMarkers puts text on one line for the history, so recalling it
+// edits the whole prompt
+func collapseMarkers(text string) string {
+	return strings.NewReplacer("\n", string(newlineMarker), "\t", string(tabMarker)).Replace(text)
+}
+
+// completer adapts a slash command completion function to readline
+type completer func(line string) []string
+
+func (c completer) Do(line []rune, pos int) ([][]rune, int) {
+	prefix := string(line[:pos])
+	word := prefix[strings.LastIndex(prefix, " ")+1:]
+
+	var suffixes [][]rune
+	for _, candidate := range c(prefix) {
+		if rest, ok := strings.CutPrefix(candidate, prefix); ok {
+			suffixes = append(suffixes, []rune(rest))
+		}
+	}
+	return suffixes, len([]rune(word))
+}
+
+// multilineReader rewrites terminal input for the line editor: newlines and
+// tabs inside a bracketed paste, and Shift-Enter, become markers, so they
+// are edited as part of the line instead of submitting it.
+type multilineReader struct {
+	r        io.Reader
+	altEnter bool // Alt-Enter is a newline key too
+	pasting  bool
+	pending  []byte // Read but not yet rewritten, such as a partial escape sequence
+	out      []byte // Rewritten and not yet returned
+	chunks   chan readChunk
+	err      error // The error that ended the input
+}
+
+// readChunk is the result of one read of the underlying input
+type readChunk struct {
+	data []byte
+	err  error
+}
+
+func (m *multilineReader) Read(p []byte) (int, error) {
+	if m.chunks == nil {
+		// Reads happen in the background so held back input can time out
+		m.chunks = make(chan readChunk)
+		go m.readAll()
+	}
+	for len(m.out) == 0 {
+		if m.err != nil {
+			return 0, m.err
+		}
+		var timeout <-chan time.Time
+		if len(m.pending) > 0 {
+			timeout = time.After(escapeTimeout)
+		}
+		select {
+		case chunk := <-m.chunks:
+			m.pending = append(m.pending, chunk.data...)
+			m.rewrite(chunk.err != nil)
+			m.err = chunk.err
+		case <-timeout:
+			// Nothing completed the sequence, so it was typed as is
+			m.rewrite(true)
+		}
+	}
+	n := copy(p, m.out)
+	m.out = m.out[n:]
+	return n, nil
+}
+
+// readAll sends the underlying input to m.chunks until it fails
+func (m *multilineReader) readAll() {
+	for {
+		buf := make([]byte, 4096)
+		n, err := m.r.Read(buf)
+		m.chunks <- readChunk{data: buf[:n], err: err}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// keys returns the sequences that stand for a newline
+func (m *multilineReader) keys() [][]byte {
+	if m.altEnter {
+		return append(newlineKeys[:len(newlineKeys):len(newlineKeys)], altEnter)
+	}
+	return newlineKeys
+}
+
+// rewrite moves pending input to out. Unless final, input that may be the
+// start of an escape sequence or of a \r\n pair waits for the next read.
+func (m *multilineReader) rewrite(final bool) {
+	newline := []byte(string(newlineMarker))
+	for len(m.pending) > 0 {
+		switch b := m.pending[0]; {
+		case b == 0x1b:
+			if n := m.escape(); n > 0 {
+				m.pending = m.pending[n:]
+				continue
+			}
+			if !final && m.partialEscape() {
+				return
+			}
+		case m.pasting && b == '\r':
+			if len(m.pending) == 1 && !final {
+				return
+			}
+			m.out = append(m.out, newline...)
+			m.pending = m.pending[1:]
+			if len(m.pending) > 0 && m.pending[0] == '\n' {
+				m.pending = m.pending[1:]
+			}
+			continue
+		case m.pasting && b == '\n':
+			m.out = append(m.out, newline...)
+			m.pending = m.pending[1:]
+			continue
+		case m.pasting && b == '\t':
+			m.out = append(m.out, string(tabMarker)...)
+			m.pending = m.pending[1:]
+			continue
+		}
+		m.out = append(m.out, m.pending[0])
+		m.pending = m.pending[1:]
+	}
+}
+
+// escape handles a known sequence at the start of pending and returns its
+// length, or 0
+func (m *multilineReader) escape() int {
+	switch {
+	case bytes.HasPrefix(m.pending, pasteStart):
+		m.pasting = true
+		return len(pasteStart)
+	case bytes.HasPrefix(m.pending, pasteEnd):
+		m.pasting = false
+		return len(pasteEnd)
+	}
+	for _, key := range m.keys() {
+		if bytes.HasPrefix(m.pending, key) {
+			m.out = append(m.out, string(newlineMarker)...)
+			return len(key)
+		}
+	}
+	return 0
+}
+
+// partialEscape reports whether pending could still become a known sequence
+func (m *multilineReader) partialEscape() bool {
+	for _, seq := range append([][]byte{pasteStart, pasteEnd}, m.keys()...) {
+		if len(m.pending) < len(seq) && bytes.HasPrefix(seq, m.pending) {
+			return true
+		}
+	}
+	return false
+}
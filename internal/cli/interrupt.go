@@ -0,0 +1,66 @@
+package cli
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"sync"
+)
+
+// interruptHandler turns Ctrl-C into cancellation of the in-flight request.
+// A Ctrl-C while no request is running, or a second one before a canceled
+// request returns, calls exit instead.
+type interruptHandler struct {
+	mu      sync.Mutex
+	cancel  context.CancelFunc
+	signals chan os.Signal
+	exit    func()
+}
+
+// newInterruptHandler installs the SIGINT handler. Call stop to uninstall it.
+func newInterruptHandler(exit func()) *interruptHandler {
+	h := &interruptHandler{
+		signals: make(chan os.Signal, 1),
+		exit:    exit,
+	}
+	signal.Notify(h.signals, os.Interrupt)
+	go h.loop()
+	return h
+}
+
+func (h *interruptHandler) loop() {
+	for range h.signals {
+		h.mu.Lock()
+		cancel := h.cancel
+		h.cancel = nil
+		h.mu.Unlock()
+
+		if cancel == nil {
+			h.exit()
+			return
+		}
+		cancel()
+	}
+}
+
+// begin returns a context for one request that the next Ctrl-C cancels.
+// The returned function must be called once the request has finished.
+func (h *interruptHandler) begin() (context.Context, func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	h.mu.Lock()
+	h.cancel = cancel
+	h.mu.Unlock()
+
+	return ctx, func() {
+		h.mu.Lock()
+		h.cancel = nil
+		h.mu.Unlock()
+		cancel()
+	}
+}
+
+// stop uninstalls the handler, restoring the default Ctrl-C behavior
+func (h *interruptHandler) stop() {
+	signal.Stop(h.signals)
+	close(h.signals)
+}
@@ -0,0 +1,254 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/valdezdata/chat-cli/internal/providers"
+
+	"github.com/charmbracelet/glamour"
+	"github.com/charmbracelet/glamour/styles"
+	"github.com/charmbracelet/x/ansi"
+	"github.com/fatih/color"
+	"github.com/mattn/go-isatty"
+	"github.com/muesli/termenv"
+	"golang.org/x/term"
+)
+
+// RenderMode selects how replies are printed
+type RenderMode string
+
+const (
+	RenderAuto     RenderMode = ""         // Markdown when stdout is a terminal
+	RenderNone     RenderMode = "none"     // Raw text as the model sent it
+	RenderMarkdown RenderMode = "markdown" // Formatted Markdown with highlighted code
+)
+
+type RenderFlag RenderMode
+
+func (r *RenderFlag) String() string {
+	return string(*r)
+}
+
+func (r *RenderFlag) Set(value string) error {
+	switch RenderMode(value) {
+	case RenderNone, RenderMarkdown:
+		*r = RenderFlag(value)
+		return nil
+	default:
+		return fmt.Errorf("must be one of: none, markdown")
+	}
+}
+
+func (r *RenderFlag) Type() string {
+	return "mode"
+}
+
+// defaultWrapWidth is used when the terminal width is unknown
+const defaultWrapWidth = 80
+
+// newMarkdownRenderer returns the renderer for replies, or nil when they are
+// printed raw
+func newMarkdownRenderer(mode RenderMode) (*glamour.TermRenderer, error) {
+	if mode == RenderNone || (mode == RenderAuto && !isatty.IsTerminal(os.Stdout.Fd())) {
+		return nil, nil
+	}
+	width, _, err := term.GetSize(int(os.Stdout.Fd()))
+	if err != nil || width <= 0 {
+		width = defaultWrapWidth
+	}
+	return markdownRenderer(width)
+}
+
+// markdownRenderer returns a renderer that wraps text at width
+func markdownRenderer(width int) (*glamour.TermRenderer, error) {
+	r, err := glamour.NewTermRenderer(
+		glamour.WithStylePath(markdownStyle()),
+		glamour.WithColorProfile(termenv.EnvColorProfile()),
+		glamour.WithWordWrap(width),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to set up Markdown rendering: %w", err)
+	}
+	return r, nil
+}
+
+// markdownStyle picks a glamour style: GLAMOUR_STYLE if set, otherwise one
+// that suits the background COLORFGBG reports. Glamour's own auto style asks
+// the terminal, which would race the line editor for stdin.
+func markdownStyle() string {
+	if style := os.Getenv("GLAMOUR_STYLE"); style != "" {
+		return style
+	}
+	if color.NoColor {
+		return styles.NoTTYStyle
+	}
+	// COLORFGBG is "foreground;background"; backgrounds 7 and 9-15 are light
+	colors := strings.Split(os.Getenv("COLORFGBG"), ";")
+	if bg, err := strconv.Atoi(colors[len(colors)-1]); err == nil && (bg == 7 || bg >= 9) {
+		return styles.LightStyle
+	}
+	return styles.DarkStyle
+}
+
+// replyPrinter prints a streamed reply
+type replyPrinter interface {
+	// sink returns the providers.Sink that feeds the printer
+	sink() providers.Sink
+	// finish prints whatever is left of the reply
+	finish()
+}
+
+// newReplyPrinter returns a markdownPrinter when renderer is set and a
+// streamPrinter otherwise
+func newReplyPrinter(renderer *glamour.TermRenderer, prefix string) replyPrinter {
+	if renderer != nil {
+		return &markdownPrinter{out: color.Output, prefix: prefix, renderer: renderer}
+	}
+	if prefix == "" {
+		return newPlainPrinter()
+	}
+	return newStreamPrinter(prefix)
+}
+
+var (
+	fencePattern    = regexp.MustCompile("^ {0,3}(`{3,}|~{3,})")
+	headingPattern  = regexp.MustCompile(`^ {0,3}#{1,6}(\s|$)`)
+	listItemPattern = regexp.MustCompile(`^\s*([-*+]|\d{1,9}[.)])\s`)
+)
+
+// markdownPrinter renders a streamed reply one Markdown block at a time. A
+// block is printed once the line after it shows it is complete, so wrapping,
+// tables and highlighting see the whole block while the rest still streams.
+type markdownPrinter struct {
+	out      io.Writer
+	prefix   string // Written on a line of its own, before the first block
+	renderer *glamour.TermRenderer
+	started  bool
+	partial  string   // Streamed text after the last newline
+	block    []string // Lines of the block being streamed
+	fence    string   // Opening fence of the code block being streamed
+	blank    bool     // The block ended in a blank line, which may end it
+}
+
+func (p *markdownPrinter) sink() providers.Sink {
+	return func(e providers.Event) {
+		if e.Type != providers.EventDelta {
+			return
+		}
+		p.partial += e.Delta
+		for {
+			i := strings.IndexByte(p.partial, '\n')
+			if i < 0 {
+				return
+			}
+			line := p.partial[:i]
+			p.partial = p.partial[i+1:]
+			p.addLine(strings.TrimSuffix(line, "\r"))
+		}
+	}
+}
+
+// addLine adds a complete line, printing the blocks it completes
+func (p *markdownPrinter) addLine(line string) {
+	if p.fence != "" {
+		p.block = append(p.block, line)
+		if closesFence(line, p.fence) {
+			p.fence = ""
+			p.flush()
+		}
+		return
+	}
+	if strings.TrimSpace(line) == "" {
+		if len(p.block) > 0 {
+			p.blank = true
+			p.block = append(p.block, line)
+		}
+		return
+	}
+
+	// After a blank line, only indented text and further list items continue
+	// the block
+	if p.blank && !continuesBlock(p.block, line) {
+		p.flush()
+	}
+	p.blank = false
+
+	switch {
+	case fencePattern.MatchString(line):
+		p.flush()
+		p.fence = strings.TrimSpace(fencePattern.FindStringSubmatch(line)[1])
+		p.block = append(p.block, line)
+	case headingPattern.MatchString(line):
+		p.flush()
+		p.block = append(p.block, line)
+		p.flush()
+	default:
+		p.block = append(p.block, line)
+	}
+}
+
+// continuesBlock reports whether line, following a blank line, belongs to
+// block: an indented continuation, or the next item of a list
+func continuesBlock(block []string, line string) bool {
+	if strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t") {
+		return true
+	}
+	return listItemPattern.MatchString(block[0]) && listItemPattern.MatchString(line)
+}
+
+// flush renders and prints the current block
+func (p *markdownPrinter) flush() {
+	p.blank = false
+	text := strings.TrimRight(strings.Join(p.block, "\n"), "\n ")
+	p.block = nil
+	if strings.TrimSpace(text) == "" {
+		return
+	}
+
+	rendered, err := p.renderer.Render(text)
+	if err != nil {
+		rendered = text
+	}
+	if !p.started {
+		p.started = true
+		if p.prefix != "" {
+			color.New(color.FgHiMagenta).Fprintln(p.out, p.prefix)
+		}
+	} else {
+		fmt.Fprint(p.out, "\n\n")
+	}
+	fmt.Fprint(p.out, trimBlankLines(rendered))
+}
+
+// trimBlankLines drops the blank, possibly styled, lines glamour puts around
+// a document, so blocks are spaced evenly
+func trimBlankLines(s string) string {
+	lines := strings.Split(s, "\n")
+	blank := func(line string) bool { return strings.TrimSpace(ansi.Strip(line)) == "" }
+	for len(lines) > 0 && blank(lines[0]) {
+		lines = lines[1:]
+	}
+	for len(lines) > 0 && blank(lines[len(lines)-1]) {
+		lines = lines[:len(lines)-1]
+	}
+	return strings.Join(lines, "\n")
+}
+
+// finish renders the rest of the reply, including an unterminated line or
+// code block from an interrupted stream
+func (p *markdownPrinter) finish() {
+	if p.partial != "" {
+		line := p.partial
+		p.partial = ""
+		p.addLine(line)
+	}
+	p.flush()
+	if p.started {
+		fmt.Fprintln(p.out)
+	}
+}
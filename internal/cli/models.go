@@ -0,0 +1,57 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/valdezdata/chat-cli/internal/providers"
+
+	"github.com/fatih/color"
+)
+
+// listModelsTimeout bounds the live model listing
+const listModelsTimeout = 30 * time.Second
+
+// ListModels prints the models the selected provider offers, marking the one
+// chat-cli would use with the current settings
+func ListModels(opts *ChatOptions) {
+	logger, err := setupLogging(opts)
+	if err != nil {
+		color.Red("Error setting up logging: %v", err)
+		return
+	}
+
+	client, err := CreateChatClient(opts.Provider, opts.clientConfig(), logger)
+	if err != nil {
+		color.Red("Error: %v", err)
+		return
+	}
+	lister, ok := client.(providers.ModelLister)
+	if !ok {
+		color.Red("Provider %s does not support listing models", opts.Provider)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), listModelsTimeout)
+	defer cancel()
+	models, err := lister.ListModels(ctx)
+	if err != nil {
+		logger.Error("Failed to list models: %v", err)
+		color.Red("Error listing models: %v", err)
+		return
+	}
+	if len(models) == 0 {
+		fmt.Printf("No models available from %s\n", opts.Provider)
+		return
+	}
+
+	fmt.Printf("Models available from %s:\n", opts.Provider)
+	for _, id := range models {
+		if id == client.GetModelName() {
+			color.Green("* %s", id)
+		} else {
+			fmt.Printf("  %s\n", id)
+		}
+	}
+}
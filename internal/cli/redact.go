@@ -0,0 +1,65 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/valdezdata/chat-cli/internal/logging"
+	"github.com/valdezdata/chat-cli/internal/providers"
+	"github.com/valdezdata/chat-cli/internal/utils"
+
+	"github.com/fatih/color"
+)
+
+// unmaskSink restores masked values in streamed text before it reaches sink.
+// Text that may start a placeholder is held back until more arrives; flush
+// passes it on when the stream ends without a Done event, as on Ctrl-C or
+// an error.
+func unmaskSink(redactor *utils.Redactor, sink providers.Sink) (wrapped providers.Sink, flush func()) {
+	if sink == nil {
+		return nil, func() {}
+	}
+	unmasker := redactor.Unmasker()
+	flush = func() {
+		if text := unmasker.Flush(); text != "" {
+			sink(providers.Event{Type: providers.EventDelta, Delta: text})
+		}
+	}
+	wrapped = func(e providers.Event) {
+		switch e.Type {
+		case providers.EventDelta:
+			if text := unmasker.Write(e.Delta); text != "" {
+				sink(providers.Event{Type: providers.EventDelta, Delta: text})
+			}
+		case providers.EventDone:
+			flush()
+			sink(e)
+		default:
+			sink(e)
+		}
+	}
+	return wrapped, flush
+}
+
+// reportFindings tells the user what redaction found. It writes to stderr so
+// shell mode output stays clean.
+func reportFindings(findings []utils.RedactFinding, logger *logging.Logger) {
+	var masked, warned []string
+	for _, f := range findings {
+		label := fmt.Sprintf("%s (%d)", f.Detector, f.Count)
+		switch f.Action {
+		case utils.RedactMask:
+			masked = append(masked, label)
+		case utils.RedactWarn:
+			warned = append(warned, label)
+		}
+		logger.Info("Redaction: %s matched %d times, action %s", f.Detector, f.Count, f.Action)
+	}
+	if len(masked) > 0 {
+		fmt.Fprintln(os.Stderr, color.YellowString("Masked before sending: %s", strings.Join(masked, ", ")))
+	}
+	if len(warned) > 0 {
+		fmt.Fprintln(os.Stderr, color.YellowString("Warning: input contains %s", strings.Join(warned, ", ")))
+	}
+}
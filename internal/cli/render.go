@@ -0,0 +1,61 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/valdezdata/chat-cli/internal/providers"
+
+	"github.com/fatih/color"
+)
+
+// streamPrinter renders streamed provider events to a writer
+type streamPrinter struct {
+	out     io.Writer
+	prefix  string       // Written once, before the first chunk
+	color   *color.Color // nil prints plain text
+	started bool
+}
+
+// newStreamPrinter creates a printer that writes colored chunks to stdout
+func newStreamPrinter(prefix string) *streamPrinter {
+	return &streamPrinter{
+		out:    color.Output,
+		prefix: prefix,
+		color:  color.New(color.FgHiMagenta),
+	}
+}
+
+// newPlainPrinter creates a printer that writes raw chunks to stdout
+func newPlainPrinter() *streamPrinter {
+	return &streamPrinter{out: color.Output}
+}
+
+// sink returns the providers.Sink that feeds this printer
+func (p *streamPrinter) sink() providers.Sink {
+	return func(e providers.Event) {
+		if e.Type != providers.EventDelta {
+			return
+		}
+		if !p.started {
+			p.started = true
+			p.write(p.prefix)
+		}
+		p.write(e.Delta)
+	}
+}
+
+// finish ends the streamed line, if anything was printed
+func (p *streamPrinter) finish() {
+	if p.started {
+		fmt.Fprintln(p.out)
+	}
+}
+
+func (p *streamPrinter) write(s string) {
+	if p.color != nil {
+		p.color.Fprint(p.out, s)
+	} else {
+		fmt.Fprint(p.out, s)
+	}
+}
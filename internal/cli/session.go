@@ -0,0 +1,53 @@
+package cli
+
+import (
+	"github.com/valdezdata/chat-cli/internal/history"
+	"github.com/valdezdata/chat-cli/internal/utils"
+)
+
+// session tracks the history session a chat appends to
+type session struct {
+	id           string
+	turn         int             // Last recorded turn
+	redactor     *utils.Redactor // Masks secrets consistently across turns
+	conversation conversation    // What the model sees, with secrets masked
+}
+
+// newSession starts a new history session
+func newSession() *session {
+	return &session{id: history.NewSessionID()}
+}
+
+// resumeSession continues a session recorded in history
+func resumeSession(id string, entries []history.Entry) *session {
+	s := &session{id: id, conversation: conversationFrom(entries)}
+	for _, entry := range entries {
+		if entry.Turn > s.turn {
+			s.turn = entry.Turn
+		}
+	}
+	return s
+}
+
+// nextTurn returns the index for the next recorded turn
+func (s *session) nextTurn() int {
+	s.turn++
+	return s.turn
+}
+
+// redactorFor returns the session's redactor, creating it from opts. The
+// placeholders in a restored conversation are reserved, though their
+// originals are gone.
+func (s *session) redactorFor(opts *ChatOptions) *utils.Redactor {
+	if s.redactor == nil {
+		detectors := opts.Redaction
+		if detectors == nil {
+			detectors = utils.DefaultDetectors()
+		}
+		s.redactor = utils.NewRedactor(detectors)
+		for _, m := range s.conversation.messages {
+			s.redactor.Reserve(m.Content)
+		}
+	}
+	return s.redactor
+}
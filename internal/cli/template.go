@@ -0,0 +1,60 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"strings"
+
+	"github.com/valdezdata/chat-cli/internal/templates"
+)
+
+// renderTemplate renders the named template with vars plus the -s prompt and
+// piped input. It reports whether the template used the input, so callers
+// know not to append it again.
+func renderTemplate(name string, vars map[string]string, prompt, input string) (string, bool, error) {
+	tmpl, err := templates.Load(name)
+	if err != nil {
+		return "", false, err
+	}
+	all := maps.Clone(vars)
+	if all == nil {
+		all = map[string]string{}
+	}
+	all[templates.PromptVar] = prompt
+	all[templates.InputVar] = input
+
+	rendered, err := tmpl.Render(all)
+	if err != nil {
+		return "", false, err
+	}
+	return rendered, tmpl.Uses(templates.InputVar), nil
+}
+
+// templateCommand handles "/template <name> [key=value...]". When the
+// template uses {{.input}}, the input is read like /paste.
+func templateCommand(s *chatState, arg string) (string, error) {
+	args := strings.Fields(arg)
+	if len(args) == 0 {
+		return "", errors.New("usage: /template <name> [key=value...]")
+	}
+	vars, err := templates.ParseVars(args[1:])
+	if err != nil {
+		return "", err
+	}
+	tmpl, err := templates.Load(args[0])
+	if err != nil {
+		return "", err
+	}
+
+	if tmpl.Uses(templates.InputVar) {
+		vars[templates.InputVar] = s.readBlock("Enter the input for %s (type 'done' on a new line when finished):\n", tmpl.Name)
+	}
+
+	rendered, err := tmpl.Render(vars)
+	if err != nil {
+		return "", err
+	}
+	fmt.Fprintf(s.out, "Using template %s (%d chars)\n", tmpl.Name, len(rendered))
+	return rendered, nil
+}
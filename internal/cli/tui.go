@@ -0,0 +1,812 @@
+package cli
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/valdezdata/chat-cli/internal/assessment"
+	"github.com/valdezdata/chat-cli/internal/consts"
+	"github.com/valdezdata/chat-cli/internal/history"
+	"github.com/valdezdata/chat-cli/internal/providers"
+
+	"github.com/charmbracelet/bubbles/key"
+	"github.com/charmbracelet/bubbles/list"
+	"github.com/charmbracelet/bubbles/textarea"
+	"github.com/charmbracelet/bubbles/viewport"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/glamour"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/x/ansi"
+	"github.com/fatih/color"
+)
+
+// inputHeight is the number of text lines in the TUI input box
+const inputHeight = 3
+
+const tuiHelp = "enter send · alt+enter newline · tab complete · ctrl+r retry · ctrl+e edit last · " +
+	"ctrl+y copy code · ctrl+o sessions · pgup/pgdn scroll · esc cancel · ctrl+c quit"
+
+var (
+	promptLabelStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("10")).Bold(true)
+	replyLabelStyle  = lipgloss.NewStyle().Foreground(lipgloss.Color("13")).Bold(true)
+	errorStyle       = lipgloss.NewStyle().Foreground(lipgloss.Color("9"))
+	statusStyle      = lipgloss.NewStyle().Reverse(true).Padding(0, 1)
+	helpStyle        = lipgloss.NewStyle().Faint(true)
+	inputStyle       = lipgloss.NewStyle().Border(lipgloss.RoundedBorder()).Padding(0, 1)
+)
+
+// Messages from the goroutines that run commands and requests
+type (
+	tuiDeltaMsg  string // Streamed reply text
+	tuiOutputMsg string // Command output, or a line written to stderr
+	tuiReplyMsg  struct {
+		prompt string
+		resp   providers.Response
+		err    error
+	}
+	tuiCommandMsg struct {
+		prompt string // To send next, as returned by handleInput
+	}
+	tuiReadLineMsg struct{ prompt string } // A command asks for input
+	tuiClearMsg    struct{}
+	tuiSessionsMsg struct {
+		sessions []history.Session
+		err      error
+	}
+)
+
+type tuiEntryKind int
+
+const (
+	entryPrompt tuiEntryKind = iota
+	entryReply
+	entryNotice
+	entryError
+)
+
+// tuiEntry is one item of the transcript
+type tuiEntry struct {
+	kind      tuiEntryKind
+	text      string
+	streaming bool   // A reply still arriving, shown raw until it is complete
+	rendered  string // Cached rendering at width
+	width     int
+}
+
+// tuiModel is the full-screen chat. It drives the same chatState as the
+// line-based chat: commands run through handleInput and prompts through
+// sendMessageAndLogHistory, each in a goroutine so the screen stays live.
+type tuiModel struct {
+	s        *chatState
+	in       *tuiInput
+	send     func(tea.Msg) // Delivers a message to the running program
+	renderer *glamour.TermRenderer
+
+	transcript viewport.Model
+	input      textarea.Model
+	sessions   list.Model
+	width      int
+	height     int
+
+	entries     []*tuiEntry
+	output      *tuiEntry         // Notice collecting the output of the running command
+	reply       *tuiEntry         // Reply being streamed
+	busy        bool              // A command or request is running
+	readingLine bool              // A running command waits for a line of input
+	browsing    bool              // The session list is open
+	editing     bool              // Submitting replaces the last exchange
+	before      conversationState // Before the running command
+	cancel      context.CancelFunc
+	copied      int // Code blocks of the last reply copied so far, for cycling
+
+	status       string // Transient message on the status bar
+	info         string // Provider, model and temperature, updated between commands
+	last         providers.Response
+	sessionUsage providers.Usage
+}
+
+// TUI runs interactive mode full screen, with a scrollable transcript, an
+// input box, a status bar and a list of the sessions in history. Slash
+// commands and history work as in Chat. sessionID and entries resume a
+// session as with Resume; leave them empty to start a new one.
+func TUI(opts *ChatOptions, sessionID string, entries []history.Entry) {
+	// Console logs would draw over the screen
+	opts.LogToConsole = false
+	logger, err := setupLogging(opts)
+	if err != nil {
+		color.Red("Error setting up logging: %v", err)
+		return
+	}
+
+	client, err := CreateChatClient(opts.Provider, opts.clientConfig(), logger)
+	if err != nil {
+		logger.Error("Failed to create chat client: %v", err)
+		color.Red("Error: %v", err)
+		return
+	}
+	sess := newSession()
+	if sessionID != "" {
+		sess = resumeSession(sessionID, entries)
+	}
+
+	s := &chatState{
+		opts:   opts,
+		client: client,
+		sess:   sess,
+		logger: logger,
+		keys:   "Press Tab to complete a command, Ctrl-R to retry, Ctrl-E to edit the last prompt, Ctrl-Y to copy code, Ctrl-O to list sessions.",
+		models: map[Provider][]string{},
+	}
+	// Files from --file are staged before the screen exists, so their
+	// notices are shown once it does
+	var staged strings.Builder
+	if len(opts.Files) > 0 {
+		s.out = &staged
+		if err := s.attach(opts.Files); err != nil {
+			logger.Error("Failed to read files: %v", err)
+			color.Red("Error: %v", err)
+			return
+		}
+	}
+
+	m := newTUIModel(s)
+	p := tea.NewProgram(m, tea.WithAltScreen(), tea.WithMouseCellMotion())
+	m.send = p.Send
+	m.in = &tuiInput{send: p.Send, lines: make(chan string, 1)}
+	s.input = m.in
+	s.out = tuiWriter(p.Send)
+	s.clear = func() { p.Send(tuiClearMsg{}) }
+	if staged.Len() > 0 {
+		go p.Send(tuiOutputMsg(staged.String()))
+	}
+
+	logger.Info("TUI session %s started with model: %s", sess.id, client.GetModelName())
+	restore, err := captureStderr(p.Send)
+	if err != nil {
+		logger.Error("Failed to capture stderr: %v", err)
+	} else {
+		defer restore()
+	}
+	if _, err := p.Run(); err != nil {
+		logger.Error("TUI failed: %v", err)
+		color.Red("Error: %v", err)
+	}
+	logger.Info("TUI session ended")
+}
+
+func newTUIModel(s *chatState) *tuiModel {
+	input := textarea.New()
+	input.Placeholder = "Ask anything, or type /help"
+	input.ShowLineNumbers = false
+	input.Prompt = ""
+	input.SetHeight(inputHeight)
+	input.CharLimit = 0
+	// Enter sends; alt+enter and ctrl+j start a new line
+	input.KeyMap.InsertNewline = key.NewBinding(key.WithKeys("alt+enter", "ctrl+j"))
+	input.Focus()
+
+	transcript := viewport.New(0, 0)
+	transcript.KeyMap = viewport.KeyMap{
+		PageUp:   key.NewBinding(key.WithKeys("pgup")),
+		PageDown: key.NewBinding(key.WithKeys("pgdown")),
+	}
+
+	sessions := list.New(nil, list.NewDefaultDelegate(), 0, 0)
+	sessions.Title = "Sessions (enter load · / filter · esc close)"
+	sessions.SetShowHelp(false)
+
+	m := &tuiModel{s: s, input: input, transcript: transcript, sessions: sessions}
+	for _, msg := range s.sess.conversation.messages {
+		m.entries = append(m.entries, m.entryFor(msg))
+	}
+	m.updateInfo()
+	return m
+}
+
+func (m *tuiModel) Init() tea.Cmd {
+	return textarea.Blink
+}
+
+func (m *tuiModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.resize(msg.Width, msg.Height)
+		return m, nil
+
+	case tea.KeyMsg:
+		if m.browsing {
+			return m, m.updateSessions(msg)
+		}
+		return m, m.handleKey(msg)
+
+	case tea.MouseMsg:
+		var cmd tea.Cmd
+		m.transcript, cmd = m.transcript.Update(msg)
+		return m, cmd
+
+	case tuiDeltaMsg:
+		if m.reply != nil {
+			m.reply.text += string(msg)
+			m.refresh()
+		}
+		return m, nil
+
+	case tuiOutputMsg:
+		m.addOutput(string(msg))
+		return m, nil
+
+	case tuiReplyMsg:
+		m.finishReply(msg)
+		return m, nil
+
+	case tuiCommandMsg:
+		return m, m.finishCommand(msg)
+
+	case tuiReadLineMsg:
+		m.readingLine = true
+		if msg.prompt != "" {
+			m.addOutput(msg.prompt)
+		}
+		m.status = "Waiting for input"
+		return m, nil
+
+	case tuiClearMsg:
+		m.entries = nil
+		m.refresh()
+		return m, nil
+
+	case tuiSessionsMsg:
+		if msg.err != nil {
+			m.browsing = false
+			m.addEntry(entryError, fmt.Sprintf("Error: %v", msg.err))
+			return m, nil
+		}
+		items := make([]list.Item, len(msg.sessions))
+		for i, session := range msg.sessions {
+			items[i] = sessionItem{session}
+		}
+		return m, m.sessions.SetItems(items)
+	}
+
+	var cmd tea.Cmd
+	m.input, cmd = m.input.Update(msg)
+	return m, cmd
+}
+
+// handleKey handles a key press outside the session list
+func (m *tuiModel) handleKey(msg tea.KeyMsg) tea.Cmd {
+	switch msg.String() {
+	case "ctrl+c":
+		if m.cancel != nil {
+			m.cancel()
+			return nil
+		}
+		return tea.Quit
+	case "esc":
+		switch {
+		case m.cancel != nil:
+			m.cancel()
+		case m.editing:
+			m.editing = false
+			m.input.Reset()
+			m.status = ""
+		}
+		return nil
+	case "enter":
+		return m.submit()
+	case "tab":
+		m.complete()
+		return nil
+	case "ctrl+r":
+		if m.busy {
+			return nil
+		}
+		return m.run("/retry")
+	case "ctrl+e":
+		m.editLast()
+		return nil
+	case "ctrl+y":
+		if m.busy {
+			// A running command or request may be changing the conversation
+			return nil
+		}
+		m.copyCode()
+		return nil
+	case "ctrl+o":
+		if m.busy {
+			return nil
+		}
+		m.browsing = true
+		return func() tea.Msg {
+			sessions, err := history.ListSessions()
+			return tuiSessionsMsg{sessions: sessions, err: err}
+		}
+	case "pgup", "pgdown":
+		var cmd tea.Cmd
+		m.transcript, cmd = m.transcript.Update(msg)
+		return cmd
+	}
+
+	var cmd tea.Cmd
+	m.input, cmd = m.input.Update(msg)
+	return cmd
+}
+
+// updateSessions handles a key press in the session list
+func (m *tuiModel) updateSessions(msg tea.KeyMsg) tea.Cmd {
+	if !m.sessions.SettingFilter() {
+		switch msg.String() {
+		case "esc", "ctrl+o":
+			m.browsing = false
+			return nil
+		case "ctrl+c":
+			return tea.Quit
+		case "enter":
+			m.browsing = false
+			if item, ok := m.sessions.SelectedItem().(sessionItem); ok {
+				return m.run("/load " + item.session.ID)
+			}
+			return nil
+		}
+	}
+	var cmd tea.Cmd
+	m.sessions, cmd = m.sessions.Update(msg)
+	return cmd
+}
+
+// submit handles Enter in the input box
+func (m *tuiModel) submit() tea.Cmd {
+	text := m.input.Value()
+	if m.readingLine {
+		// The line goes to the command that asked for it
+		m.readingLine = false
+		m.status = ""
+		m.input.Reset()
+		m.addOutput(text + "\n")
+		m.in.lines <- text
+		return nil
+	}
+	if m.busy || strings.TrimSpace(text) == "" {
+		return nil
+	}
+	m.input.Reset()
+	m.status = ""
+	if m.editing {
+		m.editing = false
+		m.s.sess.conversation.dropLast()
+		m.rebuild()
+	}
+	return m.run(text)
+}
+
+// run runs a slash command, or sends a prompt. Either way handleInput runs
+// outside Update, since what it writes to s.out is sent to the program and
+// would wait for Update to return.
+func (m *tuiModel) run(text string) tea.Cmd {
+	m.busy = true
+	m.output = nil
+	m.before = m.conversationState()
+	s, in := m.s, m.in
+	if _, _, _, ok := commands.parse(text); !ok {
+		// Attached files may be cut to fit, with a warning
+		return func() tea.Msg {
+			return tuiCommandMsg{prompt: s.handleInput(text)}
+		}
+	}
+
+	m.addEntry(entryNotice, helpStyle.Render("> "+text))
+	return func() tea.Msg {
+		in.queued = nil
+		return tuiCommandMsg{prompt: s.handleInput(text)}
+	}
+}
+
+// finishCommand updates the screen after a command and sends the prompt it
+// returned, if any
+func (m *tuiModel) finishCommand(msg tuiCommandMsg) tea.Cmd {
+	m.busy = false
+	m.readingLine = false
+	output := m.output
+	m.output = nil
+	if m.s.done {
+		return tea.Quit
+	}
+
+	if m.conversationState() != m.before {
+		m.rebuild()
+		if output != nil {
+			m.entries = append(m.entries, output)
+		}
+		m.refresh()
+	}
+	m.updateInfo()
+	if msg.prompt == "" {
+		return nil
+	}
+	return m.ask(msg.prompt)
+}
+
+// ask sends prompt and streams the reply into the transcript
+func (m *tuiModel) ask(prompt string) tea.Cmd {
+	if prompt == "" {
+		return nil
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	m.cancel = cancel
+	m.busy = true
+	m.output = nil
+	m.copied = 0
+	m.addEntry(entryPrompt, prompt)
+	m.reply = &tuiEntry{kind: entryReply, streaming: true}
+	m.entries = append(m.entries, m.reply)
+	m.refresh()
+
+	s, send := m.s, m.send
+	return func() tea.Msg {
+		sink := func(e providers.Event) {
+			if e.Type == providers.EventDelta {
+				send(tuiDeltaMsg(e.Delta))
+			}
+		}
+		resp, err := sendMessageAndLogHistory(ctx, s.client, prompt, s.opts, s.sess, sink, s.logger)
+		return tuiReplyMsg{prompt: prompt, resp: resp, err: err}
+	}
+}
+
+// finishReply records the outcome of a request
+func (m *tuiModel) finishReply(msg tuiReplyMsg) {
+	m.cancel()
+	m.cancel = nil
+	m.busy = false
+	reply := m.reply
+	m.reply = nil
+	reply.streaming = false
+	reply.text = msg.resp.Content
+	reply.width = 0
+
+	switch {
+	case errors.Is(msg.err, context.Canceled):
+		m.s.logger.Info("Response interrupted after %.2f seconds (%d chars)", msg.resp.Elapsed.Seconds(), len(msg.resp.Content))
+		m.addEntry(entryNotice, helpStyle.Render("[interrupted]"))
+	case msg.err != nil:
+		m.s.logger.Error("Error during message processing: %v", msg.err)
+		// A failed exchange is not kept, so neither is any partial reply
+		m.removeEntry(reply)
+		m.addEntry(entryError, fmt.Sprintf("Error: %v", msg.err))
+		return
+	default:
+		m.s.logger.Info("Response received in %.2f seconds (%d chars)", msg.resp.Elapsed.Seconds(), len(msg.resp.Content))
+	}
+	if reply.text == "" {
+		m.removeEntry(reply)
+	}
+
+	m.last = msg.resp
+	m.sessionUsage.InputTokens += msg.resp.Usage.InputTokens
+	m.sessionUsage.OutputTokens += msg.resp.Usage.OutputTokens
+	m.sessionUsage.TotalTokens += msg.resp.Usage.TotalTokens
+	if m.s.opts.Assess {
+		a := assessment.EvaluatePromptForHistory(msg.prompt)
+		m.addEntry(entryNotice, fmt.Sprintf("Prompt assessment: %d/100 (%s)", a.TotalScore, a.OverallRating))
+	}
+	m.refresh()
+}
+
+// complete applies Tab completion to a slash command
+func (m *tuiModel) complete() {
+	if m.busy {
+		return
+	}
+	candidates := commands.complete(m.s, m.input.Value())
+	switch len(candidates) {
+	case 0:
+		m.status = ""
+	case 1:
+		m.input.SetValue(candidates[0])
+		m.status = ""
+	default:
+		m.input.SetValue(commonPrefix(candidates))
+		m.status = strings.Join(candidates, "  ")
+	}
+}
+
+// editLast puts the last prompt in the input box. Sending it replaces the
+// last exchange.
+func (m *tuiModel) editLast() {
+	if m.busy {
+		return
+	}
+	messages := m.s.sess.conversation.messages
+	for i := len(messages) - 1; i >= 0; i-- {
+		if messages[i].Role == consts.UserRole {
+			m.input.SetValue(m.s.sess.redactorFor(m.s.opts).Unmask(messages[i].Content))
+			m.editing = true
+			m.status = "Editing the last prompt: enter replaces the exchange, esc cancels"
+			return
+		}
+	}
+	m.status = "There is no prompt to edit yet"
+}
+
+// copyCode copies a code block of the last reply. Pressing it again copies
+// the block before, cycling through all of them.
+func (m *tuiModel) copyCode() {
+	blocks, err := m.s.lastCodeBlocks()
+	if err != nil {
+		m.status = err.Error()
+		return
+	}
+	n := len(blocks) - 1 - m.copied%len(blocks)
+	m.copied++
+	if err := copyToClipboard(blocks[n].code); err != nil {
+		m.status = err.Error()
+		return
+	}
+	lang := blocks[n].lang
+	if lang == "" {
+		lang = "code"
+	}
+	m.status = fmt.Sprintf("Copied %s block %d of %d (%s)", lang, n+1, len(blocks), blocks[n].lines())
+}
+
+// conversationState identifies what the transcript shows, to tell when a
+// command such as /load, /undo or /reset changed the conversation
+type conversationState struct {
+	sess     *session
+	messages int
+}
+
+func (m *tuiModel) conversationState() conversationState {
+	return conversationState{sess: m.s.sess, messages: len(m.s.sess.conversation.messages)}
+}
+
+// rebuild replaces the transcript with the conversation
+func (m *tuiModel) rebuild() {
+	m.entries = nil
+	for _, msg := range m.s.sess.conversation.messages {
+		m.entries = append(m.entries, m.entryFor(msg))
+	}
+	m.refresh()
+}
+
+func (m *tuiModel) entryFor(msg providers.Message) *tuiEntry {
+	kind := entryPrompt
+	if msg.Role == consts.AssistantRole {
+		kind = entryReply
+	}
+	return &tuiEntry{kind: kind, text: m.s.sess.redactorFor(m.s.opts).Unmask(msg.Content)}
+}
+
+func (m *tuiModel) addEntry(kind tuiEntryKind, text string) {
+	m.entries = append(m.entries, &tuiEntry{kind: kind, text: text})
+	m.refresh()
+}
+
+func (m *tuiModel) removeEntry(entry *tuiEntry) {
+	for i, e := range m.entries {
+		if e == entry {
+			m.entries = append(m.entries[:i], m.entries[i+1:]...)
+			return
+		}
+	}
+}
+
+// addOutput appends command output to the current notice. Output while a
+// reply streams, such as a redaction warning, goes before the prompt.
+func (m *tuiModel) addOutput(text string) {
+	if m.output == nil {
+		m.output = &tuiEntry{kind: entryNotice}
+		at := len(m.entries)
+		if m.reply != nil && at >= 2 {
+			at -= 2
+		}
+		m.entries = append(m.entries[:at], append([]*tuiEntry{m.output}, m.entries[at:]...)...)
+	}
+	m.output.text += text
+	m.output.width = 0
+	m.refresh()
+}
+
+// updateInfo takes the status bar details from the chat between commands,
+// while nothing else uses it
+func (m *tuiModel) updateInfo() {
+	m.info = fmt.Sprintf("%s · %s · temp %.2f", m.s.opts.Provider, m.s.client.GetModelName(), m.s.opts.Temperature)
+	if m.s.opts.Render == RenderNone {
+		m.renderer = nil
+	} else if m.renderer == nil && m.width > 0 {
+		m.renderer, _ = markdownRenderer(m.width - 2)
+	}
+}
+
+func (m *tuiModel) resize(width, height int) {
+	m.width, m.height = width, height
+	m.input.SetWidth(width - inputStyle.GetHorizontalFrameSize())
+	m.transcript.Width = width
+	m.transcript.Height = max(1, height-inputHeight-inputStyle.GetVerticalFrameSize()-2)
+	m.sessions.SetSize(width, height-2)
+	m.renderer = nil
+	m.updateInfo()
+	for _, e := range m.entries {
+		e.width = 0
+	}
+	m.refresh()
+}
+
+// refresh redraws the transcript, following the end unless scrolled up
+func (m *tuiModel) refresh() {
+	if m.width == 0 {
+		return
+	}
+	follow := m.transcript.AtBottom()
+	var parts []string
+	for _, e := range m.entries {
+		parts = append(parts, m.render(e))
+	}
+	m.transcript.SetContent(strings.Join(parts, "\n\n"))
+	if follow {
+		m.transcript.GotoBottom()
+	}
+}
+
+// render returns an entry as shown at the current width
+func (m *tuiModel) render(e *tuiEntry) string {
+	if e.width == m.width && !e.streaming {
+		return e.rendered
+	}
+	wrap := lipgloss.NewStyle().Width(m.width)
+	var out string
+	switch e.kind {
+	case entryPrompt:
+		out = promptLabelStyle.Render(consts.PersonEmoji+" You") + "\n" + wrap.Render(e.text)
+	case entryReply:
+		out = replyLabelStyle.Render(consts.RobotEmoji + " Assistant")
+		switch {
+		case e.streaming:
+			out += "\n" + wrap.Render(e.text+"▍")
+		case m.renderer != nil:
+			rendered, err := m.renderer.Render(e.text)
+			if err != nil {
+				rendered = e.text
+			}
+			out += "\n" + trimBlankLines(rendered)
+		default:
+			out += "\n" + wrap.Render(e.text)
+		}
+	case entryError:
+		out = errorStyle.Width(m.width).Render(e.text)
+	default:
+		out = wrap.Render(strings.TrimRight(e.text, "\n"))
+	}
+	e.rendered, e.width = out, m.width
+	return out
+}
+
+func (m *tuiModel) View() string {
+	if m.width == 0 {
+		return ""
+	}
+	if m.browsing {
+		return m.sessions.View() + "\n" + helpStyle.Render(m.statusLine())
+	}
+	return m.transcript.View() + "\n" +
+		inputStyle.Render(m.input.View()) + "\n" +
+		statusStyle.Width(m.width).Render(ansi.Truncate(m.statusLine(), m.width-statusStyle.GetHorizontalPadding(), "…")) + "\n" +
+		helpStyle.Width(m.width).MaxHeight(1).Render(tuiHelp)
+}
+
+// statusLine shows the provider, model and temperature, then a message or
+// what is going on, or else the token counts of the last reply and the session
+func (m *tuiModel) statusLine() string {
+	parts := []string{m.info}
+	switch usage := m.last.Usage; {
+	case m.status != "":
+		parts = append(parts, m.status)
+	case m.reply != nil:
+		parts = append(parts, "streaming (esc to stop)")
+	case m.busy:
+		parts = append(parts, "working")
+	case usage.TotalTokens > 0:
+		// Estimated counts are marked with ~
+		approx := "~"
+		if usage.Source == providers.UsageSourceProvider {
+			approx = ""
+		}
+		last := fmt.Sprintf("last %s%d in / %s%d out", approx, usage.InputTokens, approx, usage.OutputTokens)
+		if speed := outputSpeed(m.last); speed > 0 {
+			last += fmt.Sprintf(", %.1f tok/s", speed)
+		}
+		parts = append(parts, last)
+		parts = append(parts, fmt.Sprintf("session %d tokens", m.sessionUsage.TotalTokens))
+	}
+	return strings.Join(parts, " · ")
+}
+
+// sessionItem shows a history session in the session list
+type sessionItem struct {
+	session history.Session
+}
+
+func (i sessionItem) Title() string { return summarize(i.session.Title, 70) }
+
+func (i sessionItem) Description() string {
+	turns := "turns"
+	if i.session.Turns == 1 {
+		turns = "turn"
+	}
+	return fmt.Sprintf("%s · %d %s · %s/%s · %s",
+		i.session.Updated.Local().Format("2006-01-02 15:04"), i.session.Turns, turns, i.session.Provider, i.session.Model, i.session.ID)
+}
+
+func (i sessionItem) FilterValue() string { return i.session.Title + " " + i.session.ID }
+
+// tuiInput is the lineReader for commands that ask for input, like /paste:
+// each line comes from the input box. A submitted block is read line by line.
+type tuiInput struct {
+	send   func(tea.Msg)
+	lines  chan string
+	queued []string
+}
+
+func (in *tuiInput) readLine(prompt string) (string, error) {
+	if len(in.queued) == 0 {
+		in.send(tuiReadLineMsg{prompt: prompt})
+		text, ok := <-in.lines
+		if !ok {
+			return "", io.EOF
+		}
+		in.queued = strings.Split(text, "\n")
+	}
+	line := in.queued[0]
+	in.queued = in.queued[1:]
+	return line, nil
+}
+
+func (in *tuiInput) remember(string) {}
+
+func (in *tuiInput) close() error { return nil }
+
+// tuiWriter shows command output in the transcript
+type tuiWriter func(tea.Msg)
+
+func (w tuiWriter) Write(p []byte) (int, error) {
+	w(tuiOutputMsg(p))
+	return len(p), nil
+}
+
+// captureStderr shows lines written to stderr, such as redaction warnings, in
+// the transcript instead of over the screen. The returned function restores
+// stderr.
+func captureStderr(send func(tea.Msg)) (func(), error) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	stderr := os.Stderr
+	os.Stderr = w
+	go func() {
+		scanner := bufio.NewScanner(r)
+		for scanner.Scan() {
+			send(tuiOutputMsg(scanner.Text() + "\n"))
+		}
+	}()
+	return func() {
+		os.Stderr = stderr
+		w.Close()
+	}, nil
+}
+
+// commonPrefix returns the longest prefix shared by all of words
+func commonPrefix(words []string) string {
+	prefix := words[0]
+	for _, w := range words[1:] {
+		for !strings.HasPrefix(w, prefix) {
+			prefix = prefix[:len(prefix)-1]
+		}
+	}
+	return prefix
+}
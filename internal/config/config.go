@@ -0,0 +1,261 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/valdezdata/chat-cli/internal/utils"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Setting keys, shared by profiles, environment variables and flags
+const (
+	KeyProvider      = "provider"
+	KeyModel         = "model"
+	KeyBaseURL       = "base_url"
+	KeyAPIKeyEnv     = "api_key_env"
+	KeyTemperature   = "temperature"
+	KeyMaxTokens     = "max_tokens"
+	KeySystemPrompt  = "system_prompt"
+	KeyFormat        = "format"
+	KeyContextTokens = "context_tokens"
+)
+
+// Keys lists the setting keys in display order
+var Keys = []string{
+	KeyProvider, KeyModel, KeyBaseURL, KeyAPIKeyEnv, KeyTemperature, KeyMaxTokens, KeySystemPrompt, KeyFormat,
+	KeyContextTokens,
+}
+
+// Sources of a resolved setting, from highest to lowest precedence
+const (
+	SourceFlag    = "flag"
+	SourceEnv     = "env"
+	SourceProfile = "profile"
+	SourceDefault = "default"
+)
+
+// defaults are used when no flag, environment variable or profile sets a key
+var defaults = map[string]string{
+	KeyProvider:    "ollama",
+	KeyTemperature: "0.7",
+	KeyMaxTokens:   "4000",
+	KeyFormat:      "text",
+}
+
+// genericEnv maps each key to a provider-independent environment variable
+var genericEnv = map[string]string{
+	KeyProvider:      "CHAT_CLI_PROVIDER",
+	KeyModel:         "CHAT_CLI_MODEL",
+	KeyBaseURL:       "CHAT_CLI_BASE_URL",
+	KeyAPIKeyEnv:     "CHAT_CLI_API_KEY_ENV",
+	KeyTemperature:   "CHAT_CLI_TEMPERATURE",
+	KeyMaxTokens:     "CHAT_CLI_MAX_TOKENS",
+	KeySystemPrompt:  "CHAT_CLI_SYSTEM_PROMPT",
+	KeyFormat:        "CHAT_CLI_FORMAT",
+	KeyContextTokens: "CHAT_CLI_CONTEXT_TOKENS",
+}
+
+// ProviderEnv names the environment variables a provider reads
+type ProviderEnv struct {
+	APIKey  string
+	Model   string
+	BaseURL string
+}
+
+// providerEnv lists the provider-specific environment variables. These take
+// precedence over the generic CHAT_CLI_* variables.
+var providerEnv = map[string]ProviderEnv{
+	"ollama":   {Model: "OLLAMA_MODEL", BaseURL: "OLLAMA_URL"},
+	"openai":   {APIKey: "OPENAI_API_KEY", Model: "OPENAI_MODEL", BaseURL: "OPENAI_BASE_URL"},
+	"together": {APIKey: "TOGETHER_API_KEY", Model: "TOGETHER_MODEL", BaseURL: "TOGETHER_BASE_URL"},
+	"groq":     {APIKey: "GROQ_API_KEY", Model: "GROQ_MODEL", BaseURL: "GROQ_BASE_URL"},
+	"samba":    {APIKey: "SAMBA_API_KEY", Model: "SAMBA_MODEL", BaseURL: "SAMBA_BASE_URL"},
+	"gemini":   {APIKey: "GEMINI_API_KEY", Model: "GEMINI_MODEL", BaseURL: "GEMINI_BASE_URL"},
+	"compat":   {APIKey: "OPENAI_COMPAT_API_KEY", Model: "OPENAI_COMPAT_MODEL", BaseURL: "OPENAI_COMPAT_BASE_URL"},
+}
+
+// EnvFor returns the environment variables used by a provider
+func EnvFor(provider string) ProviderEnv {
+	return providerEnv[provider]
+}
+
+// Profile is a named set of defaults in the config file. Unset fields are
+// left to environment variables and built-in defaults.
+type Profile struct {
+	Provider      string   `yaml:"provider,omitempty"`
+	Model         string   `yaml:"model,omitempty"`
+	BaseURL       string   `yaml:"base_url,omitempty"`
+	APIKeyEnv     string   `yaml:"api_key_env,omitempty"`
+	Temperature   *float64 `yaml:"temperature,omitempty"`
+	MaxTokens     *int     `yaml:"max_tokens,omitempty"`
+	SystemPrompt  string   `yaml:"system_prompt,omitempty"`
+	Format        string   `yaml:"format,omitempty"`
+	ContextTokens *int     `yaml:"context_tokens,omitempty"` // Context window that attached files must fit in
+}
+
+// values returns the profile's set fields keyed by setting key
+func (p Profile) values() map[string]string {
+	values := map[string]string{}
+	set := func(key, value string) {
+		if value != "" {
+			values[key] = value
+		}
+	}
+	set(KeyProvider, p.Provider)
+	set(KeyModel, p.Model)
+	set(KeyBaseURL, p.BaseURL)
+	set(KeyAPIKeyEnv, p.APIKeyEnv)
+	if p.Temperature != nil {
+		set(KeyTemperature, strconv.FormatFloat(*p.Temperature, 'f', -1, 64))
+	}
+	if p.MaxTokens != nil {
+		set(KeyMaxTokens, strconv.Itoa(*p.MaxTokens))
+	}
+	set(KeySystemPrompt, p.SystemPrompt)
+	set(KeyFormat, p.Format)
+	if p.ContextTokens != nil {
+		set(KeyContextTokens, strconv.Itoa(*p.ContextTokens))
+	}
+	return values
+}
+
+// File is the on-disk configuration
+type File struct {
+	DefaultProfile string             `yaml:"default_profile,omitempty"`
+	Profiles       map[string]Profile `yaml:"profiles,omitempty"`
+	Prices         map[string]Price   `yaml:"prices,omitempty"` // Per million tokens, see DefaultPrices
+	History        HistoryConfig      `yaml:"history,omitempty"`
+	Redaction      RedactionConfig    `yaml:"redaction,omitempty"`
+	Input          InputConfig        `yaml:"input,omitempty"`
+}
+
+// GetConfigFilePath returns the path to the config file
+func GetConfigFilePath() (string, error) {
+	chatDir, err := utils.ChatDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(chatDir, "config.yaml"), nil
+}
+
+// Load reads the config file. A missing file yields an empty configuration.
+func Load() (*File, error) {
+	filePath, err := GetConfigFilePath()
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(filePath)
+	if os.IsNotExist(err) {
+		return &File{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	var file File
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse config file %s: %w", filePath, err)
+	}
+	return &file, nil
+}
+
+// Value is a resolved setting and where it came from
+type Value struct {
+	Value  string
+	Source string // One of the Source* constants
+	Origin string // Environment variable name, for values from the environment
+}
+
+// Settings are the effective settings after merging every layer
+type Settings struct {
+	Profile string // Selected profile name, empty if none
+	Values  map[string]Value
+}
+
+// Get returns the resolved value for key
+func (s *Settings) Get(key string) string {
+	return s.Values[key].Value
+}
+
+// Float returns the resolved value for key as a float
+func (s *Settings) Float(key string) (float64, error) {
+	v, err := strconv.ParseFloat(s.Get(key), 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s %q (%s)", key, s.Get(key), s.Values[key].Source)
+	}
+	return v, nil
+}
+
+// Int returns the resolved value for key as an integer
+func (s *Settings) Int(key string) (int, error) {
+	v, err := strconv.Atoi(s.Get(key))
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s %q (%s)", key, s.Get(key), s.Values[key].Source)
+	}
+	return v, nil
+}
+
+// Resolve merges the settings with precedence flag > env > profile > default.
+// flags holds only the keys set explicitly on the command line, and profile
+// selects a profile by name (empty uses the file's default_profile, if any).
+func Resolve(file *File, profile string, flags map[string]string, getenv func(string) string) (*Settings, error) {
+	if profile == "" {
+		profile = file.DefaultProfile
+	}
+	profileValues := map[string]string{}
+	if profile != "" {
+		p, ok := file.Profiles[profile]
+		if !ok {
+			return nil, fmt.Errorf("profile %q not found in config file", profile)
+		}
+		profileValues = p.values()
+	}
+
+	settings := &Settings{Profile: profile, Values: map[string]Value{}}
+	resolve := func(key string, envNames ...string) {
+		if v, ok := flags[key]; ok {
+			settings.Values[key] = Value{Value: v, Source: SourceFlag}
+			return
+		}
+		for _, name := range envNames {
+			if name == "" {
+				continue
+			}
+			if v := getenv(name); v != "" {
+				settings.Values[key] = Value{Value: v, Source: SourceEnv, Origin: name}
+				return
+			}
+		}
+		if v, ok := profileValues[key]; ok {
+			settings.Values[key] = Value{Value: v, Source: SourceProfile}
+			return
+		}
+		settings.Values[key] = Value{Value: defaults[key], Source: SourceDefault}
+	}
+
+	// The provider decides which provider-specific variables apply to the rest
+	resolve(KeyProvider, genericEnv[KeyProvider])
+	provider := settings.Get(KeyProvider)
+	env := EnvFor(provider)
+
+	// A profile's model, base URL and key variable belong to the profile's provider
+	if p, ok := profileValues[KeyProvider]; ok && p != provider {
+		delete(profileValues, KeyModel)
+		delete(profileValues, KeyBaseURL)
+		delete(profileValues, KeyAPIKeyEnv)
+	}
+
+	resolve(KeyModel, env.Model, genericEnv[KeyModel])
+	resolve(KeyBaseURL, env.BaseURL, genericEnv[KeyBaseURL])
+	resolve(KeyAPIKeyEnv, genericEnv[KeyAPIKeyEnv])
+	for _, key := range []string{KeyTemperature, KeyMaxTokens, KeySystemPrompt, KeyFormat, KeyContextTokens} {
+		resolve(key, genericEnv[key])
+	}
+
+	return settings, nil
+}
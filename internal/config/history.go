@@ -0,0 +1,114 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/valdezdata/chat-cli/internal/history"
+)
+
+// HistoryConfig is the "history" section of the config file
+type HistoryConfig struct {
+	MaxAge     string `yaml:"max_age,omitempty"`     // Such as 90d, 12w or 720h
+	MaxEntries int    `yaml:"max_entries,omitempty"` // Most recent entries to keep
+	MaxBytes   string `yaml:"max_bytes,omitempty"`   // Such as 500KB or 10MB
+	Encrypt    bool   `yaml:"encrypt,omitempty"`     // Encrypt new entries
+	KeyFile    string `yaml:"key_file,omitempty"`    // Secret used when PassphraseEnv is unset
+}
+
+// PassphraseEnv holds the history passphrase
+const PassphraseEnv = "CHAT_CLI_HISTORY_PASSPHRASE"
+
+// Encryption reads the history secret from PassphraseEnv or the key file. The
+// secret is also used to read encrypted history when encrypt is off.
+func (h HistoryConfig) Encryption(getenv func(string) string) (history.Encryption, error) {
+	e := history.Encryption{Enabled: h.Encrypt}
+	if passphrase := getenv(PassphraseEnv); passphrase != "" {
+		e.Secret = []byte(passphrase)
+	} else if h.KeyFile != "" {
+		path := h.KeyFile
+		if rest, ok := strings.CutPrefix(path, "~/"); ok {
+			home, err := os.UserHomeDir()
+			if err != nil {
+				return e, err
+			}
+			path = filepath.Join(home, rest)
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return e, fmt.Errorf("failed to read history.key_file: %w", err)
+		}
+		e.Secret = bytes.TrimRight(data, "\r\n")
+	}
+	if e.Enabled && len(e.Secret) == 0 {
+		return e, fmt.Errorf("history.encrypt is set but neither %s nor history.key_file provides a secret", PassphraseEnv)
+	}
+	return e, nil
+}
+
+var (
+	durationPattern = regexp.MustCompile(`^(\d+)\s*([dw])$`)
+	sizePattern     = regexp.MustCompile(`^(\d+)\s*(b|k|kb|kib|m|mb|mib|g|gb|gib)?$`)
+)
+
+// Retention parses the history limits
+func (h HistoryConfig) Retention() (history.Retention, error) {
+	r := history.Retention{MaxEntries: h.MaxEntries}
+	if h.MaxEntries < 0 {
+		return r, fmt.Errorf("history.max_entries must not be negative")
+	}
+	var err error
+	if h.MaxAge != "" {
+		if r.MaxAge, err = parseAge(h.MaxAge); err != nil {
+			return r, err
+		}
+	}
+	if h.MaxBytes != "" {
+		if r.MaxBytes, err = parseSize(h.MaxBytes); err != nil {
+			return r, err
+		}
+	}
+	return r, nil
+}
+
+// parseAge parses a duration in days (90d), weeks (12w) or Go syntax (720h)
+func parseAge(value string) (time.Duration, error) {
+	value = strings.ToLower(strings.TrimSpace(value))
+	if m := durationPattern.FindStringSubmatch(value); m != nil {
+		n, _ := strconv.Atoi(m[1])
+		days := map[string]int{"d": 1, "w": 7}[m[2]]
+		return time.Duration(n*days) * 24 * time.Hour, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid history.max_age %q (use 90d, 12w or 720h)", value)
+	}
+	return d, nil
+}
+
+// parseSize parses a byte count with an optional binary unit (10MB is 10 MiB)
+func parseSize(value string) (int64, error) {
+	m := sizePattern.FindStringSubmatch(strings.ToLower(strings.TrimSpace(value)))
+	if m == nil {
+		return 0, fmt.Errorf("invalid history.max_bytes %q (use 500KB, 10MB or 1GB)", value)
+	}
+	n, err := strconv.ParseInt(m[1], 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid history.max_bytes %q: %w", value, err)
+	}
+	switch strings.TrimSuffix(strings.TrimSuffix(m[2], "b"), "i") {
+	case "k":
+		n <<= 10
+	case "m":
+		n <<= 20
+	case "g":
+		n <<= 30
+	}
+	return n, nil
+}
@@ -0,0 +1,43 @@
+package config
+
+import "fmt"
+
+// Keymaps of the interactive line editor
+const (
+	KeymapEmacs = "emacs"
+	KeymapVi    = "vi"
+)
+
+// DefaultInputHistorySize is the number of prompts the line editor remembers
+const DefaultInputHistorySize = 1000
+
+// InputConfig is the "input" section of the config file. It configures the
+// line editor of interactive mode.
+type InputConfig struct {
+	Keymap      string `yaml:"keymap,omitempty"`       // emacs (default) or vi
+	HistorySize int    `yaml:"history_size,omitempty"` // Prompts kept across sessions; -1 keeps none
+}
+
+// Validate reports an unknown keymap or history size
+func (c InputConfig) Validate() error {
+	switch c.Keymap {
+	case "", KeymapEmacs, KeymapVi:
+	default:
+		return fmt.Errorf("input.keymap: must be %s or %s, got %q", KeymapEmacs, KeymapVi, c.Keymap)
+	}
+	if c.HistorySize < -1 {
+		return fmt.Errorf("input.history_size: must be -1 or more, got %d", c.HistorySize)
+	}
+	return nil
+}
+
+// HistoryLimit returns the number of prompts to keep, 0 meaning none
+func (c InputConfig) HistoryLimit() int {
+	switch {
+	case c.HistorySize < 0:
+		return 0
+	case c.HistorySize == 0:
+		return DefaultInputHistorySize
+	}
+	return c.HistorySize
+}
@@ -0,0 +1,63 @@
+package config
+
+import "strings"
+
+// Price is the cost of a model in US dollars per million tokens
+type Price struct {
+	Input  float64 `yaml:"input"`
+	Output float64 `yaml:"output"`
+}
+
+// DefaultPrices covers the built-in models. Prices change; override or extend
+// them under "prices" in config.yaml. Keys are "provider/model", a model ID or
+// a provider name, looked up in that order.
+var DefaultPrices = map[string]Price{
+	"gpt-4.1":                        {Input: 2.00, Output: 8.00},
+	"gpt-4.1-mini":                   {Input: 0.40, Output: 1.60},
+	"gpt-4.1-nano":                   {Input: 0.10, Output: 0.40},
+	"gpt-4o":                         {Input: 2.50, Output: 10.00},
+	"gpt-4o-mini":                    {Input: 0.15, Output: 0.60},
+	"gemini-2.5-pro-exp-03-25":       {Input: 0, Output: 0},
+	"gemini-2.5-flash-preview-04-17": {Input: 0.15, Output: 0.60},
+	"gemini-2.0-flash-lite":          {Input: 0.075, Output: 0.30},
+	"gemma2-9b-it":                   {Input: 0.20, Output: 0.20},
+	"Meta-Llama-3.3-70B-Instruct":    {Input: 0.60, Output: 1.20},
+	"together/meta-llama/Llama-3.3-70B-Instruct-Turbo-Free":   {Input: 0, Output: 0},
+	"together/deepseek-ai/DeepSeek-R1-Distill-Llama-70B-free": {Input: 0, Output: 0},
+	"ollama": {Input: 0, Output: 0},
+}
+
+// PriceTable maps price keys to prices
+type PriceTable map[string]Price
+
+// PriceTable returns the default prices overlaid with the ones in the config file
+func (f *File) PriceTable() PriceTable {
+	table := make(PriceTable, len(DefaultPrices)+len(f.Prices))
+	for key, price := range DefaultPrices {
+		table[key] = price
+	}
+	for key, price := range f.Prices {
+		table[key] = price
+	}
+	return table
+}
+
+// Lookup finds the price for a provider and model
+func (t PriceTable) Lookup(provider, model string) (Price, bool) {
+	provider = strings.ToLower(provider)
+	for _, key := range []string{provider + "/" + model, model, provider} {
+		if price, ok := t[key]; ok {
+			return price, true
+		}
+	}
+	return Price{}, false
+}
+
+// Cost estimates the cost in US dollars of a request
+func (t PriceTable) Cost(provider, model string, inputTokens, outputTokens int) (float64, bool) {
+	price, ok := t.Lookup(provider, model)
+	if !ok {
+		return 0, false
+	}
+	return (float64(inputTokens)*price.Input + float64(outputTokens)*price.Output) / 1e6, true
+}
@@ -0,0 +1,68 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+
+	"github.com/valdezdata/chat-cli/internal/utils"
+)
+
+// RedactionConfig is the "redaction" section of the config file
+type RedactionConfig struct {
+	Actions map[string]string `yaml:"detectors,omitempty"` // Built-in detector name to block, mask, warn or off
+	Rules   []RedactionRule   `yaml:"rules,omitempty"`
+}
+
+// RedactionRule is a custom detector
+type RedactionRule struct {
+	Name    string `yaml:"name"`
+	Pattern string `yaml:"pattern"` // Go regexp; a (?P<secret>...) group limits what is masked
+	Action  string `yaml:"action,omitempty"`
+}
+
+// Detectors returns the built-in detectors with their configured actions,
+// followed by the custom rules
+func (c RedactionConfig) Detectors() ([]utils.Detector, error) {
+	detectors := utils.DefaultDetectors()
+	known := map[string]bool{}
+	for i := range detectors {
+		known[detectors[i].Name] = true
+		if name, ok := c.Actions[detectors[i].Name]; ok {
+			action, err := utils.ParseRedactAction(name)
+			if err != nil {
+				return nil, fmt.Errorf("redaction.detectors.%s: %w", detectors[i].Name, err)
+			}
+			detectors[i].Action = action
+		}
+	}
+
+	var unknown []string
+	for name := range c.Actions {
+		if !known[name] {
+			unknown = append(unknown, name)
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return nil, fmt.Errorf("unknown redaction detectors: %v", unknown)
+	}
+
+	for _, rule := range c.Rules {
+		if rule.Name == "" || rule.Pattern == "" {
+			return nil, fmt.Errorf("redaction rules need a name and a pattern")
+		}
+		pattern, err := regexp.Compile(rule.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("redaction rule %s: %w", rule.Name, err)
+		}
+		action := utils.RedactMask
+		if rule.Action != "" {
+			if action, err = utils.ParseRedactAction(rule.Action); err != nil {
+				return nil, fmt.Errorf("redaction rule %s: %w", rule.Name, err)
+			}
+		}
+		detectors = append(detectors, utils.Detector{Name: rule.Name, Pattern: pattern, Action: action})
+	}
+	return detectors, nil
+}
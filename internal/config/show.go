@@ -0,0 +1,61 @@
+package config
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/valdezdata/chat-cli/internal/utils"
+)
+
+// ShowSettings prints the effective settings and where each one came from.
+// API keys are read from the environment and redacted.
+func ShowSettings(w io.Writer, settings *Settings, filePath string, getenv func(string) string) {
+	fmt.Fprintf(w, "Config file: %s\n", filePath)
+	if settings.Profile != "" {
+		fmt.Fprintf(w, "Profile: %s\n", settings.Profile)
+	} else {
+		fmt.Fprintln(w, "Profile: (none)")
+	}
+	fmt.Fprintln(w)
+
+	for _, key := range Keys {
+		v := settings.Values[key]
+		value := v.Value
+		if value == "" {
+			value = "(not set)"
+		}
+		fmt.Fprintf(w, "%-14s %-40s %s\n", key, displayValue(value), describeSource(v))
+	}
+
+	env := EnvFor(settings.Get(KeyProvider))
+	if name := settings.Get(KeyAPIKeyEnv); name != "" && settings.Get(KeyProvider) == "compat" {
+		env.APIKey = name
+	}
+	if env.APIKey != "" {
+		key := getenv(env.APIKey)
+		value := "(not set)"
+		if key != "" {
+			value = utils.RedactAPIKey(key)
+		}
+		fmt.Fprintf(w, "%-14s %-40s env (%s)\n", "api_key", value, env.APIKey)
+	}
+}
+
+// describeSource formats a value's source for display
+func describeSource(v Value) string {
+	if v.Origin != "" {
+		return fmt.Sprintf("%s (%s)", v.Source, v.Origin)
+	}
+	return v.Source
+}
+
+// displayValue keeps long or multiline values on one short line, cut by
+// characters so multibyte text is not split
+func displayValue(value string) string {
+	value = strings.ReplaceAll(value, "\n", `\n`)
+	if runes := []rune(value); len(runes) > 40 {
+		return string(runes[:37]) + "..."
+	}
+	return value
+}
@@ -0,0 +1,236 @@
+package history
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+// Encrypted entries are stored one per line as encryptedPrefix followed by the
+// base64 of a random nonce and the AES-256-GCM sealed JSON. The key is derived
+// from the secret with scrypt; the salt and parameters are kept next to the
+// history in keyParamsFileName, so plaintext and encrypted lines can coexist
+// and appends stay single writes.
+const (
+	encryptedPrefix   = "enc1:"
+	keyParamsFileName = "history.crypt.json"
+	checkPlaintext    = "chat-cli history"
+)
+
+// Encryption configures encryption of history at rest
+type Encryption struct {
+	Enabled bool   // Encrypt entries when they're written
+	Secret  []byte // Passphrase or key file contents, also used to read encrypted entries
+}
+
+var (
+	encryption Encryption
+	historyKey cipher.AEAD // Derived on first use
+)
+
+// ErrNoPassphrase is returned when encrypted history is read without a secret
+var ErrNoPassphrase = errors.New("history is encrypted: set CHAT_CLI_HISTORY_PASSPHRASE or history.key_file in config.yaml")
+
+// SetEncryption sets how history is encrypted
+func SetEncryption(e Encryption) {
+	encryption = e
+	historyKey = nil
+}
+
+// keyParams holds what's needed to derive the key again
+type keyParams struct {
+	KDF   string `json:"kdf"`
+	N     int    `json:"n"`
+	R     int    `json:"r"`
+	P     int    `json:"p"`
+	Salt  []byte `json:"salt"`
+	Check []byte `json:"check"` // checkPlaintext sealed with the key, to detect a wrong secret
+}
+
+// cipherFor returns the key for the history in dir, deriving it on first use.
+// With create set, missing parameters are generated.
+func cipherFor(dir string, create bool) (cipher.AEAD, error) {
+	if historyKey != nil {
+		return historyKey, nil
+	}
+	if len(encryption.Secret) == 0 {
+		return nil, ErrNoPassphrase
+	}
+
+	paramsPath := filepath.Join(dir, keyParamsFileName)
+	data, err := os.ReadFile(paramsPath)
+	if os.IsNotExist(err) && create {
+		return createKey(paramsPath)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read history encryption parameters: %w", err)
+	}
+
+	var params keyParams
+	if err := json.Unmarshal(data, &params); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", paramsPath, err)
+	}
+	if params.KDF != "scrypt" {
+		return nil, fmt.Errorf("unsupported key derivation %q in %s", params.KDF, paramsPath)
+	}
+	aead, err := deriveKey(params)
+	if err != nil {
+		return nil, err
+	}
+	if plain, err := open(aead, params.Check); err != nil || string(plain) != checkPlaintext {
+		return nil, errors.New("wrong history passphrase or key file")
+	}
+	historyKey = aead
+	return aead, nil
+}
+
+// createKey generates a salt, derives the key and saves the parameters
+func createKey(paramsPath string) (cipher.AEAD, error) {
+	params := keyParams{KDF: "scrypt", N: 1 << 15, R: 8, P: 1, Salt: make([]byte, 16)}
+	if _, err := rand.Read(params.Salt); err != nil {
+		return nil, fmt.Errorf("failed to generate salt: %w", err)
+	}
+	aead, err := deriveKey(params)
+	if err != nil {
+		return nil, err
+	}
+	if params.Check, err = seal(aead, []byte(checkPlaintext)); err != nil {
+		return nil, err
+	}
+
+	data, err := json.MarshalIndent(params, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(paramsPath, data, fileMode); err != nil {
+		return nil, fmt.Errorf("failed to save history encryption parameters: %w", err)
+	}
+	historyKey = aead
+	return aead, nil
+}
+
+func deriveKey(params keyParams) (cipher.AEAD, error) {
+	key, err := scrypt.Key(encryption.Secret, params.Salt, params.N, params.R, params.P, 32)
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive history key: %w", err)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// seal encrypts plaintext, prefixing the random nonce
+func seal(aead cipher.AEAD, plaintext []byte) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plaintext)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	return aead.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+// open decrypts data produced by seal
+func open(aead cipher.AEAD, data []byte) ([]byte, error) {
+	if len(data) < aead.NonceSize() {
+		return nil, errors.New("ciphertext too short")
+	}
+	nonce, ciphertext := data[:aead.NonceSize()], data[aead.NonceSize():]
+	return aead.Open(nil, nonce, ciphertext, nil)
+}
+
+// writeCipher returns the key new lines are encrypted with, or nil when
+// encryption is off
+func writeCipher(filePath string) (cipher.AEAD, error) {
+	if !encryption.Enabled {
+		return nil, nil
+	}
+	return cipherFor(filepath.Dir(filePath), true)
+}
+
+// encodeLine marshals entry as one line, encrypted when aead is set
+func encodeLine(entry Entry, aead cipher.AEAD) ([]byte, error) {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal history entry: %w", err)
+	}
+	if aead != nil {
+		sealed, err := seal(aead, data)
+		if err != nil {
+			return nil, err
+		}
+		data = append([]byte(encryptedPrefix), base64.StdEncoding.EncodeToString(sealed)...)
+	}
+	return append(data, '\n'), nil
+}
+
+// decodeLine parses a line written by encodeLine. Unreadable plaintext lines
+// return errMalformed; a missing or wrong secret is reported as-is.
+func decodeLine(filePath string, line []byte) (Entry, error) {
+	var entry Entry
+	if rest, ok := bytes.CutPrefix(line, []byte(encryptedPrefix)); ok {
+		aead, err := cipherFor(filepath.Dir(filePath), false)
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				return entry, fmt.Errorf("history has encrypted entries but %s is missing", keyParamsFileName)
+			}
+			return entry, err
+		}
+		sealed, err := base64.StdEncoding.DecodeString(string(bytes.TrimSpace(rest)))
+		if err != nil {
+			return entry, errMalformed
+		}
+		if line, err = open(aead, sealed); err != nil {
+			return entry, errMalformed
+		}
+	}
+	if err := json.Unmarshal(line, &entry); err != nil {
+		return entry, errMalformed
+	}
+	return entry, nil
+}
+
+// errMalformed marks a line that can't be parsed and is skipped
+var errMalformed = errors.New("malformed history line")
+
+// Rewrite rewrites the whole history, encrypting every entry when encrypt is
+// set and decrypting every entry otherwise. Lines it can't read, such as ones
+// encrypted under another passphrase, are kept as they are. It returns the
+// number of entries rewritten and of lines kept.
+func Rewrite(encrypt bool) (rewritten, kept int, err error) {
+	err = withStore(func(path string) error {
+		lines, err := readLines(path)
+		if err != nil {
+			return err
+		}
+		var aead cipher.AEAD
+		if encrypt {
+			if aead, err = cipherFor(filepath.Dir(path), true); err != nil {
+				return err
+			}
+		}
+		for i, line := range lines {
+			if line.entry == nil {
+				kept++
+				continue
+			}
+			raw, err := encodeLine(*line.entry, aead)
+			if err != nil {
+				return err
+			}
+			lines[i].raw = raw
+			rewritten++
+		}
+		return writeLines(path, lines)
+	})
+	return rewritten, kept, err
+}
@@ -0,0 +1,185 @@
+package history
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ExportFormats lists the formats accepted by Export
+var ExportFormats = []string{"md", "html", "jsonl", "csv"}
+
+// Export writes entries to w. Markdown and HTML group entries into
+// conversation transcripts; JSONL and CSV write one record per entry.
+func Export(w io.Writer, entries []Entry, format string) error {
+	switch format {
+	case "md", "markdown":
+		return exportMarkdown(w, groupConversations(entries))
+	case "html":
+		return exportHTML(w, groupConversations(entries))
+	case "jsonl":
+		return exportJSONL(w, entries)
+	case "csv":
+		return exportCSV(w, entries)
+	default:
+		return fmt.Errorf("unsupported export format %q (use %s)", format, strings.Join(ExportFormats, ", "))
+	}
+}
+
+// conversation is a session's entries, or a single entry recorded without one
+type conversation struct {
+	SessionID string
+	Entries   []Entry
+}
+
+// Title names the conversation in transcripts
+func (c conversation) Title() string {
+	if c.SessionID != "" {
+		return "Session " + c.SessionID
+	}
+	return "Entry " + c.Entries[0].ID
+}
+
+// Started is the time of the first entry
+func (c conversation) Started() time.Time {
+	return c.Entries[0].Timestamp
+}
+
+// groupConversations groups entries by session, ordered by first appearance
+func groupConversations(entries []Entry) []conversation {
+	var conversations []conversation
+	index := map[string]int{}
+	for _, entry := range entries {
+		if entry.SessionID == "" {
+			conversations = append(conversations, conversation{Entries: []Entry{entry}})
+			continue
+		}
+		if i, ok := index[entry.SessionID]; ok {
+			conversations[i].Entries = append(conversations[i].Entries, entry)
+			continue
+		}
+		index[entry.SessionID] = len(conversations)
+		conversations = append(conversations, conversation{SessionID: entry.SessionID, Entries: []Entry{entry}})
+	}
+	return conversations
+}
+
+func exportMarkdown(w io.Writer, conversations []conversation) error {
+	var b strings.Builder
+	b.WriteString("# Chat History\n")
+	for _, c := range conversations {
+		first := c.Entries[0]
+		fmt.Fprintf(&b, "\n## %s\n\n", c.Title())
+		fmt.Fprintf(&b, "%s · %s · %s\n", c.Started().Format("2006-01-02 15:04"), first.Provider, first.ModelName)
+		if first.SystemPrompt != "" {
+			fmt.Fprintf(&b, "\n> System: %s\n", strings.ReplaceAll(first.SystemPrompt, "\n", "\n> "))
+		}
+		for _, entry := range c.Entries {
+			if entry.Turn > 0 {
+				fmt.Fprintf(&b, "\n### Turn %d · %s\n", entry.Turn, entry.Timestamp.Format("15:04:05"))
+			} else {
+				fmt.Fprintf(&b, "\n### %s\n", entry.Timestamp.Format("15:04:05"))
+			}
+			fmt.Fprintf(&b, "\n**You:**\n\n%s\n", entry.Prompt)
+			fmt.Fprintf(&b, "\n**Assistant (%s):**\n\n%s\n", entry.ModelName, entry.Response)
+			fmt.Fprintf(&b, "\n*%d input / %d output tokens · %.2fs*\n", entry.InputTokens, entry.OutputTokens, entry.TimeTaken)
+		}
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+var htmlTemplate = template.Must(template.New("history").Funcs(template.FuncMap{
+	"datetime": func(t time.Time) string { return t.Format("2006-01-02 15:04") },
+	"clock":    func(t time.Time) string { return t.Format("15:04:05") },
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Chat History</title>
+<style>
+body { font-family: sans-serif; max-width: 860px; margin: 2em auto; color: #222; }
+section { border-top: 1px solid #ccc; margin-top: 2em; }
+.meta { color: #666; font-size: 0.9em; }
+.msg { white-space: pre-wrap; padding: 0.6em 0.8em; border-radius: 6px; margin: 0.4em 0; }
+.user { background: #eef6ee; }
+.assistant { background: #f3eef8; }
+</style>
+</head>
+<body>
+<h1>Chat History</h1>
+{{range .}}{{$first := index .Entries 0}}<section>
+<h2>{{.Title}}</h2>
+<p class="meta">{{datetime .Started}} · {{$first.Provider}} · {{$first.ModelName}}</p>
+{{if $first.SystemPrompt}}<p class="meta">System: {{$first.SystemPrompt}}</p>
+{{end}}{{range .Entries}}<p class="meta">{{if .Turn}}Turn {{.Turn}} · {{end}}{{clock .Timestamp}}</p>
+<div class="msg user"><strong>You:</strong>
+{{.Prompt}}</div>
+<div class="msg assistant"><strong>Assistant ({{.ModelName}}):</strong>
+{{.Response}}</div>
+<p class="meta">{{.InputTokens}} input / {{.OutputTokens}} output tokens · {{printf "%.2f" .TimeTaken}}s</p>
+{{end}}</section>
+{{end}}</body>
+</html>
+`))
+
+func exportHTML(w io.Writer, conversations []conversation) error {
+	return htmlTemplate.Execute(w, conversations)
+}
+
+func exportJSONL(w io.Writer, entries []Entry) error {
+	encoder := json.NewEncoder(w)
+	for _, entry := range entries {
+		if err := encoder.Encode(entry); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// csvHeader lists the CSV columns, with the long text columns last
+var csvHeader = []string{
+	"id", "timestamp", "session_id", "turn", "provider", "model",
+	"input_tokens", "output_tokens", "total_tokens", "token_source", "time_taken",
+	"assessment_score", "source", "prompt", "response",
+}
+
+func exportCSV(w io.Writer, entries []Entry) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write(csvHeader); err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		score := ""
+		if entry.Assessment != nil {
+			score = strconv.Itoa(entry.Assessment.OverallScore)
+		}
+		record := []string{
+			entry.ID,
+			entry.Timestamp.Format(time.RFC3339),
+			entry.SessionID,
+			strconv.Itoa(entry.Turn),
+			entry.Provider,
+			entry.ModelName,
+			strconv.Itoa(entry.InputTokens),
+			strconv.Itoa(entry.OutputTokens),
+			strconv.Itoa(entry.TotalTokens),
+			entry.TokenSource,
+			strconv.FormatFloat(entry.TimeTaken, 'f', 3, 64),
+			score,
+			entry.Source,
+			entry.Prompt,
+			entry.Response,
+		}
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
@@ -0,0 +1,132 @@
+package history
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Filter selects history entries. Zero-valued fields match everything.
+type Filter struct {
+	Query     string    // Words that must all appear in the prompt or response (case-insensitive)
+	Provider  string    // Exact provider name
+	Model     string    // Substring of the model name (case-insensitive)
+	SessionID string    // Session ID or prefix
+	Since     time.Time // Inclusive lower bound on the timestamp
+	Until     time.Time // Exclusive upper bound on the timestamp
+	MinScore  int       // Minimum assessment score; entries without an assessment don't match
+}
+
+// Match reports whether entry passes every filter
+func (f Filter) Match(entry Entry) bool {
+	if f.Provider != "" && !strings.EqualFold(entry.Provider, f.Provider) {
+		return false
+	}
+	if f.Model != "" && !strings.Contains(strings.ToLower(entry.ModelName), strings.ToLower(f.Model)) {
+		return false
+	}
+	if f.SessionID != "" && !strings.HasPrefix(entry.SessionID, f.SessionID) {
+		return false
+	}
+	if !f.Since.IsZero() && entry.Timestamp.Before(f.Since) {
+		return false
+	}
+	if !f.Until.IsZero() && !entry.Timestamp.Before(f.Until) {
+		return false
+	}
+	if f.MinScore > 0 && (entry.Assessment == nil || entry.Assessment.OverallScore < f.MinScore) {
+		return false
+	}
+	if f.Query != "" {
+		text := strings.ToLower(entry.Prompt + "\n" + entry.Response)
+		for _, term := range strings.Fields(strings.ToLower(f.Query)) {
+			if !strings.Contains(text, term) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// Apply returns the entries that match, in their original order
+func (f Filter) Apply(entries []Entry) []Entry {
+	var matched []Entry
+	for _, entry := range entries {
+		if f.Match(entry) {
+			matched = append(matched, entry)
+		}
+	}
+	return matched
+}
+
+// Search returns the stored entries that match f
+func Search(f Filter) ([]Entry, error) {
+	history, err := LoadHistory()
+	if err != nil {
+		return nil, err
+	}
+	return f.Apply(history.Entries), nil
+}
+
+// relativeTime matches durations like 36h, 7d or 2w
+var relativeTime = regexp.MustCompile(`^(\d+)([hdw])$`)
+
+// ParseSince parses the start of a time range. It accepts dates
+// (2006-01-02), date-times (2006-01-02 15:04 or RFC 3339), durations before
+// now (36h, 7d, 2w), "today", "yesterday" and weekday names, which mean the
+// most recent such day before today.
+func ParseSince(value string, now time.Time) (time.Time, error) {
+	t, _, err := parseTime(value, now)
+	return t, err
+}
+
+// ParseUntil parses the end of a time range in the same formats as ParseSince.
+// A bare day includes the whole day.
+func ParseUntil(value string, now time.Time) (time.Time, error) {
+	t, wholeDay, err := parseTime(value, now)
+	if wholeDay {
+		t = t.AddDate(0, 0, 1)
+	}
+	return t, err
+}
+
+// parseTime parses value and reports whether it named a whole day
+func parseTime(value string, now time.Time) (time.Time, bool, error) {
+	value = strings.TrimSpace(value)
+	keyword := strings.ToLower(value)
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+
+	switch keyword {
+	case "today":
+		return today, true, nil
+	case "yesterday":
+		return today.AddDate(0, 0, -1), true, nil
+	}
+	for d := time.Sunday; d <= time.Saturday; d++ {
+		if keyword == strings.ToLower(d.String()) {
+			back := (int(today.Weekday()) - int(d) + 7) % 7
+			if back == 0 {
+				back = 7
+			}
+			return today.AddDate(0, 0, -back), true, nil
+		}
+	}
+
+	if m := relativeTime.FindStringSubmatch(keyword); m != nil {
+		n, _ := strconv.Atoi(m[1])
+		unit := map[string]time.Duration{"h": time.Hour, "d": 24 * time.Hour, "w": 7 * 24 * time.Hour}[m[2]]
+		return now.Add(-time.Duration(n) * unit), false, nil
+	}
+
+	if t, err := time.ParseInLocation("2006-01-02", value, now.Location()); err == nil {
+		return t, true, nil
+	}
+	for _, layout := range []string{"2006-01-02 15:04", "2006-01-02T15:04", time.RFC3339} {
+		if t, err := time.ParseInLocation(layout, value, now.Location()); err == nil {
+			return t, false, nil
+		}
+	}
+	return time.Time{}, false, fmt.Errorf("invalid time %q (use 2006-01-02, \"2006-01-02 15:04\", 7d, 36h, yesterday or a weekday)", value)
+}
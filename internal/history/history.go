@@ -1,25 +1,34 @@
 package history
 
 import (
-	"encoding/json"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
-	"os"
-	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 )
 
 // Entry represents a single history entry
 type Entry struct {
+	ID           string      `json:"id,omitempty"`
 	Timestamp    time.Time   `json:"timestamp"`
+	SessionID    string      `json:"session_id,omitempty"` // Empty for entries written before sessions
+	Turn         int         `json:"turn,omitempty"`       // 1-based position within the session
 	Provider     string      `json:"provider"`
 	ModelName    string      `json:"model_name"`
+	SystemPrompt string      `json:"system_prompt,omitempty"`
 	Prompt       string      `json:"prompt"`
 	Response     string      `json:"response"`
 	InputTokens  int         `json:"input_tokens"`
 	OutputTokens int         `json:"output_tokens"`
 	TotalTokens  int         `json:"total_tokens"`
+	TokenSource  string      `json:"token_source,omitempty"` // "provider" or "estimate:<estimator>"
 	TimeTaken    float64     `json:"time_taken"`
 	Assessment   *Assessment `json:"assessment,omitempty"`
+	Source       string      `json:"source,omitempty"` // "<format>:<file>" for imported entries
 }
 
 // Assessment represents the prompt assessment results
@@ -39,112 +48,323 @@ type CriteriaResult struct {
 // History holds a collection of entries
 type History struct {
 	Entries []Entry `json:"entries"`
+	Skipped int     `json:"-"` // Lines in the history file that could not be parsed
 }
 
-// GetHistoryFilePath returns the path to the history file
-func GetHistoryFilePath() (string, error) {
-	homeDir, err := os.UserHomeDir()
+// LoadHistory loads the history from the file
+func LoadHistory() (*History, error) {
+	var history History
+	err := withStore(func(path string) error {
+		var err error
+		history.Entries, history.Skipped, err = readEntries(path)
+		return err
+	})
 	if err != nil {
-		return "", fmt.Errorf("failed to get home directory: %w", err)
+		return nil, err
 	}
+	return &history, nil
+}
 
-	// Create .chat-cli directory if it doesn't exist
-	chatDir := filepath.Join(homeDir, ".chat-cli")
-	if err := os.MkdirAll(chatDir, 0755); err != nil {
-		return "", fmt.Errorf("failed to create directory: %w", err)
-	}
+// SaveHistory replaces the stored history
+func SaveHistory(history *History) error {
+	return withStore(func(path string) error {
+		return writeEntries(path, history.Entries)
+	})
+}
 
-	return filepath.Join(chatDir, "history.json"), nil
+// ImportEntries appends the entries that aren't already stored and returns
+// how many were added. Entries are compared by content, so two different
+// turns are both kept even if their IDs collide.
+func ImportEntries(entries []Entry) (int, error) {
+	added := 0
+	err := withStore(func(path string) error {
+		existing, _, err := readEntries(path)
+		if err != nil {
+			return err
+		}
+		seen := make(map[string]bool, len(existing))
+		for _, entry := range existing {
+			seen[contentKey(entry)] = true
+		}
+		var appended []Entry
+		var grown int64
+		for _, entry := range entries {
+			key := contentKey(entry)
+			if seen[key] {
+				continue
+			}
+			n, err := appendEntry(path, entry)
+			if err != nil {
+				return err
+			}
+			seen[key] = true
+			appended = append(appended, entry)
+			grown += n
+		}
+		added = len(appended)
+		return enforceRetention(path, appended, grown)
+	})
+	return added, err
 }
 
-// LoadHistory loads the history from the file
-func LoadHistory() (*History, error) {
-	filePath, err := GetHistoryFilePath()
+// AddEntry appends a new entry to the history, assigning it an ID
+func AddEntry(entry Entry) error {
+	if entry.ID == "" {
+		entry.ID = randomID(idBytes)
+	}
+	return withStore(func(path string) error {
+		n, err := appendEntry(path, entry)
+		if err != nil {
+			return err
+		}
+		return enforceRetention(path, []Entry{entry}, n)
+	})
+}
+
+// ShowHistory displays the history entries
+func ShowHistory(count int) error {
+	history, err := LoadHistory()
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	// If file doesn't exist, return an empty history
-	if _, err := os.Stat(filePath); os.IsNotExist(err) {
-		return &History{Entries: []Entry{}}, nil
+	fmt.Println("Chat History:")
+	fmt.Println("=============")
+	if history.Skipped > 0 {
+		fmt.Printf("Warning: skipped %d unreadable lines in the history file\n", history.Skipped)
 	}
+	ShowEntries(lastN(history.Entries, count), "")
+	return nil
+}
 
-	data, err := os.ReadFile(filePath)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read history file: %w", err)
+// ShowEntries prints a summary of each entry. When query is set, the first
+// match in the response is shown in context.
+func ShowEntries(entries []Entry, query string) {
+	for i, entry := range entries {
+		fmt.Printf("#%d - %s (%s) [id %s]\n", i+1, entry.Timestamp.Format("2006-01-02 15:04:05"), entry.Provider, entry.ID)
+		if entry.SessionID != "" {
+			fmt.Printf("Session: %s (turn %d)\n", entry.SessionID, entry.Turn)
+		}
+		fmt.Printf("Model: %s\n", entry.ModelName)
+		fmt.Printf("Prompt: %s\n", truncateString(entry.Prompt, 100))
+		fmt.Printf("Response: %s\n", truncateString(entry.Response, 100))
+		if snippet := matchSnippet(entry.Response, query, 50); snippet != "" {
+			fmt.Printf("Match: %s\n", snippet)
+		}
+		fmt.Printf("Tokens: %d input, %d output, %d total (%s)\n", entry.InputTokens, entry.OutputTokens, entry.TotalTokens, TokenSourceLabel(entry.TokenSource))
+		fmt.Printf("Time taken: %.2f seconds\n", entry.TimeTaken)
+		if entry.Assessment != nil {
+			fmt.Printf("Assessment Score: %d%% (%s)\n", entry.Assessment.OverallScore, entry.Assessment.OverallRating)
+		}
+		fmt.Println("-------------")
 	}
+}
 
-	var history History
-	if err := json.Unmarshal(data, &history); err != nil {
-		return nil, fmt.Errorf("failed to parse history file: %w", err)
+// ShowEntry prints a single entry in full
+func ShowEntry(entry Entry) {
+	fmt.Printf("ID: %s\n", entry.ID)
+	fmt.Printf("Time: %s\n", entry.Timestamp.Format("2006-01-02 15:04:05"))
+	if entry.SessionID != "" {
+		fmt.Printf("Session: %s (turn %d)\n", entry.SessionID, entry.Turn)
 	}
+	fmt.Printf("Provider: %s\n", entry.Provider)
+	if entry.Source != "" {
+		fmt.Printf("Imported from: %s\n", entry.Source)
+	}
+	fmt.Printf("Model: %s\n", entry.ModelName)
+	if entry.SystemPrompt != "" {
+		fmt.Printf("System prompt: %s\n", entry.SystemPrompt)
+	}
+	fmt.Printf("Tokens: %d input, %d output, %d total (%s)\n", entry.InputTokens, entry.OutputTokens, entry.TotalTokens, TokenSourceLabel(entry.TokenSource))
+	fmt.Printf("Time taken: %.2f seconds\n", entry.TimeTaken)
+	if a := entry.Assessment; a != nil {
+		fmt.Printf("Assessment Score: %d%% (%s)\n", a.OverallScore, a.OverallRating)
+		names := make([]string, 0, len(a.CriteriaScores))
+		for name := range a.CriteriaScores {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			c := a.CriteriaScores[name]
+			fmt.Printf("  %s: %d (%s) - %s\n", name, c.Score, c.Rating, c.Description)
+		}
+	}
+	fmt.Println("\nPrompt:")
+	fmt.Println(entry.Prompt)
+	fmt.Println("\nResponse:")
+	fmt.Println(entry.Response)
+}
 
-	return &history, nil
+// lastN returns the last n entries, or all of them when n <= 0
+func lastN(entries []Entry, n int) []Entry {
+	if n > 0 && n < len(entries) {
+		return entries[len(entries)-n:]
+	}
+	return entries
 }
 
-// SaveHistory saves the history to the file
-func SaveHistory(history *History) error {
-	filePath, err := GetHistoryFilePath()
-	if err != nil {
-		return err
+// NewSessionID returns a random identifier for a chat session
+func NewSessionID() string {
+	return randomID(6)
+}
+
+// idBytes is the length of entry IDs, long enough that large imports don't
+// collide
+const idBytes = 16
+
+// randomID returns n random bytes as hex
+func randomID(n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		// crypto/rand does not fail on supported platforms; fall back to the clock
+		return strconv.FormatInt(time.Now().UnixNano(), 36)
 	}
+	return hex.EncodeToString(b)
+}
 
-	data, err := json.MarshalIndent(history, "", "  ")
-	if err != nil {
-		return fmt.Errorf("failed to marshal history: %w", err)
+// derivedID gives entries written before IDs existed a stable ID
+func derivedID(entry Entry) string {
+	return shortHash(entry.Timestamp.Format(time.RFC3339Nano)+"\x00"+entry.Prompt, idBytes)
+}
+
+// contentKey identifies an entry by its session, turn and exchange. Entries
+// imported from sources without times are stamped when they are imported, so
+// the time only counts for entries outside any session.
+func contentKey(entry Entry) string {
+	var at string
+	if entry.SessionID == "" {
+		at = entry.Timestamp.UTC().Format(time.RFC3339Nano)
 	}
+	return shortHash(strings.Join([]string{
+		entry.SessionID,
+		strconv.Itoa(entry.Turn),
+		at,
+		entry.SystemPrompt,
+		entry.Prompt,
+		entry.Response,
+	}, "\x00"), sha256.Size)
+}
 
-	if err := os.WriteFile(filePath, data, 0644); err != nil {
-		return fmt.Errorf("failed to write history file: %w", err)
+// FindEntry returns the entry with the given ID or unique ID prefix
+func FindEntry(ref string) (Entry, error) {
+	history, err := LoadHistory()
+	if err != nil {
+		return Entry{}, err
 	}
 
-	return nil
+	var matches []Entry
+	for _, entry := range history.Entries {
+		if entry.ID == ref {
+			return entry, nil
+		}
+		if strings.HasPrefix(entry.ID, ref) {
+			matches = append(matches, entry)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return Entry{}, fmt.Errorf("entry %q not found", ref)
+	case 1:
+		return matches[0], nil
+	default:
+		return Entry{}, fmt.Errorf("entry %q is ambiguous (%d matches)", ref, len(matches))
+	}
 }
 
-// AddEntry adds a new entry to the history
-func AddEntry(entry Entry) error {
+// FindSession returns the entries of a session in turn order. ref is a session
+// ID, a unique prefix of one, or "last" for the most recent session.
+func FindSession(ref string) (string, []Entry, error) {
 	history, err := LoadHistory()
 	if err != nil {
-		return err
+		return "", nil, err
 	}
 
-	// Add the new entry
-	history.Entries = append(history.Entries, entry)
+	sessionID, err := matchSession(history.Entries, ref)
+	if err != nil {
+		return "", nil, err
+	}
 
-	// Save the updated history
-	return SaveHistory(history)
+	var entries []Entry
+	for _, entry := range history.Entries {
+		if entry.SessionID == sessionID {
+			entries = append(entries, entry)
+		}
+	}
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].Turn < entries[j].Turn })
+	return sessionID, entries, nil
 }
 
-// ShowHistory displays the history entries
-func ShowHistory(count int) error {
+// Session summarizes a chat session recorded in history
+type Session struct {
+	ID       string
+	Started  time.Time
+	Updated  time.Time // Time of the last turn
+	Turns    int
+	Provider string // Provider and model of the last turn
+	Model    string
+	Title    string // The first prompt
+}
+
+// ListSessions returns the sessions in history, most recently updated first.
+// Entries recorded without a session are left out.
+func ListSessions() ([]Session, error) {
 	history, err := LoadHistory()
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	// Limit the number of entries to display
-	startIdx := 0
-	if count > 0 && count < len(history.Entries) {
-		startIdx = len(history.Entries) - count
+	var sessions []Session
+	index := map[string]int{}
+	for _, entry := range history.Entries {
+		if entry.SessionID == "" {
+			continue
+		}
+		i, ok := index[entry.SessionID]
+		if !ok {
+			i = len(sessions)
+			index[entry.SessionID] = i
+			sessions = append(sessions, Session{ID: entry.SessionID, Started: entry.Timestamp, Title: entry.Prompt})
+		}
+		s := &sessions[i]
+		s.Turns++
+		if !entry.Timestamp.Before(s.Updated) {
+			s.Updated = entry.Timestamp
+			s.Provider = entry.Provider
+			s.Model = entry.ModelName
+		}
 	}
+	sort.SliceStable(sessions, func(i, j int) bool { return sessions[i].Updated.After(sessions[j].Updated) })
+	return sessions, nil
+}
 
-	fmt.Println("Chat History:")
-	fmt.Println("=============")
-
-	for i, entry := range history.Entries[startIdx:] {
-		fmt.Printf("#%d - %s (%s)\n", i+1, entry.Timestamp.Format("2006-01-02 15:04:05"), entry.Provider)
-		fmt.Printf("Model: %s\n", entry.ModelName)
-		fmt.Printf("Prompt: %s\n", truncateString(entry.Prompt, 100))
-		fmt.Printf("Response: %s\n", truncateString(entry.Response, 100))
-		fmt.Printf("Tokens: %d input, %d output, %d total\n", entry.InputTokens, entry.OutputTokens, entry.TotalTokens)
-		fmt.Printf("Time taken: %.2f seconds\n", entry.TimeTaken)
-		if entry.Assessment != nil {
-			fmt.Printf("Assessment Score: %d%% (%s)\n", entry.Assessment.OverallScore, entry.Assessment.OverallRating)
+// matchSession resolves ref to a single session ID
+func matchSession(entries []Entry, ref string) (string, error) {
+	if ref == "last" {
+		for i := len(entries) - 1; i >= 0; i-- {
+			if entries[i].SessionID != "" {
+				return entries[i].SessionID, nil
+			}
 		}
-		fmt.Println("-------------")
+		return "", fmt.Errorf("no sessions in history")
 	}
 
-	return nil
+	matches := map[string]bool{}
+	for _, entry := range entries {
+		if entry.SessionID != "" && strings.HasPrefix(entry.SessionID, ref) {
+			matches[entry.SessionID] = true
+		}
+	}
+	switch {
+	case matches[ref]:
+		return ref, nil
+	case len(matches) == 1:
+		for id := range matches {
+			return id, nil
+		}
+	case len(matches) > 1:
+		return "", fmt.Errorf("session %q is ambiguous (%d matches)", ref, len(matches))
+	}
+	return "", fmt.Errorf("session %q not found", ref)
 }
 
 // ClearHistory deletes all history entries
@@ -156,10 +376,52 @@ func ClearHistory() error {
 	return SaveHistory(history)
 }
 
-// Helper function to truncate long strings
+// TokenSourceLabel describes where an entry's token counts came from.
+// Entries written before usage reporting have no source and were approximated.
+func TokenSourceLabel(source string) string {
+	switch {
+	case source == "provider":
+		return "reported by provider"
+	case strings.HasPrefix(source, "estimate:"):
+		return "estimated, " + strings.TrimPrefix(source, "estimate:")
+	default:
+		return "approximate"
+	}
+}
+
+// Helper function to truncate long strings without splitting characters
 func truncateString(s string, maxLen int) string {
-	if len(s) <= maxLen {
+	runes := []rune(s)
+	if len(runes) <= maxLen {
 		return s
 	}
-	return s[:maxLen-3] + "..."
+	return string(runes[:maxLen-3]) + "..."
+}
+
+// matchSnippet returns the text around the first query term found in s
+func matchSnippet(s, query string, context int) string {
+	terms := strings.Fields(strings.ToLower(query))
+	if len(terms) == 0 {
+		return ""
+	}
+	runes := []rune(s)
+	lower := []rune(strings.ToLower(s))
+	if len(lower) != len(runes) {
+		// Lowercasing changed the length, so positions don't line up
+		return ""
+	}
+	at := strings.Index(string(lower), terms[0])
+	if at < 0 {
+		return ""
+	}
+	pos := len([]rune(string(lower)[:at]))
+	start, end := max(0, pos-context), min(len(runes), pos+len([]rune(terms[0]))+context)
+	snippet := strings.Join(strings.Fields(string(runes[start:end])), " ")
+	if start > 0 {
+		snippet = "..." + snippet
+	}
+	if end < len(runes) {
+		snippet += "..."
+	}
+	return snippet
 }
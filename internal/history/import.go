@@ -0,0 +1,415 @@
+package history
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/valdezdata/chat-cli/internal/utils"
+)
+
+// ImportFormats lists the formats accepted by ParseImport
+var ImportFormats = []string{"auto", "openai", "chatgpt", "jsonl"}
+
+// importMessage is a message from an imported conversation
+type importMessage struct {
+	role  string
+	text  string
+	at    time.Time // Zero when the source has no timestamps
+	model string
+}
+
+// importConversation is one conversation read from an import file
+type importConversation struct {
+	key      string // Identifies the conversation within its source, for stable IDs
+	source   string
+	provider string
+	model    string
+	started  time.Time
+	messages []importMessage
+}
+
+// ParseImport reads conversations from data and maps them onto entries.
+// format is one of ImportFormats; "auto" detects it. name is the file name,
+// recorded in each entry's Source. Entry and session IDs are derived from the
+// content, so importing the same data twice yields the same IDs.
+func ParseImport(data []byte, format, name string, now time.Time) ([]Entry, error) {
+	if format == "auto" || format == "" {
+		format = detectImportFormat(data)
+	}
+	name = filepath.Base(name)
+
+	var conversations []importConversation
+	var entries []Entry
+	var err error
+	switch format {
+	case "openai":
+		conversations, err = parseOpenAIMessages(data, name)
+	case "chatgpt":
+		conversations, err = parseChatGPT(data, name)
+	case "jsonl":
+		entries, conversations, err = parseJSONL(data, name)
+	default:
+		return nil, fmt.Errorf("unsupported import format %q (use %s)", format, strings.Join(ImportFormats, ", "))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for _, c := range conversations {
+		entries = append(entries, c.entries(now)...)
+	}
+	return entries, nil
+}
+
+// detectImportFormat guesses the format from the shape of the data
+func detectImportFormat(data []byte) string {
+	if !json.Valid(data) {
+		return "jsonl"
+	}
+	var probe interface{}
+	json.Unmarshal(data, &probe)
+	switch v := probe.(type) {
+	case []interface{}:
+		if len(v) > 0 {
+			if first, ok := v[0].(map[string]interface{}); ok {
+				if _, ok := first["mapping"]; ok {
+					return "chatgpt"
+				}
+			}
+		}
+		return "openai"
+	case map[string]interface{}:
+		if _, ok := v["mapping"]; ok {
+			return "chatgpt"
+		}
+		if _, ok := v["messages"]; ok {
+			return "openai"
+		}
+	}
+	return "jsonl"
+}
+
+// openAIMessage is a chat completions message
+type openAIMessage struct {
+	Role    string          `json:"role"`
+	Content json.RawMessage `json:"content"`
+}
+
+// openAIConversation is a chat completions request body, or one line of a
+// fine-tuning file
+type openAIConversation struct {
+	Model    string          `json:"model"`
+	Messages []openAIMessage `json:"messages"`
+}
+
+// parseOpenAIMessages reads a message array, a {"messages": [...]} object or
+// an array of such objects
+func parseOpenAIMessages(data []byte, name string) ([]importConversation, error) {
+	var messages []openAIMessage
+	if err := json.Unmarshal(data, &messages); err == nil && (len(messages) == 0 || messages[0].Role != "") {
+		return []importConversation{openAIToConversation(openAIConversation{Messages: messages}, name, 0)}, nil
+	}
+
+	var list []openAIConversation
+	if err := json.Unmarshal(data, &list); err == nil {
+		conversations := make([]importConversation, 0, len(list))
+		for i, c := range list {
+			conversations = append(conversations, openAIToConversation(c, name, i))
+		}
+		return conversations, nil
+	}
+
+	var single openAIConversation
+	if err := json.Unmarshal(data, &single); err != nil {
+		return nil, fmt.Errorf("failed to parse OpenAI messages: %w", err)
+	}
+	return []importConversation{openAIToConversation(single, name, 0)}, nil
+}
+
+func openAIToConversation(c openAIConversation, name string, index int) importConversation {
+	conversation := importConversation{
+		source:   "openai:" + name,
+		provider: "openai",
+		model:    c.Model,
+	}
+	var key strings.Builder
+	fmt.Fprintf(&key, "openai\x00%d", index)
+	for _, m := range c.Messages {
+		text := contentText(m.Content)
+		conversation.messages = append(conversation.messages, importMessage{role: m.Role, text: text, model: c.Model})
+		fmt.Fprintf(&key, "\x00%s\x00%s", m.Role, text)
+	}
+	conversation.key = key.String()
+	return conversation
+}
+
+// contentText extracts the text of a message content, which is either a string
+// or an array of parts
+func contentText(raw json.RawMessage) string {
+	var s string
+	if err := json.Unmarshal(raw, &s); err == nil {
+		return s
+	}
+	var parts []struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	}
+	if err := json.Unmarshal(raw, &parts); err != nil {
+		return ""
+	}
+	var texts []string
+	for _, p := range parts {
+		if p.Text != "" {
+			texts = append(texts, p.Text)
+		}
+	}
+	return strings.Join(texts, "\n")
+}
+
+// chatGPTConversation is one conversation in a ChatGPT conversations.json export
+type chatGPTConversation struct {
+	ID             string                 `json:"id"`
+	ConversationID string                 `json:"conversation_id"`
+	Title          string                 `json:"title"`
+	CreateTime     float64                `json:"create_time"`
+	CurrentNode    string                 `json:"current_node"`
+	Mapping        map[string]chatGPTNode `json:"mapping"`
+}
+
+type chatGPTNode struct {
+	Parent  string `json:"parent"`
+	Message *struct {
+		Author struct {
+			Role string `json:"role"`
+		} `json:"author"`
+		CreateTime float64 `json:"create_time"`
+		Content    struct {
+			ContentType string        `json:"content_type"`
+			Parts       []interface{} `json:"parts"`
+		} `json:"content"`
+		Metadata struct {
+			ModelSlug string `json:"model_slug"`
+		} `json:"metadata"`
+	} `json:"message"`
+}
+
+// parseChatGPT reads a conversations.json export, or a single conversation
+func parseChatGPT(data []byte, name string) ([]importConversation, error) {
+	var list []chatGPTConversation
+	if err := json.Unmarshal(data, &list); err != nil {
+		var single chatGPTConversation
+		if err := json.Unmarshal(data, &single); err != nil {
+			return nil, fmt.Errorf("failed to parse ChatGPT export: %w", err)
+		}
+		list = []chatGPTConversation{single}
+	}
+
+	conversations := make([]importConversation, 0, len(list))
+	for _, c := range list {
+		id := c.ConversationID
+		if id == "" {
+			id = c.ID
+		}
+		conversation := importConversation{
+			key:      "chatgpt\x00" + id + "\x00" + c.Title,
+			source:   "chatgpt:" + name,
+			provider: "chatgpt",
+			started:  unixSeconds(c.CreateTime),
+		}
+
+		// Follow the branch that ends at the current node, then reverse it
+		var branch []importMessage
+		seen := map[string]bool{}
+		for node := c.CurrentNode; node != "" && !seen[node]; node = c.Mapping[node].Parent {
+			seen[node] = true
+			m := c.Mapping[node].Message
+			if m == nil || m.Content.ContentType != "text" {
+				continue
+			}
+			var texts []string
+			for _, part := range m.Content.Parts {
+				if s, ok := part.(string); ok && s != "" {
+					texts = append(texts, s)
+				}
+			}
+			if len(texts) == 0 {
+				continue
+			}
+			branch = append(branch, importMessage{
+				role:  m.Author.Role,
+				text:  strings.Join(texts, "\n"),
+				at:    unixSeconds(m.CreateTime),
+				model: m.Metadata.ModelSlug,
+			})
+		}
+		for i := len(branch) - 1; i >= 0; i-- {
+			conversation.messages = append(conversation.messages, branch[i])
+		}
+		conversations = append(conversations, conversation)
+	}
+	return conversations, nil
+}
+
+// parseJSONL reads one JSON object per line: history entries (as written by
+// chat-cli or its JSONL export) or {"messages": [...]} conversations
+func parseJSONL(data []byte, name string) ([]Entry, []importConversation, error) {
+	var entries []Entry
+	var conversations []importConversation
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 0, 64*1024), 64*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		text := bytes.TrimSpace(scanner.Bytes())
+		if len(text) == 0 {
+			continue
+		}
+		var probe map[string]json.RawMessage
+		if err := json.Unmarshal(text, &probe); err != nil {
+			return nil, nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		if _, ok := probe["messages"]; ok {
+			var c openAIConversation
+			if err := json.Unmarshal(text, &c); err != nil {
+				return nil, nil, fmt.Errorf("line %d: %w", line, err)
+			}
+			conversations = append(conversations, openAIToConversation(c, name, line))
+			continue
+		}
+
+		var entry Entry
+		if err := json.Unmarshal(text, &entry); err != nil {
+			return nil, nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		if entry.Prompt == "" && entry.Response == "" {
+			return nil, nil, fmt.Errorf("line %d: neither a history entry nor a messages object", line)
+		}
+		if entry.ID == "" {
+			entry.ID = derivedID(entry)
+		}
+		if entry.Source == "" {
+			entry.Source = "jsonl:" + name
+		}
+		entries = append(entries, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, nil, fmt.Errorf("failed to read JSONL: %w", err)
+	}
+	return entries, conversations, nil
+}
+
+// entries pairs each user message with the assistant replies that follow it
+func (c importConversation) entries(now time.Time) []Entry {
+	sessionID := "imp" + shortHash(c.key, idBytes)
+	var systemPrompt string
+	var entries []Entry
+	for _, m := range c.messages {
+		switch m.role {
+		case "system", "developer":
+			if systemPrompt == "" {
+				systemPrompt = m.text
+			}
+		case "user":
+			at := m.at
+			if at.IsZero() {
+				at = c.started
+			}
+			if at.IsZero() {
+				at = now
+			}
+			turn := len(entries) + 1
+			entries = append(entries, Entry{
+				ID:           shortHash(fmt.Sprintf("%s\x00%d\x00%s", c.key, turn, m.text), idBytes),
+				Timestamp:    at,
+				SessionID:    sessionID,
+				Turn:         turn,
+				Provider:     c.provider,
+				ModelName:    c.model,
+				SystemPrompt: systemPrompt,
+				Prompt:       m.text,
+				Source:       c.source,
+			})
+		case "assistant":
+			if len(entries) == 0 {
+				continue
+			}
+			last := &entries[len(entries)-1]
+			if last.Response != "" {
+				last.Response += "\n\n"
+			}
+			last.Response += m.text
+			if m.model != "" {
+				last.ModelName = m.model
+			}
+			if !m.at.IsZero() && !last.Timestamp.IsZero() {
+				last.TimeTaken = m.at.Sub(last.Timestamp).Seconds()
+			}
+		}
+	}
+	return entries
+}
+
+// RedactEntries masks what detectors find in imported entries, as prompts
+// typed into chat-cli are masked before they are saved. Detectors that would
+// block a prompt mask instead, since the text was already sent elsewhere;
+// those that only warn leave it as is. Each session gets its own
+// placeholders. It returns what was found, by detector.
+func RedactEntries(entries []Entry, detectors []utils.Detector) []utils.RedactFinding {
+	masking := make([]utils.Detector, len(detectors))
+	for i, d := range detectors {
+		if d.Action == utils.RedactBlock {
+			d.Action = utils.RedactMask
+		}
+		masking[i] = d
+	}
+
+	var findings []utils.RedactFinding
+	found := map[string]int{} // Index into findings by detector
+	redactors := map[string]*utils.Redactor{}
+	redact := func(r *utils.Redactor, text string) string {
+		masked, fs, _ := r.Redact(text)
+		for _, f := range fs {
+			if i, ok := found[f.Detector]; ok {
+				findings[i].Count += f.Count
+			} else {
+				found[f.Detector] = len(findings)
+				findings = append(findings, f)
+			}
+		}
+		return masked
+	}
+	for i := range entries {
+		e := &entries[i]
+		r, ok := redactors[e.SessionID]
+		if !ok {
+			r = utils.NewRedactor(masking)
+			redactors[e.SessionID] = r
+		}
+		e.SystemPrompt = redact(r, e.SystemPrompt)
+		e.Prompt = redact(r, e.Prompt)
+		e.Response = redact(r, e.Response)
+	}
+	return findings
+}
+
+// shortHash returns the first n bytes of the SHA-256 of s as hex
+func shortHash(s string, n int) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:n])
+}
+
+// unixSeconds converts fractional Unix seconds, leaving zero as the zero time
+func unixSeconds(seconds float64) time.Time {
+	if seconds == 0 {
+		return time.Time{}
+	}
+	whole, frac := math.Modf(seconds)
+	return time.Unix(int64(whole), int64(frac*1e9))
+}
@@ -0,0 +1,194 @@
+package history
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"time"
+)
+
+// Retention limits how much history is kept. Zero fields mean no limit.
+type Retention struct {
+	MaxAge     time.Duration
+	MaxEntries int
+	MaxBytes   int64
+}
+
+// retention is enforced after every write to the store
+var retention Retention
+
+// SetRetention sets the limits enforced when history is written
+func SetRetention(r Retention) {
+	retention = r
+	checked = nil
+}
+
+// retentionCheck is what the last full read of the history file found.
+// Appends update it, so the file is only read again once a limit may have
+// been crossed, or when another process changed the file.
+type retentionCheck struct {
+	path    string
+	size    int64 // File size on disk
+	entries int   // Readable entries
+	oldest  time.Time
+}
+
+// checked is nil until the file is first read, once per process
+var checked *retentionCheck
+
+// add accounts for entries appended to the file, which grew by grown bytes
+func (c *retentionCheck) add(entries []Entry, grown int64) {
+	c.size += grown
+	c.entries += len(entries)
+	for _, entry := range entries {
+		if c.oldest.IsZero() || entry.Timestamp.Before(c.oldest) {
+			c.oldest = entry.Timestamp
+		}
+	}
+}
+
+// exceeds reports whether the file, as c describes it, is over a limit
+func (r Retention) exceeds(c *retentionCheck, now time.Time) bool {
+	return (r.MaxAge > 0 && !c.oldest.IsZero() && now.Sub(c.oldest) > r.MaxAge) ||
+		(r.MaxEntries > 0 && c.entries > r.MaxEntries) ||
+		(r.MaxBytes > 0 && c.size > r.MaxBytes)
+}
+
+// apply returns the lines within the limits, dropping the oldest entries
+// first and keeping the rest, and every line that can't be read, in their
+// original order
+func (r Retention) apply(lines []storedLine, now time.Time) []storedLine {
+	// Indexes of the entries from newest to oldest
+	var order []int
+	for i, line := range lines {
+		if line.entry != nil {
+			order = append(order, i)
+		}
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return lines[order[a]].entry.Timestamp.After(lines[order[b]].entry.Timestamp)
+	})
+
+	// Lines that can't be read are kept, and count toward the size first
+	keep := make([]bool, len(lines))
+	var size int64
+	for i, line := range lines {
+		if line.entry == nil {
+			keep[i] = true
+			size += int64(len(line.raw))
+		}
+	}
+	var kept int
+	for _, i := range order {
+		entry := *lines[i].entry
+		if r.MaxAge > 0 && now.Sub(entry.Timestamp) > r.MaxAge {
+			continue
+		}
+		if r.MaxEntries > 0 && kept >= r.MaxEntries {
+			break
+		}
+		if r.MaxBytes > 0 {
+			size += int64(len(lines[i].raw))
+			if size > r.MaxBytes {
+				break
+			}
+		}
+		keep[i] = true
+		kept++
+	}
+
+	var result []storedLine
+	for i, line := range lines {
+		if keep[i] {
+			result = append(result, line)
+		}
+	}
+	return result
+}
+
+// enforceRetention rewrites the file without the entries beyond the limits.
+// added are the entries just appended, which grew the file by grown bytes.
+func enforceRetention(filePath string, added []Entry, grown int64) error {
+	if retention == (Retention{}) {
+		return nil
+	}
+	info, err := os.Stat(filePath)
+	if err != nil {
+		return fmt.Errorf("failed to read history file: %w", err)
+	}
+	now := time.Now()
+	if c := checked; c != nil && c.path == filePath && c.size+grown == info.Size() {
+		c.add(added, grown)
+		if !retention.exceeds(c, now) {
+			return nil
+		}
+	} else if retention.MaxAge == 0 && retention.MaxEntries == 0 && info.Size() <= retention.MaxBytes {
+		// Only a size cap, so skip reading the file while it's under
+		return nil
+	}
+
+	lines, err := readLines(filePath)
+	if err != nil {
+		return err
+	}
+	kept := retention.apply(lines, now)
+	size := info.Size()
+	if len(kept) != len(lines) {
+		if err := writeLines(filePath, kept); err != nil {
+			return err
+		}
+		size = 0
+		for _, line := range kept {
+			size += int64(len(line.raw))
+		}
+	}
+	check := &retentionCheck{path: filePath, size: size}
+	for _, line := range kept {
+		if line.entry != nil {
+			check.add([]Entry{*line.entry}, 0)
+		}
+	}
+	checked = check
+	return nil
+}
+
+// Prune deletes the entries matching f and returns how many were removed
+func Prune(f Filter) (int, error) {
+	return removeEntries(func(entry Entry) bool { return f.Match(entry) })
+}
+
+// DeleteEntries deletes the entries with the given IDs and returns how many
+// were removed
+func DeleteEntries(ids ...string) (int, error) {
+	remove := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		remove[id] = true
+	}
+	return removeEntries(func(entry Entry) bool { return remove[entry.ID] })
+}
+
+// removeEntries rewrites the store without the entries for which drop is
+// true. The other lines are written back unchanged.
+func removeEntries(drop func(Entry) bool) (int, error) {
+	removed := 0
+	err := withStore(func(path string) error {
+		lines, err := readLines(path)
+		if err != nil {
+			return err
+		}
+		// Lines that can't be read are kept, since they can't be matched
+		kept := lines[:0]
+		for _, line := range lines {
+			if line.entry != nil && drop(*line.entry) {
+				removed++
+			} else {
+				kept = append(kept, line)
+			}
+		}
+		if removed == 0 {
+			return nil
+		}
+		return writeLines(path, kept)
+	})
+	return removed, err
+}
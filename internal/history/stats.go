@@ -0,0 +1,212 @@
+package history
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// StatsGroups lists the ways ComputeStats can group entries
+var StatsGroups = []string{"provider", "model", "day", "week", "session"}
+
+// CostFunc estimates the cost of an entry, reporting false when its model
+// has no known price
+type CostFunc func(provider, model string, inputTokens, outputTokens int) (float64, bool)
+
+// Stats aggregates usage for a group of entries
+type Stats struct {
+	Key          string
+	Turns        int
+	InputTokens  int
+	OutputTokens int
+	TotalTokens  int
+	AvgLatency   float64 // Seconds per response
+	TokensPerSec []float64
+	Scored       int     // Entries with an assessment
+	AvgScore     float64 // Over scored entries
+	ScoreTrend   float64 // Average score of the later half of scored entries minus the earlier half
+	Cost         float64 // Estimated US dollars over priced entries
+	Unpriced     int     // Entries whose model has no price
+}
+
+// Percentile returns the p-th percentile (0-100) of output tokens per second
+// using the nearest-rank method, or 0 without timed entries
+func (s Stats) Percentile(p float64) float64 {
+	if len(s.TokensPerSec) == 0 {
+		return 0
+	}
+	rank := int(math.Ceil(p / 100 * float64(len(s.TokensPerSec))))
+	rank = max(1, min(rank, len(s.TokensPerSec)))
+	return s.TokensPerSec[rank-1]
+}
+
+// ComputeStats groups entries by one of StatsGroups and aggregates each group.
+// It also returns the totals over all entries. Time-based groups are in
+// chronological order, the others sorted by key.
+func ComputeStats(entries []Entry, by string, cost CostFunc) ([]Stats, Stats, error) {
+	key, err := statsKey(by)
+	if err != nil {
+		return nil, Stats{}, err
+	}
+
+	sorted := make([]Entry, len(entries))
+	copy(sorted, entries)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Timestamp.Before(sorted[j].Timestamp)
+	})
+
+	var order []string
+	groups := map[string][]Entry{}
+	for _, entry := range sorted {
+		k := key(entry)
+		if _, ok := groups[k]; !ok {
+			order = append(order, k)
+		}
+		groups[k] = append(groups[k], entry)
+	}
+	if by != "day" && by != "week" && by != "session" {
+		sort.Strings(order)
+	}
+
+	stats := make([]Stats, 0, len(order))
+	for _, k := range order {
+		stats = append(stats, aggregate(k, groups[k], cost))
+	}
+	return stats, aggregate("total", sorted, cost), nil
+}
+
+// statsKey returns the function mapping an entry to its group
+func statsKey(by string) (func(Entry) string, error) {
+	switch by {
+	case "provider":
+		return func(e Entry) string { return orNone(e.Provider) }, nil
+	case "model":
+		return func(e Entry) string { return orNone(e.Provider) + "/" + orNone(e.ModelName) }, nil
+	case "day":
+		return func(e Entry) string { return e.Timestamp.Local().Format("2006-01-02") }, nil
+	case "week":
+		return func(e Entry) string {
+			year, week := e.Timestamp.Local().ISOWeek()
+			return fmt.Sprintf("%d-W%02d", year, week)
+		}, nil
+	case "session":
+		return func(e Entry) string { return orNone(e.SessionID) }, nil
+	}
+	return nil, fmt.Errorf("unknown grouping %q (use %s)", by, strings.Join(StatsGroups, ", "))
+}
+
+func orNone(s string) string {
+	if s == "" {
+		return "(none)"
+	}
+	return s
+}
+
+// aggregate computes the stats for entries in chronological order
+func aggregate(key string, entries []Entry, cost CostFunc) Stats {
+	s := Stats{Key: key, Turns: len(entries)}
+	var latency float64
+	var timed int
+	var scores []float64
+	for _, entry := range entries {
+		s.InputTokens += entry.InputTokens
+		s.OutputTokens += entry.OutputTokens
+		s.TotalTokens += entry.TotalTokens
+		if entry.TimeTaken > 0 {
+			latency += entry.TimeTaken
+			timed++
+			if entry.OutputTokens > 0 {
+				s.TokensPerSec = append(s.TokensPerSec, float64(entry.OutputTokens)/entry.TimeTaken)
+			}
+		}
+		if entry.Assessment != nil {
+			scores = append(scores, float64(entry.Assessment.OverallScore))
+		}
+		if cost != nil {
+			if c, ok := cost(entry.Provider, entry.ModelName, entry.InputTokens, entry.OutputTokens); ok {
+				s.Cost += c
+			} else {
+				s.Unpriced++
+			}
+		}
+	}
+	if timed > 0 {
+		s.AvgLatency = latency / float64(timed)
+	}
+	sort.Float64s(s.TokensPerSec)
+
+	s.Scored = len(scores)
+	if s.Scored > 0 {
+		s.AvgScore = mean(scores)
+	}
+	if s.Scored >= 2 {
+		half := s.Scored / 2
+		s.ScoreTrend = mean(scores[s.Scored-half:]) - mean(scores[:half])
+	}
+	return s
+}
+
+func mean(values []float64) float64 {
+	var sum float64
+	for _, v := range values {
+		sum += v
+	}
+	return sum / float64(len(values))
+}
+
+// ShowStats prints stats as a table with a totals row
+func ShowStats(w io.Writer, stats []Stats, total Stats, by string) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "%s\tTURNS\tINPUT\tOUTPUT\tTOTAL\tAVG LATENCY\tTOK/S P50\tP90\tSCORE\tTREND\tEST. COST\n", strings.ToUpper(by))
+	for _, s := range append(stats, total) {
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%d\t%d\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			s.Key, s.Turns, s.InputTokens, s.OutputTokens, s.TotalTokens,
+			formatLatency(s), formatRate(s, 50), formatRate(s, 90),
+			formatScore(s), formatTrend(s), formatCost(s))
+	}
+	tw.Flush()
+
+	if total.Unpriced > 0 {
+		fmt.Fprintf(w, "\n* %d entries have no price; add their models under \"prices\" in config.yaml\n", total.Unpriced)
+	}
+}
+
+func formatLatency(s Stats) string {
+	if s.AvgLatency == 0 {
+		return "-"
+	}
+	return (time.Duration(s.AvgLatency * float64(time.Second))).Round(10 * time.Millisecond).String()
+}
+
+func formatRate(s Stats, p float64) string {
+	if len(s.TokensPerSec) == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%.1f", s.Percentile(p))
+}
+
+func formatScore(s Stats) string {
+	if s.Scored == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%.1f (%d)", s.AvgScore, s.Scored)
+}
+
+func formatTrend(s Stats) string {
+	if s.Scored < 2 {
+		return "-"
+	}
+	return fmt.Sprintf("%+.1f", s.ScoreTrend)
+}
+
+func formatCost(s Stats) string {
+	cost := fmt.Sprintf("$%.4f", s.Cost)
+	if s.Unpriced > 0 {
+		cost += "*"
+	}
+	return cost
+}
@@ -0,0 +1,291 @@
+package history
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/cipher"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/valdezdata/chat-cli/internal/utils"
+)
+
+// History is stored as JSON Lines: one entry per line, appended under an
+// exclusive lock so concurrent chat-cli processes don't interleave writes.
+// Rewrites (clearing, pruning) go through a temp file and a rename, so a crash
+// leaves either the old file or the new one.
+const (
+	historyFileName = "history.jsonl"
+	legacyFileName  = "history.json" // Single JSON document used by older versions
+	lockFileName    = "history.lock"
+)
+
+// fileMode keeps history readable by its owner only
+const fileMode = 0600
+
+// GetHistoryFilePath returns the path to the history file
+func GetHistoryFilePath() (string, error) {
+	// Create .chat-cli directory if it doesn't exist
+	chatDir, err := utils.ChatDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(chatDir, historyFileName), nil
+}
+
+// withStore runs fn with the history file path while holding the history lock.
+// A legacy history.json is migrated first.
+func withStore(fn func(path string) error) error {
+	filePath, err := GetHistoryFilePath()
+	if err != nil {
+		return err
+	}
+	dir := filepath.Dir(filePath)
+
+	lock, err := os.OpenFile(filepath.Join(dir, lockFileName), os.O_CREATE|os.O_RDWR, fileMode)
+	if err != nil {
+		return fmt.Errorf("failed to open history lock: %w", err)
+	}
+	defer lock.Close()
+	if err := lockFile(lock); err != nil {
+		return fmt.Errorf("failed to lock history: %w", err)
+	}
+	defer unlockFile(lock)
+
+	if err := migrateLegacy(dir, filePath); err != nil {
+		return err
+	}
+	if err := restrictPermissions(dir); err != nil {
+		return err
+	}
+	return fn(filePath)
+}
+
+// restrictPermissions tightens history files created by older versions with
+// 0644 permissions
+func restrictPermissions(dir string) error {
+	for _, name := range []string{historyFileName, legacyFileName + ".bak", lockFileName} {
+		path := filepath.Join(dir, name)
+		info, err := os.Stat(path)
+		if err != nil || info.Mode().Perm()&^fileMode == 0 {
+			continue
+		}
+		if err := os.Chmod(path, fileMode); err != nil {
+			return fmt.Errorf("failed to restrict permissions of %s: %w", path, err)
+		}
+	}
+	return nil
+}
+
+// migrateLegacy converts history.json to JSON Lines and keeps the original as
+// history.json.bak
+func migrateLegacy(dir, filePath string) error {
+	legacyPath := filepath.Join(dir, legacyFileName)
+	data, err := os.ReadFile(legacyPath)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read legacy history file: %w", err)
+	}
+
+	// An interrupted migration may already have written the new file
+	if _, err := os.Stat(filePath); os.IsNotExist(err) {
+		var legacy History
+		if len(bytes.TrimSpace(data)) > 0 {
+			if err := json.Unmarshal(data, &legacy); err != nil {
+				return fmt.Errorf("failed to parse legacy history file %s: %w", legacyPath, err)
+			}
+		}
+		if err := writeEntries(filePath, legacy.Entries); err != nil {
+			return fmt.Errorf("failed to migrate history: %w", err)
+		}
+	}
+
+	if err := os.Rename(legacyPath, legacyPath+".bak"); err != nil {
+		return fmt.Errorf("failed to back up legacy history file: %w", err)
+	}
+	return nil
+}
+
+// storedLine is one line of the history file. entry is nil for a line that
+// can't be read, such as a final line cut short by a crash or one encrypted
+// under another passphrase; rewrites keep those lines as they are.
+type storedLine struct {
+	raw   []byte // As on disk, including the newline
+	entry *Entry
+}
+
+// readLines reads every line of the file
+func readLines(filePath string) ([]storedLine, error) {
+	f, err := os.Open(filePath)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read history file: %w", err)
+	}
+	defer f.Close()
+
+	var lines []storedLine
+	reader := bufio.NewReader(f)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(bytes.TrimSpace(line)) > 0 {
+			stored := storedLine{raw: line}
+			if !bytes.HasSuffix(line, []byte("\n")) {
+				stored.raw = append(line, '\n')
+			}
+			entry, decodeErr := decodeLine(filePath, line)
+			if decodeErr != nil && decodeErr != errMalformed {
+				return nil, decodeErr
+			}
+			if decodeErr == nil {
+				if entry.ID == "" {
+					entry.ID = derivedID(entry)
+				}
+				stored.entry = &entry
+			}
+			lines = append(lines, stored)
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read history file: %w", err)
+		}
+	}
+	return lines, nil
+}
+
+// readEntries reads every entry in the file. Lines that can't be read are
+// skipped and counted.
+func readEntries(filePath string) ([]Entry, int, error) {
+	lines, err := readLines(filePath)
+	if err != nil {
+		return nil, 0, err
+	}
+	entries := []Entry{}
+	skipped := 0
+	for _, line := range lines {
+		if line.entry == nil {
+			skipped++
+		} else {
+			entries = append(entries, *line.entry)
+		}
+	}
+	return entries, skipped, nil
+}
+
+// appendEntry appends one entry as a single write and returns how many
+// bytes it added
+func appendEntry(filePath string, entry Entry) (int64, error) {
+	aead, err := writeCipher(filePath)
+	if err != nil {
+		return 0, err
+	}
+	line, err := encodeLine(entry, aead)
+	if err != nil {
+		return 0, err
+	}
+
+	f, err := os.OpenFile(filePath, os.O_CREATE|os.O_RDWR|os.O_APPEND, fileMode)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open history file: %w", err)
+	}
+	defer f.Close()
+
+	// Start on a fresh line if a previous write was cut short
+	if info, err := f.Stat(); err == nil && info.Size() > 0 {
+		last := make([]byte, 1)
+		if _, err := f.ReadAt(last, info.Size()-1); err == nil && last[0] != '\n' {
+			line = append([]byte{'\n'}, line...)
+		}
+	}
+
+	if _, err := f.Write(line); err != nil {
+		return 0, fmt.Errorf("failed to write history file: %w", err)
+	}
+	if err := f.Sync(); err != nil {
+		return 0, fmt.Errorf("failed to sync history file: %w", err)
+	}
+	return int64(len(line)), nil
+}
+
+// writeEntries atomically replaces the file with entries, encrypted if
+// encryption is on
+func writeEntries(filePath string, entries []Entry) error {
+	aead, err := writeCipher(filePath)
+	if err != nil {
+		return err
+	}
+	return writeEntriesWith(filePath, entries, aead)
+}
+
+// writeEntriesWith atomically replaces the file with entries, encrypted with
+// aead unless it is nil
+func writeEntriesWith(filePath string, entries []Entry, aead cipher.AEAD) error {
+	return replaceFile(filePath, func(w io.Writer) error {
+		for _, entry := range entries {
+			line, err := encodeLine(entry, aead)
+			if err != nil {
+				return err
+			}
+			if _, err := w.Write(line); err != nil {
+				return fmt.Errorf("failed to write history file: %w", err)
+			}
+		}
+		return nil
+	})
+}
+
+// writeLines atomically replaces the file with lines, byte for byte
+func writeLines(filePath string, lines []storedLine) error {
+	return replaceFile(filePath, func(w io.Writer) error {
+		for _, line := range lines {
+			if _, err := w.Write(line.raw); err != nil {
+				return fmt.Errorf("failed to write history file: %w", err)
+			}
+		}
+		return nil
+	})
+}
+
+// replaceFile writes the file's new content with write to a temp file and
+// renames it into place
+func replaceFile(filePath string, write func(w io.Writer) error) error {
+	tmp, err := os.CreateTemp(filepath.Dir(filePath), historyFileName+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temp history file: %w", err)
+	}
+	defer os.Remove(tmp.Name()) // No-op once renamed
+
+	w := bufio.NewWriter(tmp)
+	if err := write(w); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write history file: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to sync history file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write history file: %w", err)
+	}
+	if err := os.Chmod(tmp.Name(), fileMode); err != nil {
+		return fmt.Errorf("failed to set history file permissions: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), filePath); err != nil {
+		return fmt.Errorf("failed to replace history file: %w", err)
+	}
+	checked = nil // Retention checks start over with the new content
+	return nil
+}
@@ -0,0 +1,214 @@
+package providers
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/valdezdata/chat-cli/internal/logging"
+	"github.com/valdezdata/chat-cli/internal/utils"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// Environment variables read by the generic OpenAI-compatible provider.
+const (
+	CompatAPIKeyEnv = "OPENAI_COMPAT_API_KEY"
+	CompatModelEnv  = "OPENAI_COMPAT_MODEL"
+	CompatBaseEnv   = "OPENAI_COMPAT_BASE_URL"
+)
+
+// compatListTimeout bounds the model lookup when no model is configured
+const compatListTimeout = 10 * time.Second
+
+// compatPreset describes an OpenAI-compatible endpoint. Groq and Together are
+// presets; the generic provider builds one from its configuration.
+type compatPreset struct {
+	name         string            // Display name for logs and errors
+	apiKeyEnv    string            // Environment variable holding the API key
+	requireKey   bool              // Local servers often need no key
+	modelEnv     string            // Environment variable selecting the model
+	models       map[string]string // Optional model aliases
+	defaultModel string            // Alias used when no model is set; empty asks the server
+	baseURLEnv   string            // Environment variable overriding the base URL
+	baseURL      string            // Default base URL; empty requires one to be set
+}
+
+// CompatClient talks to any server implementing the OpenAI chat completions
+// API, such as vLLM, LM Studio, llama.cpp server or LiteLLM.
+type CompatClient struct {
+	preset        compatPreset
+	client        *openai.Client
+	systemPrompt  string
+	selectedModel string
+	logger        *logging.Logger // Logger instance
+}
+
+// SetLogger injects the logger.
+func (c *CompatClient) SetLogger(logger *logging.Logger) {
+	c.logger = logger
+}
+
+// log helper for internal logging.
+func (c *CompatClient) log(level logging.LogLevel, format string, args ...interface{}) {
+	if c.logger != nil {
+		switch level {
+		case logging.DEBUG:
+			c.logger.Debug(format, args...)
+		case logging.INFO:
+			c.logger.Info(format, args...)
+		case logging.WARN:
+			c.logger.Warn(format, args...)
+		case logging.ERROR:
+			c.logger.Error(format, args...)
+		}
+	}
+}
+
+// Initialize sets up the generic client. The base URL is required; without a
+// model, the first one the server lists is used. The API key is read from
+// cfg.APIKeyEnv (default OPENAI_COMPAT_API_KEY) and may be empty for servers
+// that don't check it.
+func (c *CompatClient) Initialize(cfg Config) error {
+	apiKeyEnv := cfg.APIKeyEnv
+	if apiKeyEnv == "" {
+		apiKeyEnv = CompatAPIKeyEnv
+	}
+	return c.initialize(compatPreset{
+		name:       "OpenAI-compatible",
+		apiKeyEnv:  apiKeyEnv,
+		modelEnv:   CompatModelEnv,
+		baseURLEnv: CompatBaseEnv,
+	}, cfg)
+}
+
+// initialize sets up the client for preset.
+func (c *CompatClient) initialize(preset compatPreset, cfg Config) error {
+	c.preset = preset
+
+	apiKey := os.Getenv(preset.apiKeyEnv)
+	if apiKey == "" && preset.requireKey {
+		return fmt.Errorf("%s env var not set", preset.apiKeyEnv)
+	}
+
+	baseURL := setting(cfg.BaseURL, preset.baseURLEnv)
+	if baseURL == "" {
+		baseURL = preset.baseURL
+	}
+	if baseURL == "" {
+		return fmt.Errorf("%s base URL not set (use --base-url, base_url in config.yaml or %s)", preset.name, preset.baseURLEnv)
+	}
+
+	c.log(logging.DEBUG, "Initializing %s client (URL: %s)...", preset.name, baseURL)
+	if apiKey != "" {
+		c.log(logging.DEBUG, "Using API key from %s: %s", preset.apiKeyEnv, utils.RedactAPIKey(apiKey))
+	} else {
+		c.log(logging.DEBUG, "%s not set, sending requests without an API key", preset.apiKeyEnv)
+	}
+
+	config := openai.DefaultConfig(apiKey)
+	config.BaseURL = baseURL
+	c.client = openai.NewClientWithConfig(config)
+
+	c.selectedModel = resolveModel(preset.models, setting(cfg.Model, preset.modelEnv), preset.defaultModel)
+	if c.selectedModel == "" {
+		// Local servers usually serve a single model, so ask for it
+		ctx, cancel := context.WithTimeout(context.Background(), compatListTimeout)
+		defer cancel()
+		models, err := c.ListModels(ctx)
+		if err != nil || len(models) == 0 {
+			return fmt.Errorf("%s model not set (use --model, model in config.yaml or %s)", preset.name, preset.modelEnv)
+		}
+		c.selectedModel = models[0]
+		c.log(logging.WARN, "%s model not set, using '%s' listed by the server", preset.name, c.selectedModel)
+	}
+	c.log(logging.DEBUG, "Selected %s model: %s", preset.name, c.selectedModel)
+
+	c.systemPrompt = cfg.systemPrompt()
+
+	c.log(logging.INFO, "%s client initialized (Model: %s)", preset.name, c.selectedModel)
+	return nil
+}
+
+// GetModelName returns the selected model identifier.
+func (c *CompatClient) GetModelName() string {
+	return c.selectedModel
+}
+
+// ListModels returns the model IDs from the server's /models endpoint.
+func (c *CompatClient) ListModels(ctx context.Context) ([]string, error) {
+	return listOpenAIModels(ctx, c.client)
+}
+
+// SendMessage sends the conversation and streams the reply.
+func (c *CompatClient) SendMessage(ctx context.Context, messages []Message, params MessageParams, sink Sink) (Response, error) {
+	name := c.preset.name
+	c.log(logging.DEBUG, "%s: Sending %d messages", name, len(messages))
+
+	start := time.Now()
+	req := openai.ChatCompletionRequest{
+		Model:    c.selectedModel,
+		Messages: toOpenAIMessages(c.systemPrompt, messages),
+		Stream:   true,
+		// Ask for a final usage chunk so token counts come from the API
+		StreamOptions: &openai.StreamOptions{IncludeUsage: true},
+	}
+	applyOpenAIParams(&req, params)
+
+	c.log(logging.DEBUG, "%s: Creating stream for model %s", name, c.selectedModel)
+	stream, err := c.client.CreateChatCompletionStream(ctx, req)
+	if err != nil {
+		if ctx.Err() != nil {
+			c.log(logging.INFO, "%s: Request canceled before streaming started", name)
+			return Response{}, ctx.Err()
+		}
+		c.log(logging.ERROR, "%s: Failed to create stream: %v", name, err)
+		if apiErr, ok := err.(*openai.APIError); ok {
+			return Response{}, fmt.Errorf("%s API error (%d): %v - %s", name, apiErr.HTTPStatusCode, apiErr.Code, apiErr.Message)
+		}
+		return Response{}, fmt.Errorf("failed to create stream: %w", err)
+	}
+	defer stream.Close()
+
+	var fullResponse strings.Builder
+	var usage Usage
+	c.log(logging.DEBUG, "%s: Receiving stream...", name)
+	for {
+		response, err := stream.Recv()
+		if err != nil {
+			if ctx.Err() != nil {
+				// Return the partial reply so the caller can keep it
+				partial := fullResponse.String()
+				c.log(logging.INFO, "%s: Stream canceled after %d chars", name, len(partial))
+				return Response{Content: partial, Elapsed: time.Since(start), Usage: usage}, ctx.Err()
+			}
+			if err == io.EOF || strings.Contains(err.Error(), "EOF") {
+				c.log(logging.DEBUG, "%s: Stream finished (EOF)", name)
+				break
+			}
+			c.log(logging.ERROR, "%s: Stream receive error: %v", name, err)
+			return Response{Content: fullResponse.String(), Elapsed: time.Since(start), Usage: usage}, fmt.Errorf("stream error: %w", err)
+		}
+
+		if u := response.Usage; u != nil {
+			usage = reportedUsage(u.PromptTokens, u.CompletionTokens, u.TotalTokens)
+		}
+		if len(response.Choices) > 0 {
+			contentChunk := response.Choices[0].Delta.Content
+			sink.delta(contentChunk)
+			fullResponse.WriteString(contentChunk)
+		} else if response.Usage == nil {
+			c.log(logging.WARN, "%s: Received stream response with no choices", name)
+		}
+	}
+	sink.done()
+
+	elapsed := time.Since(start)
+	finalResponseStr := fullResponse.String()
+	c.log(logging.DEBUG, "%s: Response received (%d chars) in %v", name, len(finalResponseStr), elapsed)
+
+	return Response{Content: finalResponseStr, Elapsed: elapsed, Usage: usage}, nil
+}
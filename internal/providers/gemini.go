@@ -4,6 +4,8 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"slices"
+	"sort"
 	"strings"
 	"time"
 
@@ -11,7 +13,6 @@ import (
 	"github.com/valdezdata/chat-cli/internal/logging"
 	"github.com/valdezdata/chat-cli/internal/utils"
 
-	"github.com/fatih/color"
 	"github.com/google/generative-ai-go/genai"
 	"google.golang.org/api/iterator"
 	"google.golang.org/api/option"
@@ -24,11 +25,13 @@ var geminiModels = map[string]string{
 	"gemini-flash-lite": "gemini-2.0-flash-lite",
 }
 
+// geminiModelRole is the role Gemini uses for assistant turns
+const geminiModelRole = "model"
+
 // GeminiClient handles communication with the Google Gemini API.
 type GeminiClient struct {
 	client        *genai.Client
 	model         *genai.GenerativeModel
-	messages      []*genai.Content
 	selectedModel string
 	logger        *logging.Logger
 }
@@ -55,7 +58,7 @@ func (g *GeminiClient) log(level logging.LogLevel, format string, args ...interf
 }
 
 // Initialize sets up the client with API key and model.
-func (g *GeminiClient) Initialize() error {
+func (g *GeminiClient) Initialize(cfg Config) error {
 	apiKey := os.Getenv("GEMINI_API_KEY")
 	if apiKey == "" {
 		return fmt.Errorf("GEMINI_API_KEY env var not set")
@@ -66,32 +69,29 @@ func (g *GeminiClient) Initialize() error {
 
 	// Set up the client
 	ctx := context.Background()
-	client, err := genai.NewClient(ctx, option.WithAPIKey(apiKey))
+	clientOpts := []option.ClientOption{option.WithAPIKey(apiKey)}
+	if baseURL := setting(cfg.BaseURL, "GEMINI_BASE_URL"); baseURL != "" {
+		g.log(logging.DEBUG, "Using Gemini base URL override: %s", baseURL)
+		clientOpts = append(clientOpts, option.WithEndpoint(baseURL))
+	}
+	client, err := genai.NewClient(ctx, clientOpts...)
 	if err != nil {
 		g.log(logging.ERROR, "Failed to create Gemini client: %v", err)
 		return fmt.Errorf("failed to create Gemini client: %w", err)
 	}
 	g.client = client
 
-	// Get model from environment or use default
-	modelEnv := os.Getenv("GEMINI_MODEL")
-	g.selectedModel = geminiModels[modelEnv]
-	if g.selectedModel == "" {
-		defaultModel := geminiModels["gemini-flash-lite"]
-		g.log(logging.WARN, "GEMINI_MODEL '%s' not found or not set, using default '%s'", modelEnv, defaultModel)
-		g.selectedModel = defaultModel
-	} else {
-		g.log(logging.DEBUG, "Selected Gemini model: %s", g.selectedModel)
-	}
+	// Get model from config or environment, or use default
+	g.selectedModel = resolveModel(geminiModels, setting(cfg.Model, "GEMINI_MODEL"), "gemini-flash-lite")
+	g.log(logging.DEBUG, "Selected Gemini model: %s", g.selectedModel)
 
-	// Create the model and set parameters
+	// Create the model; sampling parameters are applied per request
 	g.model = g.client.GenerativeModel(g.selectedModel)
-	g.model.SetTemperature(0.7)
-	g.model.SetTopP(0.95)
 
-	// Initialize with empty conversation history
-	// Note: Gemini doesn't support system role messages
-	g.messages = []*genai.Content{}
+	// Gemini takes the system prompt as a model setting rather than a message
+	g.model.SystemInstruction = &genai.Content{
+		Parts: []genai.Part{genai.Text(cfg.systemPrompt())},
+	}
 
 	g.log(logging.INFO, "Gemini client initialized (Model: %s)", g.selectedModel)
 	return nil
@@ -102,38 +102,48 @@ func (g *GeminiClient) GetModelName() string {
 	return g.selectedModel
 }
 
-// SendMessage sends a user message and streams the response.
-func (g *GeminiClient) SendMessage(message string) (string, time.Duration, error) {
-	g.log(logging.DEBUG, "Gemini: Processing user message (%d chars)", len(message))
+// ListModels returns the models that support content generation.
+func (g *GeminiClient) ListModels(ctx context.Context) ([]string, error) {
+	var ids []string
+	iter := g.client.ListModels(ctx)
+	for {
+		info, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to list models: %w", err)
+		}
+		if slices.Contains(info.SupportedGenerationMethods, "generateContent") {
+			ids = append(ids, strings.TrimPrefix(info.Name, "models/"))
+		}
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
 
-	// Add user message to conversation history
-	g.messages = append(g.messages, &genai.Content{
-		Role: "user",
-		Parts: []genai.Part{
-			genai.Text(message),
-		},
-	})
+// SendMessage sends the conversation and streams the reply.
+func (g *GeminiClient) SendMessage(ctx context.Context, messages []Message, params MessageParams, sink Sink) (Response, error) {
+	if len(messages) == 0 {
+		return Response{}, fmt.Errorf("no message to send")
+	}
+	g.log(logging.DEBUG, "Gemini: Processing %d messages", len(messages))
+	g.applyParams(params)
 
 	start := time.Now()
 
-	// Create a chat session
-	ctx := context.Background()
+	// Gemini takes the earlier turns as the chat history and the last one as
+	// the message
 	chat := g.model.StartChat()
-
-	// Only set history if we have previous messages
-	if len(g.messages) > 1 { // More than just the current message
-		chat.History = g.messages[:len(g.messages)-1] // Exclude the current message
-	}
+	last := len(messages) - 1
+	chat.History = toGeminiContents(messages[:last])
 
 	// Send the message and stream the response
 	g.log(logging.DEBUG, "Gemini: Sending request and starting stream")
-	iter := chat.SendMessageStream(ctx, genai.Text(message))
-
-	assistantColor := color.New(color.FgHiMagenta)
-	assistantPrompt := assistantColor.PrintfFunc()
-	assistantPrompt("%s Assistant: ", consts.RobotEmoji) // Prefix only once
+	iter := chat.SendMessageStream(ctx, genai.Text(messages[last].Content))
 
 	var fullResponse strings.Builder
+	var usage Usage
 
 	for {
 		resp, err := iter.Next()
@@ -142,31 +152,73 @@ func (g *GeminiClient) SendMessage(message string) (string, time.Duration, error
 			break
 		}
 		if err != nil {
+			if ctx.Err() != nil {
+				// Return the partial reply so the caller can keep it
+				partial := fullResponse.String()
+				g.log(logging.INFO, "Gemini: Stream canceled after %d chars", len(partial))
+				return Response{Content: partial, Elapsed: time.Since(start), Usage: usage}, ctx.Err()
+			}
 			g.log(logging.ERROR, "Gemini: Stream error: %v", err)
-			return fullResponse.String(), time.Since(start), fmt.Errorf("stream error: %w", err)
+			return Response{Content: fullResponse.String(), Elapsed: time.Since(start), Usage: usage}, fmt.Errorf("stream error: %w", err)
+		}
+
+		// Usage metadata is cumulative, so the last chunk carries the totals
+		if u := resp.UsageMetadata; u != nil {
+			usage = reportedUsage(int(u.PromptTokenCount), int(u.CandidatesTokenCount), int(u.TotalTokenCount))
+		}
+		if len(resp.Candidates) == 0 || resp.Candidates[0].Content == nil {
+			continue
 		}
 
-		// Display and collect response chunks
+		// Forward and collect response chunks
 		for _, part := range resp.Candidates[0].Content.Parts {
-			chunk := part.(genai.Text)
+			chunk, ok := part.(genai.Text)
+			if !ok {
+				continue
+			}
 			chunkStr := string(chunk)
-			assistantPrompt("%s", chunkStr) // Stream output
+			sink.delta(chunkStr)
 			fullResponse.WriteString(chunkStr)
 		}
 	}
-	fmt.Println() // Newline after streaming
+	sink.done()
 
 	elapsed := time.Since(start)
 	finalResponseStr := fullResponse.String()
 	g.log(logging.DEBUG, "Gemini: Response received (%d chars) in %v", len(finalResponseStr), elapsed)
 
-	// Add assistant response to conversation history
-	g.messages = append(g.messages, &genai.Content{
-		Role: "assistant",
-		Parts: []genai.Part{
-			genai.Text(finalResponseStr),
-		},
-	})
+	return Response{Content: finalResponseStr, Elapsed: elapsed, Usage: usage}, nil
+}
 
-	return finalResponseStr, elapsed, nil
+// toGeminiContents converts neutral messages to Gemini contents
+func toGeminiContents(messages []Message) []*genai.Content {
+	contents := make([]*genai.Content, 0, len(messages))
+	for _, m := range messages {
+		role := m.Role
+		if role == consts.AssistantRole {
+			role = geminiModelRole
+		}
+		contents = append(contents, &genai.Content{
+			Role:  role,
+			Parts: []genai.Part{genai.Text(m.Content)},
+		})
+	}
+	return contents
+}
+
+// applyParams sets the generation config for the next request.
+func (g *GeminiClient) applyParams(params MessageParams) {
+	g.model.GenerationConfig = genai.GenerationConfig{}
+	g.model.SetTemperature(float32(params.Temperature))
+	g.model.SetTopP(0.95)
+	if params.TopP > 0 {
+		g.model.SetTopP(float32(params.TopP))
+	}
+	if params.MaxTokens > 0 {
+		g.model.SetMaxOutputTokens(int32(params.MaxTokens))
+	}
+	g.model.StopSequences = params.Stop
+	if params.Seed != nil {
+		g.log(logging.WARN, "Gemini: seed is not supported by this API version, ignoring")
+	}
 }
@@ -1,20 +1,115 @@
 package providers
 
-import "time"
+import (
+	"context"
+	"os"
+	"time"
+)
+
+// DefaultSystemPrompt is used when no system prompt is configured
+const DefaultSystemPrompt = "Provide helpful and concise responses"
+
+// Config holds the settings a client is initialized with. Empty fields fall
+// back to the provider's environment variables and built-in defaults.
+type Config struct {
+	Model        string // Model alias or ID
+	BaseURL      string // API base URL
+	APIKeyEnv    string // API key environment variable (OpenAI-compatible provider only)
+	SystemPrompt string
+}
+
+// setting returns value, or the environment variable env when value is empty
+func setting(value, env string) string {
+	if value != "" {
+		return value
+	}
+	return os.Getenv(env)
+}
+
+// systemPrompt returns the configured system prompt or the default
+func (c Config) systemPrompt() string {
+	if c.SystemPrompt != "" {
+		return c.SystemPrompt
+	}
+	return DefaultSystemPrompt
+}
+
+// resolveModel maps an alias to its model ID. Any other non-empty name is used
+// as a raw model ID, and an empty name selects defaultAlias.
+func resolveModel(aliases map[string]string, name, defaultAlias string) string {
+	if id, ok := aliases[name]; ok {
+		return id
+	}
+	if name != "" {
+		return name
+	}
+	return aliases[defaultAlias]
+}
+
+// Message is a provider-neutral chat message. Role is one of the consts.*Role
+// values.
+type Message struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
 
 // MessageParams defines optional parameters for message sending
 type MessageParams struct {
 	Temperature float64
-	MaxTokens   int
+	MaxTokens   int      // 0 leaves the provider default
+	TopP        float64  // 0 leaves the provider default
+	Stop        []string // Stop sequences
+	Seed        *int     // nil leaves sampling unseeded
+}
+
+// UsageSourceProvider marks token counts reported by the provider's API
+const UsageSourceProvider = "provider"
+
+// Usage holds the token counts for a single request
+type Usage struct {
+	InputTokens  int
+	OutputTokens int
+	TotalTokens  int
+	Source       string // UsageSourceProvider, or how the counts were estimated
+}
+
+// Response is the result of a SendMessage call
+type Response struct {
+	Content string
+	Elapsed time.Duration
+	Usage   Usage // Zero unless the provider reported usage
 }
 
 // ChatInterface defines the common interface for all chat providers
 type ChatInterface interface {
-	Initialize() error
-	SendMessage(message string) (string, time.Duration, error)
+	Initialize(cfg Config) error
+	// SendMessage sends a conversation and returns the full reply. messages
+	// hold the user and assistant turns in order, ending with the new user
+	// message; the client adds its configured system prompt. Clients keep no
+	// conversation of their own, so one can pick up a conversation another
+	// started. Streamed chunks are delivered to sink as they arrive; sink may
+	// be nil. If ctx is canceled mid-stream, the partial reply is returned
+	// together with ctx.Err().
+	SendMessage(ctx context.Context, messages []Message, params MessageParams, sink Sink) (Response, error)
 	GetModelName() string
+}
+
+// ModelLister is implemented by clients that can list the models their
+// server offers
+type ModelLister interface {
+	ListModels(ctx context.Context) ([]string, error)
+}
 
-	// These can be implemented in a future update
-	// SetTemperature(temp float64)
-	// SetMaxTokens(tokens int)
+// reportedUsage builds a Usage from provider token counts, deriving the total
+// when the API leaves it out
+func reportedUsage(input, output, total int) Usage {
+	if total == 0 {
+		total = input + output
+	}
+	return Usage{
+		InputTokens:  input,
+		OutputTokens: output,
+		TotalTokens:  total,
+		Source:       UsageSourceProvider,
+	}
 }
@@ -2,20 +2,23 @@ package providers
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
-	"os"
+	"sort"
 	"strings"
 	"time"
 
 	"github.com/valdezdata/chat-cli/internal/consts"
 	"github.com/valdezdata/chat-cli/internal/logging" // Import logging
-
-	"github.com/fatih/color"
 )
 
+// ollamaConnectTimeout bounds the connection check in Initialize. Chat requests
+// have no fixed timeout; they run until the caller's context is canceled.
+const ollamaConnectTimeout = 10 * time.Second
+
 // Supported Ollama models (local names).
 var ollamaModels = map[string]string{
 	"mistral":  "mistral:latest",
@@ -35,7 +38,16 @@ type OllamaRequest struct {
 	Model    string          `json:"model"`
 	Messages []OllamaMessage `json:"messages"`
 	Stream   bool            `json:"stream"`
-	// Options map[string]interface{} `json:"options,omitempty"` // Add for temp, etc.
+	Options  *OllamaOptions  `json:"options,omitempty"`
+}
+
+// OllamaOptions holds the sampling parameters for an Ollama request.
+type OllamaOptions struct {
+	Temperature float64  `json:"temperature"`
+	NumPredict  int      `json:"num_predict,omitempty"`
+	TopP        float64  `json:"top_p,omitempty"`
+	Stop        []string `json:"stop,omitempty"`
+	Seed        *int     `json:"seed,omitempty"`
 }
 
 // OllamaResponse structure for Ollama stream chunks.
@@ -44,13 +56,15 @@ type OllamaResponse struct {
 	CreatedAt time.Time     `json:"created_at"`
 	Message   OllamaMessage `json:"message"`
 	Done      bool          `json:"done"`
-	// Other fields like total_duration, etc., might be present when done=true
+	// Token counts, present in the final chunk (done=true)
+	PromptEvalCount int `json:"prompt_eval_count,omitempty"`
+	EvalCount       int `json:"eval_count,omitempty"`
 }
 
 // OllamaClient handles communication with a local Ollama instance.
 type OllamaClient struct {
 	serverURL     string
-	messages      []OllamaMessage
+	systemPrompt  string
 	selectedModel string
 	httpClient    *http.Client    // Use a shared client
 	logger        *logging.Logger // Logger instance
@@ -78,32 +92,29 @@ func (o *OllamaClient) log(level logging.LogLevel, format string, args ...interf
 }
 
 // Initialize sets up the client, checks connection, and selects model.
-func (o *OllamaClient) Initialize() error {
-	o.serverURL = os.Getenv("OLLAMA_URL")
+func (o *OllamaClient) Initialize(cfg Config) error {
+	o.serverURL = setting(cfg.BaseURL, "OLLAMA_URL")
 	if o.serverURL == "" {
 		o.serverURL = "http://localhost:11434" // Default local URL
 	}
-	o.httpClient = &http.Client{Timeout: 60 * time.Second} // Client with timeout
+	o.httpClient = &http.Client{} // Requests are bounded by their context
 
 	o.log(logging.DEBUG, "Initializing Ollama client (URL: %s)...", o.serverURL)
 
-	modelEnv := os.Getenv("OLLAMA_MODEL")
-	o.selectedModel = ollamaModels[modelEnv]
-	if o.selectedModel == "" {
-		defaultModel := ollamaModels["llama"]
-		o.log(logging.WARN, "OLLAMA_MODEL '%s' not found or not set, using default '%s'", modelEnv, defaultModel)
-		o.selectedModel = defaultModel
-	} else {
-		o.log(logging.DEBUG, "Selected Ollama model: %s", o.selectedModel)
-	}
+	o.selectedModel = resolveModel(ollamaModels, setting(cfg.Model, "OLLAMA_MODEL"), "llama")
+	o.log(logging.DEBUG, "Selected Ollama model: %s", o.selectedModel)
 
-	o.messages = []OllamaMessage{
-		{Role: consts.SystemRole, Content: "Provide helpful and concise responses"},
-	}
+	o.systemPrompt = cfg.systemPrompt()
 
 	// Check connection to Ollama server
 	o.log(logging.DEBUG, "Checking connection to Ollama server at %s", o.serverURL)
-	resp, err := o.httpClient.Get(o.serverURL) // Simple GET to base URL often works
+	ctx, cancel := context.WithTimeout(context.Background(), ollamaConnectTimeout)
+	defer cancel()
+	checkReq, err := http.NewRequestWithContext(ctx, http.MethodGet, o.serverURL, nil) // Simple GET to base URL often works
+	if err != nil {
+		return fmt.Errorf("invalid Ollama URL %s: %w", o.serverURL, err)
+	}
+	resp, err := o.httpClient.Do(checkReq)
 	if err != nil {
 		o.log(logging.ERROR, "Could not connect to Ollama server at %s: %v", o.serverURL, err)
 		return fmt.Errorf("could not connect to Ollama server at %s: %w", o.serverURL, err)
@@ -128,82 +139,133 @@ func (o *OllamaClient) GetModelName() string {
 	return o.selectedModel
 }
 
-// SendMessage sends a user message and streams the response from Ollama.
-func (o *OllamaClient) SendMessage(message string) (string, time.Duration, error) {
-	o.log(logging.DEBUG, "Ollama: Appending user message (%d chars)", len(message))
-	o.messages = append(o.messages, OllamaMessage{
-		Role: consts.UserRole, Content: message,
-	})
+// ListModels returns the models pulled on the Ollama server (/api/tags).
+func (o *OllamaClient) ListModels(ctx context.Context) ([]string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, o.serverURL+"/api/tags", nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	resp, err := o.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list models: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		bodyBytes, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("API request failed (%d): %s", resp.StatusCode, string(bodyBytes))
+	}
+
+	var tags struct {
+		Models []struct {
+			Name string `json:"name"`
+		} `json:"models"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&tags); err != nil {
+		return nil, fmt.Errorf("failed to decode model list: %w", err)
+	}
+	ids := make([]string, 0, len(tags.Models))
+	for _, m := range tags.Models {
+		ids = append(ids, m.Name)
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
+
+// SendMessage sends the conversation and streams the reply from Ollama.
+func (o *OllamaClient) SendMessage(ctx context.Context, messages []Message, params MessageParams, sink Sink) (Response, error) {
+	o.log(logging.DEBUG, "Ollama: Sending %d messages", len(messages))
+	ollamaMessages := make([]OllamaMessage, 0, len(messages)+1)
+	ollamaMessages = append(ollamaMessages, OllamaMessage{Role: consts.SystemRole, Content: o.systemPrompt})
+	for _, m := range messages {
+		ollamaMessages = append(ollamaMessages, OllamaMessage{Role: m.Role, Content: m.Content})
+	}
 
 	start := time.Now()
 
 	reqPayload := OllamaRequest{
 		Model:    o.selectedModel,
-		Messages: o.messages,
+		Messages: ollamaMessages,
 		Stream:   true,
-		// Options: map[string]interface{}{"temperature": 0.7}, // Example options
+		Options: &OllamaOptions{
+			Temperature: params.Temperature,
+			NumPredict:  params.MaxTokens,
+			TopP:        params.TopP,
+			Stop:        params.Stop,
+			Seed:        params.Seed,
+		},
 	}
 
 	reqData, err := json.Marshal(reqPayload)
 	if err != nil {
 		o.log(logging.ERROR, "Ollama: Failed to marshal request: %v", err)
-		return "", 0, fmt.Errorf("failed to marshal request: %w", err)
+		return Response{}, fmt.Errorf("failed to marshal request: %w", err)
 	}
 
 	o.log(logging.DEBUG, "Ollama: Sending request to %s/api/chat for model %s", o.serverURL, o.selectedModel)
-	resp, err := o.httpClient.Post(o.serverURL+"/api/chat", "application/json", bytes.NewBuffer(reqData))
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, o.serverURL+"/api/chat", bytes.NewBuffer(reqData))
 	if err != nil {
+		o.log(logging.ERROR, "Ollama: Failed to create request: %v", err)
+		return Response{}, fmt.Errorf("failed to create request: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	resp, err := o.httpClient.Do(httpReq)
+	if err != nil {
+		if ctx.Err() != nil {
+			o.log(logging.INFO, "Ollama: Request canceled before streaming started")
+			return Response{}, ctx.Err()
+		}
 		o.log(logging.ERROR, "Ollama: Failed to send request: %v", err)
-		return "", 0, fmt.Errorf("failed to send request: %w", err)
+		return Response{}, fmt.Errorf("failed to send request: %w", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
 		bodyBytes, _ := io.ReadAll(resp.Body)
 		o.log(logging.ERROR, "Ollama: API request failed (Status: %d): %s", resp.StatusCode, string(bodyBytes))
-		return "", 0, fmt.Errorf("API request failed (%d): %s", resp.StatusCode, string(bodyBytes))
+		return Response{}, fmt.Errorf("API request failed (%d): %s", resp.StatusCode, string(bodyBytes))
 	}
 
-	assistantColor := color.New(color.FgHiMagenta)
-	assistantPrompt := assistantColor.PrintfFunc()
-	assistantPrompt("%s Assistant: ", consts.RobotEmoji) // Prefix only once
-
 	var fullResponse strings.Builder
+	var usage Usage
 	decoder := json.NewDecoder(resp.Body)
 
 	o.log(logging.DEBUG, "Ollama: Receiving stream...")
 	for {
 		var ollamaResp OllamaResponse
 		if err := decoder.Decode(&ollamaResp); err != nil {
+			if ctx.Err() != nil {
+				// Return the partial reply so the caller can keep it
+				partial := fullResponse.String()
+				o.log(logging.INFO, "Ollama: Stream canceled after %d chars", len(partial))
+				return Response{Content: partial, Elapsed: time.Since(start), Usage: usage}, ctx.Err()
+			}
 			if err == io.EOF {
 				o.log(logging.DEBUG, "Ollama: Stream finished (EOF)")
 				break // End of stream
 			}
 			o.log(logging.ERROR, "Ollama: Failed to decode stream chunk: %v", err)
 			// Return partial response with error
-			return fullResponse.String(), time.Since(start), fmt.Errorf("failed to decode response: %w", err)
+			return Response{Content: fullResponse.String(), Elapsed: time.Since(start), Usage: usage}, fmt.Errorf("failed to decode response: %w", err)
 		}
 
 		contentChunk := ollamaResp.Message.Content
-		assistantPrompt("%s", contentChunk) // Stream output
+		sink.delta(contentChunk)
 		fullResponse.WriteString(contentChunk)
 
 		// Check the 'done' field which Ollama sends in the last chunk
 		if ollamaResp.Done {
 			o.log(logging.DEBUG, "Ollama: Received 'done' flag in stream.")
+			if ollamaResp.PromptEvalCount > 0 || ollamaResp.EvalCount > 0 {
+				usage = reportedUsage(ollamaResp.PromptEvalCount, ollamaResp.EvalCount, 0)
+			}
 			break
 		}
 	}
-	fmt.Println() // Newline after streaming
+	sink.done()
 
 	elapsed := time.Since(start)
 	finalResponseStr := fullResponse.String()
 	o.log(logging.DEBUG, "Ollama: Response received (%d chars) in %v", len(finalResponseStr), elapsed)
 
-	// Append the full response to maintain conversation context
-	o.messages = append(o.messages, OllamaMessage{
-		Role: consts.AssistantRole, Content: finalResponseStr,
-	})
-
-	return finalResponseStr, elapsed, nil
+	return Response{Content: finalResponseStr, Elapsed: elapsed, Usage: usage}, nil
 }
@@ -4,7 +4,9 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"math"
 	"os"
+	"sort"
 	"strings"
 	"time"
 
@@ -12,7 +14,6 @@ import (
 	"github.com/valdezdata/chat-cli/internal/logging"
 	"github.com/valdezdata/chat-cli/internal/utils"
 
-	"github.com/fatih/color"
 	"github.com/sashabaranov/go-openai"
 )
 
@@ -24,7 +25,7 @@ var openaiModels = map[string]string{
 // OpenAIClient handles communication with the OpenAI API.
 type OpenAIClient struct {
 	client        *openai.Client
-	messages      []openai.ChatCompletionMessage
+	systemPrompt  string
 	selectedModel string
 	logger        *logging.Logger // Logger instance
 }
@@ -51,7 +52,7 @@ func (o *OpenAIClient) log(level logging.LogLevel, format string, args ...interf
 }
 
 // Initialize sets up the client with API key and model.
-func (o *OpenAIClient) Initialize() error {
+func (o *OpenAIClient) Initialize(cfg Config) error {
 	apiKey := os.Getenv("OPENAI_API_KEY")
 	if apiKey == "" {
 		return fmt.Errorf("OPENAI_API_KEY env var not set")
@@ -64,21 +65,17 @@ func (o *OpenAIClient) Initialize() error {
 	o.log(logging.DEBUG, "Initializing OpenAI client...")
 	o.log(logging.DEBUG, "Using API key: %s", utils.RedactAPIKey(apiKey))
 
-	o.client = openai.NewClient(apiKey)
-
-	modelEnv := os.Getenv("OPENAI_MODEL")
-	o.selectedModel = openaiModels[modelEnv]
-	if o.selectedModel == "" {
-		defaultModel := openaiModels["gpt-4.1-nano"]
-		o.log(logging.WARN, "OPENAI_MODEL '%s' not found or not set, using default '%s'", modelEnv, defaultModel)
-		o.selectedModel = defaultModel
-	} else {
-		o.log(logging.DEBUG, "Selected OpenAI model: %s", o.selectedModel)
+	config := openai.DefaultConfig(apiKey)
+	if baseURL := setting(cfg.BaseURL, "OPENAI_BASE_URL"); baseURL != "" {
+		o.log(logging.DEBUG, "Using OpenAI base URL override: %s", baseURL)
+		config.BaseURL = baseURL
 	}
+	o.client = openai.NewClientWithConfig(config)
 
-	o.messages = []openai.ChatCompletionMessage{
-		{Role: consts.SystemRole, Content: "Provide helpful and concise responses"},
-	}
+	o.selectedModel = resolveModel(openaiModels, setting(cfg.Model, "OPENAI_MODEL"), "gpt-4.1-nano")
+	o.log(logging.DEBUG, "Selected OpenAI model: %s", o.selectedModel)
+
+	o.systemPrompt = cfg.systemPrompt()
 
 	o.log(logging.INFO, "OpenAI client initialized (Model: %s)", o.selectedModel)
 	return nil
@@ -89,67 +86,118 @@ func (o *OpenAIClient) GetModelName() string {
 	return o.selectedModel
 }
 
-// SendMessage sends a user message and streams the response.
-func (o *OpenAIClient) SendMessage(message string) (string, time.Duration, error) {
-	o.log(logging.DEBUG, "OpenAI: Appending user message (%d chars)", len(message))
-	o.messages = append(o.messages, openai.ChatCompletionMessage{
-		Role: consts.UserRole, Content: message,
-	})
+// ListModels returns the model IDs available to the API key.
+func (o *OpenAIClient) ListModels(ctx context.Context) ([]string, error) {
+	return listOpenAIModels(ctx, o.client)
+}
+
+// SendMessage sends the conversation and streams the reply.
+func (o *OpenAIClient) SendMessage(ctx context.Context, messages []Message, params MessageParams, sink Sink) (Response, error) {
+	o.log(logging.DEBUG, "OpenAI: Sending %d messages", len(messages))
 
 	start := time.Now()
 	req := openai.ChatCompletionRequest{
 		Model:    o.selectedModel,
-		Messages: o.messages,
-		// Temperature: 0.7, // Add if needed, or get from opts
-		Stream: true,
+		Messages: toOpenAIMessages(o.systemPrompt, messages),
+		Stream:   true,
+		// Ask for a final usage chunk so token counts come from the API
+		StreamOptions: &openai.StreamOptions{IncludeUsage: true},
 	}
+	applyOpenAIParams(&req, params)
 
 	o.log(logging.DEBUG, "OpenAI: Creating stream for model %s", o.selectedModel)
-	stream, err := o.client.CreateChatCompletionStream(context.Background(), req)
+	stream, err := o.client.CreateChatCompletionStream(ctx, req)
 	if err != nil {
+		if ctx.Err() != nil {
+			o.log(logging.INFO, "OpenAI: Request canceled before streaming started")
+			return Response{}, ctx.Err()
+		}
 		o.log(logging.ERROR, "OpenAI: Failed to create stream: %v", err)
 		errMsg := fmt.Sprintf("failed to create stream: %v", err)
 		if apiErr, ok := err.(*openai.APIError); ok {
 			errMsg = fmt.Sprintf("OpenAI API error (%d): %s - %s", apiErr.HTTPStatusCode, apiErr.Code, apiErr.Message)
 		}
-		return "", 0, fmt.Errorf(errMsg)
+		return Response{}, fmt.Errorf(errMsg)
 	}
 	defer stream.Close()
 
-	assistantColor := color.New(color.FgHiMagenta)
-	assistantPrompt := assistantColor.PrintfFunc()
-	assistantPrompt("%s Assistant: ", consts.RobotEmoji) // Prefix only once
-
 	var fullResponse strings.Builder
+	var usage Usage
 	o.log(logging.DEBUG, "OpenAI: Receiving stream...")
 	for {
 		response, err := stream.Recv()
 		if err != nil {
+			if ctx.Err() != nil {
+				// Return the partial reply so the caller can keep it
+				partial := fullResponse.String()
+				o.log(logging.INFO, "OpenAI: Stream canceled after %d chars", len(partial))
+				return Response{Content: partial, Elapsed: time.Since(start), Usage: usage}, ctx.Err()
+			}
 			if err == io.EOF || strings.Contains(err.Error(), "EOF") {
 				o.log(logging.DEBUG, "OpenAI: Stream finished (EOF)")
 				break
 			}
 			o.log(logging.ERROR, "OpenAI: Stream receive error: %v", err)
-			return fullResponse.String(), time.Since(start), fmt.Errorf("stream error: %w", err)
+			return Response{Content: fullResponse.String(), Elapsed: time.Since(start), Usage: usage}, fmt.Errorf("stream error: %w", err)
 		}
 
+		if u := response.Usage; u != nil {
+			usage = reportedUsage(u.PromptTokens, u.CompletionTokens, u.TotalTokens)
+		}
 		if len(response.Choices) > 0 {
 			contentChunk := response.Choices[0].Delta.Content
-			assistantPrompt("%s", contentChunk) // Stream output
+			sink.delta(contentChunk)
 			fullResponse.WriteString(contentChunk)
-		} else {
+		} else if response.Usage == nil {
 			o.log(logging.WARN, "OpenAI: Received stream response with no choices")
 		}
 	}
-	fmt.Println() // Newline after streaming
+	sink.done()
 
 	elapsed := time.Since(start)
 	finalResponseStr := fullResponse.String()
 	o.log(logging.DEBUG, "OpenAI: Response received (%d chars) in %v", len(finalResponseStr), elapsed)
 
-	o.messages = append(o.messages, openai.ChatCompletionMessage{
-		Role: consts.AssistantRole, Content: finalResponseStr,
-	})
+	return Response{Content: finalResponseStr, Elapsed: elapsed, Usage: usage}, nil
+}
 
-	return finalResponseStr, elapsed, nil
+// applyOpenAIParams copies the per-request parameters onto an OpenAI-compatible
+// chat completion request. It is shared by every client built on go-openai.
+func applyOpenAIParams(req *openai.ChatCompletionRequest, params MessageParams) {
+	// go-openai's request has no way to send a temperature of 0: the field is
+	// omitempty, and the API then falls back to its default of 1. The
+	// smallest non-zero float32 goes out as 1e-45, which samples as 0 does.
+	req.Temperature = float32(params.Temperature)
+	if params.Temperature == 0 {
+		req.Temperature = math.SmallestNonzeroFloat32
+	}
+	req.MaxTokens = params.MaxTokens
+	req.TopP = float32(params.TopP)
+	req.Stop = params.Stop
+	req.Seed = params.Seed
+}
+
+// listOpenAIModels lists the model IDs served by an OpenAI-compatible API
+func listOpenAIModels(ctx context.Context, client *openai.Client) ([]string, error) {
+	list, err := client.ListModels(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list models: %w", err)
+	}
+	ids := make([]string, 0, len(list.Models))
+	for _, m := range list.Models {
+		ids = append(ids, m.ID)
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
+
+// toOpenAIMessages converts the system prompt and neutral messages to the
+// go-openai type
+func toOpenAIMessages(systemPrompt string, messages []Message) []openai.ChatCompletionMessage {
+	converted := make([]openai.ChatCompletionMessage, 0, len(messages)+1)
+	converted = append(converted, openai.ChatCompletionMessage{Role: consts.SystemRole, Content: systemPrompt})
+	for _, m := range messages {
+		converted = append(converted, openai.ChatCompletionMessage{Role: m.Role, Content: m.Content})
+	}
+	return converted
 }
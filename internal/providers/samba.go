@@ -8,13 +8,12 @@ import (
 	"io"
 	"net/http"
 	"os"
+	"sort"
 	"time"
 
 	"github.com/valdezdata/chat-cli/internal/consts"
 	"github.com/valdezdata/chat-cli/internal/logging" // Import logging
 	"github.com/valdezdata/chat-cli/internal/utils"   // For RedactAPIKey
-
-	"github.com/fatih/color"
 )
 
 // Supported SambaNova models.
@@ -27,23 +26,21 @@ var sambaModels = map[string]string{
 type SambaClient struct {
 	apiKey        string
 	baseURL       string
-	messages      []Message // Using a local Message type for SambaNova
+	systemPrompt  string
 	selectedModel string
 	httpClient    *http.Client
 	logger        *logging.Logger // Logger instance
 }
 
-// Message represents a chat message for SambaNova API structure.
-type Message struct {
-	Role    string `json:"role"`
-	Content string `json:"content"`
-}
-
 // ChatCompletionRequest for SambaNova API.
 type ChatCompletionRequest struct {
 	Model       string    `json:"model"`
 	Messages    []Message `json:"messages"`
 	Temperature float64   `json:"temperature"`
+	MaxTokens   int       `json:"max_tokens,omitempty"`
+	TopP        float64   `json:"top_p,omitempty"`
+	Stop        []string  `json:"stop,omitempty"`
+	Seed        *int      `json:"seed,omitempty"`
 	Stream      bool      `json:"stream"` // Note: SambaNova implementation uses non-streaming
 }
 
@@ -54,6 +51,11 @@ type ChatCompletionResponse struct {
 			Content string `json:"content"`
 		} `json:"message"`
 	} `json:"choices"`
+	Usage *struct {
+		PromptTokens     int `json:"prompt_tokens"`
+		CompletionTokens int `json:"completion_tokens"`
+		TotalTokens      int `json:"total_tokens"`
+	} `json:"usage,omitempty"`
 }
 
 // SetLogger injects the logger.
@@ -78,7 +80,7 @@ func (s *SambaClient) log(level logging.LogLevel, format string, args ...interfa
 }
 
 // Initialize sets up the client with API key, base URL, and model.
-func (s *SambaClient) Initialize() error {
+func (s *SambaClient) Initialize(cfg Config) error {
 	s.apiKey = os.Getenv("SAMBA_API_KEY")
 	if s.apiKey == "" {
 		return fmt.Errorf("SAMBA_API_KEY env var not set")
@@ -89,22 +91,17 @@ func (s *SambaClient) Initialize() error {
 	s.log(logging.DEBUG, "Initializing SambaNova client...")
 	s.log(logging.DEBUG, "Using API key: %s", utils.RedactAPIKey(s.apiKey))
 
-	modelEnv := os.Getenv("SAMBA_MODEL")
-	s.selectedModel = sambaModels[modelEnv]
-	if s.selectedModel == "" {
-		defaultModel := sambaModels["llama-70b"]
-		s.log(logging.WARN, "SAMBA_MODEL '%s' not found or not set, using default '%s'", modelEnv, defaultModel)
-		s.selectedModel = defaultModel
-	} else {
-		s.log(logging.DEBUG, "Selected SambaNova model: %s", s.selectedModel)
-	}
+	s.selectedModel = resolveModel(sambaModels, setting(cfg.Model, "SAMBA_MODEL"), "llama-70b")
+	s.log(logging.DEBUG, "Selected SambaNova model: %s", s.selectedModel)
 
-	s.baseURL = "https://api.sambanova.ai/v1"              // SambaNova API base URL
-	s.httpClient = &http.Client{Timeout: 60 * time.Second} // Increased timeout for potentially slower models
+	s.baseURL = "https://api.sambanova.ai/v1" // SambaNova API base URL
+	if baseURL := setting(cfg.BaseURL, "SAMBA_BASE_URL"); baseURL != "" {
+		s.log(logging.DEBUG, "Using SambaNova base URL override: %s", baseURL)
+		s.baseURL = baseURL
+	}
+	s.httpClient = &http.Client{} // Each request carries its own deadline
 
-	// Initial message list is empty for SambaNova, build context per request maybe?
-	// Or initialize with system prompt if supported:
-	// s.messages = []Message{{Role: consts.SystemRole, Content: "..."}}
+	s.systemPrompt = cfg.systemPrompt()
 
 	s.log(logging.INFO, "SambaNova client initialized (Model: %s)", s.selectedModel)
 	return nil
@@ -115,27 +112,60 @@ func (s *SambaClient) GetModelName() string {
 	return s.selectedModel
 }
 
-// SendMessage sends a user message and gets a non-streamed response.
-func (s *SambaClient) SendMessage(message string) (string, time.Duration, error) {
-	s.log(logging.DEBUG, "SambaNova: Preparing message (%d chars)", len(message))
+// ListModels returns the model IDs from the SambaNova /models endpoint.
+func (s *SambaClient) ListModels(ctx context.Context) ([]string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.baseURL+"/models", nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+s.apiKey)
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list models: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		respBody, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("API request failed (%d): %s", resp.StatusCode, string(respBody))
+	}
+
+	var list struct {
+		Data []struct {
+			ID string `json:"id"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&list); err != nil {
+		return nil, fmt.Errorf("failed to decode model list: %w", err)
+	}
+	ids := make([]string, 0, len(list.Data))
+	for _, m := range list.Data {
+		ids = append(ids, m.ID)
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
+
+// SendMessage sends the conversation and gets a non-streamed reply.
+func (s *SambaClient) SendMessage(ctx context.Context, messages []Message, params MessageParams, sink Sink) (Response, error) {
+	s.log(logging.DEBUG, "SambaNova: Preparing %d messages", len(messages))
 
-	// Append the new user message to the current context for this request
-	// Note: SambaNova might require managing context differently than OpenAI's message list.
-	// This assumes a simple append works. Adjust if state needs to be reset or managed.
-	currentMessages := append(s.messages, Message{
-		Role: consts.UserRole, Content: message,
-	})
+	// Message matches the SambaNova wire format
+	currentMessages := append([]Message{{Role: consts.SystemRole, Content: s.systemPrompt}}, messages...)
 
 	start := time.Now()
 
 	// Create request with context for timeout
-	ctx, cancel := context.WithTimeout(context.Background(), 90*time.Second) // Longer timeout for request
+	reqCtx, cancel := context.WithTimeout(ctx, 90*time.Second) // Longer timeout for request
 	defer cancel()
 
 	req := ChatCompletionRequest{
 		Model:       s.selectedModel,
 		Messages:    currentMessages, // Send current conversation context
-		Temperature: 0.7,
+		Temperature: params.Temperature,
+		MaxTokens:   params.MaxTokens,
+		TopP:        params.TopP,
+		Stop:        params.Stop,
+		Seed:        params.Seed,
 		Stream:      false, // SambaNova implementation uses non-streaming
 	}
 
@@ -143,14 +173,14 @@ func (s *SambaClient) SendMessage(message string) (string, time.Duration, error)
 	requestBody, err := json.Marshal(req)
 	if err != nil {
 		s.log(logging.ERROR, "SambaNova: Failed to marshal request: %v", err)
-		return "", 0, fmt.Errorf("failed to marshal request: %w", err)
+		return Response{}, fmt.Errorf("failed to marshal request: %w", err)
 	}
 
 	s.log(logging.DEBUG, "SambaNova: Creating HTTP POST request to %s/chat/completions", s.baseURL)
-	httpReq, err := http.NewRequestWithContext(ctx, "POST", s.baseURL+"/chat/completions", bytes.NewBuffer(requestBody))
+	httpReq, err := http.NewRequestWithContext(reqCtx, "POST", s.baseURL+"/chat/completions", bytes.NewBuffer(requestBody))
 	if err != nil {
 		s.log(logging.ERROR, "SambaNova: Failed to create HTTP request: %v", err)
-		return "", 0, fmt.Errorf("failed to create request: %w", err)
+		return Response{}, fmt.Errorf("failed to create request: %w", err)
 	}
 
 	httpReq.Header.Set("Content-Type", "application/json")
@@ -159,18 +189,24 @@ func (s *SambaClient) SendMessage(message string) (string, time.Duration, error)
 	s.log(logging.DEBUG, "SambaNova: Sending request...")
 	resp, err := s.httpClient.Do(httpReq)
 	if err != nil {
+		if ctx.Err() != nil {
+			return s.canceled(ctx)
+		}
 		// Handle context deadline exceeded specifically
-		if ctx.Err() == context.DeadlineExceeded {
+		if reqCtx.Err() == context.DeadlineExceeded {
 			s.log(logging.ERROR, "SambaNova: Request timed out: %v", err)
-			return "", 0, fmt.Errorf("request timed out after 90s")
+			return Response{}, fmt.Errorf("request timed out after 90s")
 		}
 		s.log(logging.ERROR, "SambaNova: Failed to send request: %v", err)
-		return "", 0, fmt.Errorf("failed to send request: %w", err)
+		return Response{}, fmt.Errorf("failed to send request: %w", err)
 	}
 	defer resp.Body.Close()
 
 	s.log(logging.DEBUG, "SambaNova: Received response (Status: %s)", resp.Status)
 	respBody, err := io.ReadAll(resp.Body) // Read body for potential error details
+	if ctx.Err() != nil {
+		return s.canceled(ctx)
+	}
 	if err != nil {
 		s.log(logging.ERROR, "SambaNova: Failed to read response body: %v", err)
 		// Still try to proceed if status code is OK, but log the read error
@@ -178,7 +214,7 @@ func (s *SambaClient) SendMessage(message string) (string, time.Duration, error)
 
 	if resp.StatusCode != http.StatusOK {
 		s.log(logging.ERROR, "SambaNova: API request failed (Status: %d): %s", resp.StatusCode, string(respBody))
-		return "", 0, fmt.Errorf("API request failed (%d): %s", resp.StatusCode, string(respBody))
+		return Response{}, fmt.Errorf("API request failed (%d): %s", resp.StatusCode, string(respBody))
 	}
 
 	s.log(logging.DEBUG, "SambaNova: Decoding JSON response")
@@ -186,29 +222,35 @@ func (s *SambaClient) SendMessage(message string) (string, time.Duration, error)
 	if err := json.Unmarshal(respBody, &completionResp); err != nil {
 		s.log(logging.ERROR, "SambaNova: Failed to decode response JSON: %v", err)
 		s.log(logging.DEBUG, "SambaNova: Raw response body: %s", string(respBody))
-		return "", 0, fmt.Errorf("failed to decode response: %w", err)
+		return Response{}, fmt.Errorf("failed to decode response: %w", err)
 	}
 
 	if len(completionResp.Choices) == 0 || completionResp.Choices[0].Message.Content == "" {
 		s.log(logging.WARN, "SambaNova: No choices or empty content returned in response")
 		// Return empty string but no error, as the API call succeeded technically
-		return "", time.Since(start), nil
+		sink.done()
+		return Response{Elapsed: time.Since(start)}, nil
 	}
 
-	assistantColor := color.New(color.FgHiMagenta)
-	assistantPrompt := assistantColor.PrintfFunc()
-	assistantPrompt("%s Assistant: ", consts.RobotEmoji)
-
 	content := completionResp.Choices[0].Message.Content
 	elapsed := time.Since(start)
 	s.log(logging.DEBUG, "SambaNova: Response received (%d chars) in %v", len(content), elapsed)
 
-	assistantPrompt("%s\n", content) // Print the full response at once
+	var usage Usage
+	if u := completionResp.Usage; u != nil {
+		usage = reportedUsage(u.PromptTokens, u.CompletionTokens, u.TotalTokens)
+	}
+
+	// Deliver the full response as a single chunk
+	sink.delta(content)
+	sink.done()
 
-	// Update the persistent message history for the next turn
-	s.messages = append(currentMessages, Message{
-		Role: consts.AssistantRole, Content: content,
-	})
+	return Response{Content: content, Elapsed: elapsed, Usage: usage}, nil
+}
 
-	return content, elapsed, nil
+// canceled reports a request the caller canceled. SambaNova responses are not
+// streamed, so there is no partial reply to return.
+func (s *SambaClient) canceled(ctx context.Context) (Response, error) {
+	s.log(logging.INFO, "SambaNova: Request canceled")
+	return Response{}, ctx.Err()
 }
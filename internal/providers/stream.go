@@ -0,0 +1,46 @@
+package providers
+
+// EventType identifies the kind of event a provider emits while streaming
+type EventType int
+
+// Stream event types
+const (
+	EventDelta EventType = iota // A chunk of response text
+	EventDone                   // The response is complete
+)
+
+// Event is a single streaming event emitted by a provider
+type Event struct {
+	Type  EventType
+	Delta string // Response text, set for EventDelta
+}
+
+// Sink receives the events of a streamed response. A nil Sink discards them.
+// Events are delivered synchronously from SendMessage, so a Sink should not block.
+type Sink func(Event)
+
+// ChannelSink returns a Sink that forwards every event to ch
+func ChannelSink(ch chan<- Event) Sink {
+	return func(e Event) {
+		ch <- e
+	}
+}
+
+// emit delivers an event to the sink if one was supplied
+func (s Sink) emit(e Event) {
+	if s != nil {
+		s(e)
+	}
+}
+
+// delta emits a text chunk, skipping empty ones
+func (s Sink) delta(text string) {
+	if text != "" {
+		s.emit(Event{Type: EventDelta, Delta: text})
+	}
+}
+
+// done emits the completion event
+func (s Sink) done() {
+	s.emit(Event{Type: EventDone})
+}
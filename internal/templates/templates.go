@@ -0,0 +1,263 @@
+package templates
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"text/template"
+	"text/template/parse"
+
+	"github.com/valdezdata/chat-cli/internal/utils"
+)
+
+// Prompt templates live in ~/.chat-cli/templates as <name>.tmpl files using
+// text/template syntax. Variables are map keys, such as {{.lang}}; piped input
+// is {{.input}} and a -s prompt is {{.prompt}}. A leading {{/* comment */}}
+// is the template's description.
+const (
+	dirName   = "templates"
+	extension = ".tmpl"
+)
+
+// Well-known variables filled in by chat-cli
+const (
+	InputVar  = "input"
+	PromptVar = "prompt"
+)
+
+var (
+	namePattern        = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+	descriptionPattern = regexp.MustCompile(`^\{\{-?\s*/\*\s*(.*?)\s*\*/\s*-?\}\}`)
+)
+
+// funcs are available in every template
+var funcs = template.FuncMap{
+	"upper": strings.ToUpper,
+	"lower": strings.ToLower,
+	"trim":  strings.TrimSpace,
+	"default": func(fallback, value string) string {
+		if value == "" {
+			return fallback
+		}
+		return value
+	},
+}
+
+// Template is a prompt template
+type Template struct {
+	Name        string
+	Path        string
+	Description string
+	Text        string
+}
+
+// Dir returns the templates directory, creating it if needed
+func Dir() (string, error) {
+	chatDir, err := utils.ChatDir()
+	if err != nil {
+		return "", err
+	}
+	dir := filepath.Join(chatDir, dirName)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", fmt.Errorf("failed to create templates directory: %w", err)
+	}
+	return dir, nil
+}
+
+// List returns the templates sorted by name
+func List() ([]Template, error) {
+	dir, err := Dir()
+	if err != nil {
+		return nil, err
+	}
+	paths, err := filepath.Glob(filepath.Join(dir, "*"+extension))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(paths)
+
+	list := make([]Template, 0, len(paths))
+	for _, path := range paths {
+		t, err := Load(strings.TrimSuffix(filepath.Base(path), extension))
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, t)
+	}
+	return list, nil
+}
+
+// Load reads the template called name
+func Load(name string) (Template, error) {
+	path, err := pathFor(name)
+	if err != nil {
+		return Template{}, err
+	}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return Template{}, fmt.Errorf("no template named %q (see \"chat-cli templates list\")", name)
+	}
+	if err != nil {
+		return Template{}, fmt.Errorf("failed to read template %s: %w", name, err)
+	}
+
+	t := Template{Name: name, Path: path, Text: string(data)}
+	if m := descriptionPattern.FindStringSubmatch(strings.TrimSpace(t.Text)); m != nil {
+		t.Description = m[1]
+	}
+	return t, nil
+}
+
+// Create writes a new template, refusing to overwrite an existing one
+func Create(name, text string) (Template, error) {
+	path, err := pathFor(name)
+	if err != nil {
+		return Template{}, err
+	}
+	if _, err := compile(name, text); err != nil {
+		return Template{}, err
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if os.IsExist(err) {
+		return Template{}, fmt.Errorf("template %q already exists: %s", name, path)
+	}
+	if err != nil {
+		return Template{}, fmt.Errorf("failed to create template: %w", err)
+	}
+	defer f.Close()
+	if _, err := f.WriteString(text); err != nil {
+		return Template{}, fmt.Errorf("failed to write template: %w", err)
+	}
+	return Load(name)
+}
+
+// pathFor validates name and returns its file path
+func pathFor(name string) (string, error) {
+	if !namePattern.MatchString(name) {
+		return "", fmt.Errorf("invalid template name %q (use letters, digits, '-' and '_')", name)
+	}
+	dir, err := Dir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, name+extension), nil
+}
+
+func compile(name, text string) (*template.Template, error) {
+	tmpl, err := template.New(name).Funcs(funcs).Option("missingkey=zero").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid template %s: %w", name, err)
+	}
+	return tmpl, nil
+}
+
+// Render executes the template with vars. Missing variables are empty.
+func (t Template) Render(vars map[string]string) (string, error) {
+	tmpl, err := compile(t.Name, t.Text)
+	if err != nil {
+		return "", err
+	}
+	if vars == nil {
+		vars = map[string]string{}
+	}
+	var b strings.Builder
+	if err := tmpl.Execute(&b, vars); err != nil {
+		return "", fmt.Errorf("failed to render template %s: %w", t.Name, err)
+	}
+	return strings.TrimSpace(b.String()), nil
+}
+
+// Variables returns the names of the variables the template uses
+func (t Template) Variables() []string {
+	tmpl, err := compile(t.Name, t.Text)
+	if err != nil {
+		return nil
+	}
+	seen := map[string]bool{}
+	for _, tree := range tmpl.Templates() {
+		if tree.Tree != nil {
+			collectFields(tree.Tree.Root, seen)
+		}
+	}
+	names := make([]string, 0, len(seen))
+	for name := range seen {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Uses reports whether the template references the variable name
+func (t Template) Uses(name string) bool {
+	for _, v := range t.Variables() {
+		if v == name {
+			return true
+		}
+	}
+	return false
+}
+
+// collectFields records the top-level fields referenced under node
+func collectFields(node parse.Node, seen map[string]bool) {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, child := range n.Nodes {
+			collectFields(child, seen)
+		}
+	case *parse.ActionNode:
+		collectFields(n.Pipe, seen)
+	case *parse.PipeNode:
+		if n == nil {
+			return
+		}
+		for _, cmd := range n.Cmds {
+			for _, arg := range cmd.Args {
+				collectFields(arg, seen)
+			}
+		}
+	case *parse.FieldNode:
+		seen[n.Ident[0]] = true
+	case *parse.ChainNode:
+		collectFields(n.Node, seen)
+	case *parse.IfNode:
+		collectBranch(&n.BranchNode, seen)
+	case *parse.RangeNode:
+		collectBranch(&n.BranchNode, seen)
+	case *parse.WithNode:
+		collectBranch(&n.BranchNode, seen)
+	case *parse.TemplateNode:
+		collectFields(n.Pipe, seen)
+	}
+}
+
+func collectBranch(n *parse.BranchNode, seen map[string]bool) {
+	collectFields(n.Pipe, seen)
+	collectFields(n.List, seen)
+	collectFields(n.ElseList, seen)
+}
+
+// ParseVars parses key=value pairs
+func ParseVars(pairs []string) (map[string]string, error) {
+	vars := make(map[string]string, len(pairs))
+	for _, pair := range pairs {
+		key, value, ok := strings.Cut(pair, "=")
+		if !ok || key == "" {
+			return nil, fmt.Errorf("invalid variable %q (use key=value)", pair)
+		}
+		vars[key] = value
+	}
+	return vars, nil
+}
+
+// Skeleton is the starting text for a new template
+const Skeleton = `{{/* Describe what this template is for */}}
+Review the following {{default "code" .lang}} for bugs and security issues.
+
+{{.input}}
+`
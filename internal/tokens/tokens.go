@@ -0,0 +1,63 @@
+package tokens
+
+import (
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// Estimator approximates the number of tokens in a piece of text. It is only
+// used when a provider does not report usage for a request.
+type Estimator interface {
+	// Name identifies the estimator in history and metrics
+	Name() string
+	// Count returns the estimated token count for text
+	Count(text string) int
+}
+
+var (
+	mu        sync.RWMutex
+	estimator Estimator = HeuristicEstimator{}
+)
+
+// SetEstimator replaces the estimator used by Estimate
+func SetEstimator(e Estimator) {
+	mu.Lock()
+	defer mu.Unlock()
+	estimator = e
+}
+
+// Current returns the estimator used by Estimate
+func Current() Estimator {
+	mu.RLock()
+	defer mu.RUnlock()
+	return estimator
+}
+
+// Estimate counts the tokens in text with the current estimator
+func Estimate(text string) int {
+	return Current().Count(text)
+}
+
+// HeuristicEstimator assumes roughly four characters per token, which is close
+// for English prose and code with BPE tokenizers, and never returns fewer
+// tokens than there are words.
+type HeuristicEstimator struct{}
+
+// Name returns the estimator name
+func (HeuristicEstimator) Name() string {
+	return "heuristic"
+}
+
+// Count returns the estimated token count for text
+func (HeuristicEstimator) Count(text string) int {
+	chars := utf8.RuneCountInString(text)
+	if chars == 0 {
+		return 0
+	}
+	estimate := (chars + 3) / 4
+	if words := len(strings.Fields(text)); words > estimate {
+		return words
+	}
+	return estimate
+}
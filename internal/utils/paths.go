@@ -0,0 +1,28 @@
+package utils
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// ChatDir returns the ~/.chat-cli directory, creating it if needed. It holds
+// history and logs, so it is kept private to its owner.
+func ChatDir() (string, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get home directory: %w", err)
+	}
+
+	chatDir := filepath.Join(homeDir, ".chat-cli")
+	if err := os.MkdirAll(chatDir, 0700); err != nil {
+		return "", fmt.Errorf("failed to create directory: %w", err)
+	}
+	if info, err := os.Stat(chatDir); err == nil && info.Mode().Perm()&0077 != 0 {
+		if err := os.Chmod(chatDir, 0700); err != nil {
+			return "", fmt.Errorf("failed to restrict permissions of %s: %w", chatDir, err)
+		}
+	}
+
+	return chatDir, nil
+}
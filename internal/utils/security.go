@@ -1,5 +1,12 @@
 package utils
 
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
 // RedactAPIKey returns a safely redacted version of an API key for logging
 func RedactAPIKey(key string) string {
 	if len(key) < 8 {
@@ -10,3 +17,222 @@ func RedactAPIKey(key string) string {
 	redacted := key[:4] + "..." + key[len(key)-4:]
 	return redacted
 }
+
+// RedactAction is what a Detector does with a match
+type RedactAction string
+
+// Redaction actions
+const (
+	RedactBlock RedactAction = "block" // Refuse to send the text
+	RedactMask  RedactAction = "mask"  // Replace the match with a placeholder
+	RedactWarn  RedactAction = "warn"  // Send as is, but report the match
+	RedactOff   RedactAction = "off"   // Ignore matches
+)
+
+// ParseRedactAction validates an action name
+func ParseRedactAction(name string) (RedactAction, error) {
+	switch action := RedactAction(strings.ToLower(name)); action {
+	case RedactBlock, RedactMask, RedactWarn, RedactOff:
+		return action, nil
+	}
+	return "", fmt.Errorf("invalid redaction action %q (use block, mask, warn or off)", name)
+}
+
+// Detector finds one kind of sensitive data. When the pattern has a group
+// named "secret", only that group is masked.
+type Detector struct {
+	Name    string
+	Pattern *regexp.Regexp
+	Action  RedactAction
+}
+
+// DefaultDetectors returns the built-in detectors. Secrets are masked, email
+// addresses only reported.
+func DefaultDetectors() []Detector {
+	return []Detector{
+		{"private_key", regexp.MustCompile(`-----BEGIN [A-Z ]*PRIVATE KEY-----[\s\S]*?-----END [A-Z ]*PRIVATE KEY-----`), RedactMask},
+		{"aws_access_key", regexp.MustCompile(`\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`), RedactMask},
+		{"aws_secret_key", regexp.MustCompile(`(?i)aws_?secret_?(?:access_?)?key["']?\s*[:=]\s*["']?(?P<secret>[A-Za-z0-9/+=]{40})`), RedactMask},
+		{"jwt", regexp.MustCompile(`\beyJ[A-Za-z0-9_-]{10,}\.eyJ[A-Za-z0-9_-]{10,}\.[A-Za-z0-9_-]{10,}`), RedactMask},
+		{"api_key", regexp.MustCompile(`\b(?:sk-(?:proj-|ant-)?[A-Za-z0-9_-]{20,}|gsk_[A-Za-z0-9]{20,}|AIza[0-9A-Za-z_-]{35}|gh[pousr]_[A-Za-z0-9]{36,}|xox[abprs]-[A-Za-z0-9-]{10,})`), RedactMask},
+		{"secret", regexp.MustCompile(`(?i)\b[\w.-]*(?:api[_-]?key|secret|token|passw(?:or)?d)[\w.-]*["']?\s*[:=]\s*["']?(?P<secret>[^\s"'#\[][^\s"'#]{7,})`), RedactMask},
+		{"email", regexp.MustCompile(`\b[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}\b`), RedactWarn},
+	}
+}
+
+// RedactFinding reports how often a detector matched
+type RedactFinding struct {
+	Detector string
+	Action   RedactAction
+	Count    int
+}
+
+// BlockedError is returned when a detector set to block matches
+type BlockedError struct {
+	Detectors []string
+}
+
+func (e *BlockedError) Error() string {
+	return fmt.Sprintf("input blocked: it contains %s (see \"redaction\" in config.yaml)", strings.Join(e.Detectors, ", "))
+}
+
+// Redactor masks sensitive data with numbered placeholders such as
+// [REDACTED_EMAIL_1] and remembers the originals, so replies that repeat a
+// placeholder can be un-masked locally. The same value always gets the same
+// placeholder.
+type Redactor struct {
+	detectors   []Detector
+	originals   map[string]string // Placeholder to original
+	placeholder map[string]string // Original to placeholder
+	counts      map[string]int    // Placeholders issued per detector
+}
+
+// NewRedactor creates a redactor applying detectors in order
+func NewRedactor(detectors []Detector) *Redactor {
+	return &Redactor{
+		detectors:   detectors,
+		originals:   map[string]string{},
+		placeholder: map[string]string{},
+		counts:      map[string]int{},
+	}
+}
+
+// Redact masks text and reports what each detector found. If a blocking
+// detector matches, it returns a *BlockedError and text should not be sent.
+func (r *Redactor) Redact(text string) (string, []RedactFinding, error) {
+	var findings []RedactFinding
+	var blocked []string
+	for _, d := range r.detectors {
+		if d.Action == RedactOff {
+			continue
+		}
+		matches := d.Pattern.FindAllStringSubmatchIndex(text, -1)
+		if len(matches) == 0 {
+			continue
+		}
+		findings = append(findings, RedactFinding{Detector: d.Name, Action: d.Action, Count: len(matches)})
+		switch d.Action {
+		case RedactBlock:
+			blocked = append(blocked, d.Name)
+		case RedactMask:
+			text = r.mask(text, d, matches)
+		}
+	}
+	if len(blocked) > 0 {
+		return text, findings, &BlockedError{Detectors: blocked}
+	}
+	return text, findings, nil
+}
+
+// mask replaces the matches, or their "secret" groups, from the end backwards
+func (r *Redactor) mask(text string, d Detector, matches [][]int) string {
+	group := d.Pattern.SubexpIndex("secret")
+	for i := len(matches) - 1; i >= 0; i-- {
+		start, end := matches[i][0], matches[i][1]
+		if group > 0 && matches[i][2*group] >= 0 {
+			start, end = matches[i][2*group], matches[i][2*group+1]
+		}
+		text = text[:start] + r.placeholderFor(d.Name, text[start:end]) + text[end:]
+	}
+	return text
+}
+
+func (r *Redactor) placeholderFor(detector, original string) string {
+	if p, ok := r.placeholder[original]; ok {
+		return p
+	}
+	r.counts[detector]++
+	p := fmt.Sprintf("[REDACTED_%s_%d]", placeholderLabel(detector), r.counts[detector])
+	r.placeholder[original] = p
+	r.originals[p] = original
+	return p
+}
+
+// placeholderLabel turns a detector name into the label in its placeholders
+func placeholderLabel(detector string) string {
+	return strings.Map(func(c rune) rune {
+		if c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' {
+			return c
+		}
+		return '_'
+	}, strings.ToUpper(detector))
+}
+
+// Reserve notes the placeholders in text, such as a conversation restored
+// from history, so new ones are numbered after them instead of reusing them
+// for different values
+func (r *Redactor) Reserve(text string) {
+	for _, p := range placeholderPattern.FindAllString(text, -1) {
+		for _, d := range r.detectors {
+			rest, ok := strings.CutPrefix(p, "[REDACTED_"+placeholderLabel(d.Name)+"_")
+			if !ok {
+				continue
+			}
+			if n, err := strconv.Atoi(strings.TrimSuffix(rest, "]")); err == nil && n > r.counts[d.Name] {
+				r.counts[d.Name] = n
+			}
+		}
+	}
+}
+
+// placeholderPattern matches placeholders issued by a Redactor
+var placeholderPattern = regexp.MustCompile(`\[REDACTED_[A-Z0-9_]+_\d+\]`)
+
+// Unmask restores the originals of placeholders this redactor issued
+func (r *Redactor) Unmask(text string) string {
+	if len(r.originals) == 0 {
+		return text
+	}
+	return placeholderPattern.ReplaceAllStringFunc(text, func(p string) string {
+		if original, ok := r.originals[p]; ok {
+			return original
+		}
+		return p
+	})
+}
+
+// StreamUnmasker un-masks a reply as it streams in, holding back text that
+// may be the start of a placeholder split across chunks
+type StreamUnmasker struct {
+	redactor *Redactor
+	pending  string
+}
+
+// Unmasker returns a StreamUnmasker for this redactor
+func (r *Redactor) Unmasker() *StreamUnmasker {
+	return &StreamUnmasker{redactor: r}
+}
+
+// Write adds a chunk and returns the text that is ready to display
+func (u *StreamUnmasker) Write(chunk string) string {
+	text := u.pending + chunk
+	u.pending = ""
+	if i := strings.LastIndex(text, "["); i >= 0 && !strings.Contains(text[i:], "]") && couldBePlaceholder(text[i:]) {
+		text, u.pending = text[:i], text[i:]
+	}
+	return u.redactor.Unmask(text)
+}
+
+// Flush returns any held back text
+func (u *StreamUnmasker) Flush() string {
+	text := u.pending
+	u.pending = ""
+	return u.redactor.Unmask(text)
+}
+
+// couldBePlaceholder reports whether s is a prefix of some placeholder
+func couldBePlaceholder(s string) bool {
+	const prefix = "[REDACTED_"
+	if len(s) <= len(prefix) {
+		return strings.HasPrefix(prefix, s)
+	}
+	if !strings.HasPrefix(s, prefix) || len(s) > 64 {
+		return false
+	}
+	for _, c := range s[len(prefix):] {
+		if !(c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_') {
+			return false
+		}
+	}
+	return true
+}
@@ -2,10 +2,17 @@ package main
 
 import (
 	"fmt"
+	"io"
 	"os"
+	"os/exec"
+	"strings"
+	"time"
 
 	"github.com/valdezdata/chat-cli/internal/cli"
+	"github.com/valdezdata/chat-cli/internal/config"
 	"github.com/valdezdata/chat-cli/internal/history"
+	"github.com/valdezdata/chat-cli/internal/templates"
+	"github.com/valdezdata/chat-cli/internal/utils"
 	"github.com/valdezdata/chat-cli/internal/version"
 
 	"github.com/fatih/color"
@@ -26,21 +33,143 @@ var opts = cli.ChatOptions{
 	LogToConsole: false,
 }
 
+// seed is bound to --seed and only copied into opts when the flag is set
+var seed int
+
+// profile selects a profile from the config file
+var profile string
+
+// systemFile is bound to --system-file
+var systemFile string
+
+// templateVars is bound to --var
+var templateVars []string
+
+// configFile is the config file, loaded before any command runs
+var configFile *config.File
+
+// loadConfig reads the config file and applies its history, redaction and
+// line editor settings
+func loadConfig(cmd *cobra.Command, args []string) error {
+	file, err := config.Load()
+	if err != nil {
+		cmd.SilenceUsage = true
+		return err
+	}
+	retention, err := file.History.Retention()
+	if err != nil {
+		cmd.SilenceUsage = true
+		return fmt.Errorf("invalid config: %w", err)
+	}
+	history.SetRetention(retention)
+	encryption, err := file.History.Encryption(os.Getenv)
+	if err != nil {
+		cmd.SilenceUsage = true
+		return fmt.Errorf("invalid config: %w", err)
+	}
+	history.SetEncryption(encryption)
+	if opts.Redaction, err = file.Redaction.Detectors(); err != nil {
+		cmd.SilenceUsage = true
+		return fmt.Errorf("invalid config: %w", err)
+	}
+	if err := file.Input.Validate(); err != nil {
+		cmd.SilenceUsage = true
+		return fmt.Errorf("invalid config: %w", err)
+	}
+	opts.Input = file.Input
+	configFile = file
+	return nil
+}
+
+// settingFlags maps config keys to the root flags that override them
+var settingFlags = map[string]string{
+	config.KeyProvider:      "provider",
+	config.KeyModel:         "model",
+	config.KeyBaseURL:       "base-url",
+	config.KeyAPIKeyEnv:     "api-key-env",
+	config.KeyTemperature:   "temperature",
+	config.KeyMaxTokens:     "max-tokens",
+	config.KeySystemPrompt:  "system",
+	config.KeyFormat:        "format",
+	config.KeyContextTokens: "context-tokens",
+}
+
+// loadSettings merges the config file, environment and any flags set on cmd.
+// overrides take precedence over everything, like flags.
+func loadSettings(cmd *cobra.Command, overrides map[string]string) (*config.Settings, error) {
+	flags := map[string]string{}
+	for key, name := range settingFlags {
+		if flag := cmd.Flags().Lookup(name); flag != nil && flag.Changed {
+			flags[key] = flag.Value.String()
+		}
+	}
+	for key, value := range overrides {
+		flags[key] = value
+	}
+	return config.Resolve(configFile, profile, flags, os.Getenv)
+}
+
+// systemFileOverride reads --system-file into a system prompt override
+func systemFileOverride(cmd *cobra.Command) (map[string]string, error) {
+	if systemFile == "" {
+		return nil, nil
+	}
+	if cmd.Flags().Changed("system") {
+		return nil, fmt.Errorf("use either --system or --system-file, not both")
+	}
+	data, err := os.ReadFile(systemFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read system prompt: %w", err)
+	}
+	return map[string]string{config.KeySystemPrompt: strings.TrimSpace(string(data))}, nil
+}
+
 var rootCmd = &cobra.Command{
 	Use:   "chat-cli",
 	Short: "A terminal-based chat application for LLMs",
 	Long: `Chat CLI is a terminal-based application for interacting with various 
 Large Language Model (LLM) providers including Ollama, OpenAI, Together AI, 
-Groq, and SambaNova.
+Groq, SambaNova, Gemini and any OpenAI-compatible server.
 
 It supports both interactive chat and shell mode (for use in pipelines),
 with customizable model parameters and output formats.`,
+	PersistentPreRunE: loadConfig,
 
 	Run: func(cmd *cobra.Command, args []string) {
-		// Set shell mode if shell prompt is provided
-		if opts.ShellPrompt != "" {
+		// Set shell mode if shell prompt or template is provided
+		if opts.ShellPrompt != "" || opts.Template != "" {
 			opts.Shell = true
 		}
+		if opts.CodeDir != "" && opts.ExtractCode == "" {
+			opts.ExtractCode = cli.AnyLanguage
+		}
+		if opts.ExtractCode != "" && !opts.Shell {
+			color.Red("Error: --extract-code and --code-dir need shell mode (-s or -T)")
+			os.Exit(1)
+		}
+		vars, err := templates.ParseVars(templateVars)
+		if err != nil {
+			color.Red("Error: %v", err)
+			os.Exit(1)
+		}
+		opts.TemplateVars = vars
+		if cmd.Flags().Changed("seed") {
+			opts.Seed = &seed
+		}
+		overrides, err := systemFileOverride(cmd)
+		if err != nil {
+			color.Red("Error: %v", err)
+			os.Exit(1)
+		}
+		settings, err := loadSettings(cmd, overrides)
+		if err != nil {
+			color.Red("Error loading config: %v", err)
+			os.Exit(1)
+		}
+		if err := opts.ApplySettings(settings); err != nil {
+			color.Red("Error in config: %v", err)
+			os.Exit(1)
+		}
 		cli.Chat(&opts)
 	},
 	Example: `  # Interactive chat with Ollama
@@ -49,12 +178,37 @@ with customizable model parameters and output formats.`,
   # Use OpenAI's
   chat-cli -p openai
 
+  # Use any model ID the provider serves
+  chat-cli -p ollama --model qwen2.5-coder:7b
+
+  # Use a local OpenAI-compatible server (vLLM, LM Studio, llama.cpp, LiteLLM)
+  OPENAI_COMPAT_MODEL=qwen2.5-7b chat-cli -p compat --base-url http://localhost:8000/v1
+
+  # Set the system prompt, inline or from a file
+  chat-cli --system "Answer as a senior Go reviewer"
+  git diff | chat-cli --system-file prompts/reviewer.md -s "Review this diff"
+
+  # Fill a prompt template with piped input and variables
+  git diff | chat-cli -T review --var lang=go
+
+  # Use the "work" profile from ~/.chat-cli/config.yaml
+  chat-cli --profile work
+
   # Analyze code from stdin
   cat main.py | chat-cli -s "Explain this code"
 
   # Generate markdown documentation
   cat *.go | chat-cli -s "Create documentation" -f markdown > docs.md
 
+  # Ask about files, expanding globs and skipping git-ignored ones
+  chat-cli -s "Where is the config file parsed?" -F main.go -F 'internal/**/*.go'
+
+  # Keep only the code from the reply
+  chat-cli -s "Write a Go HTTP health check handler" --extract-code=go > health.go
+
+  # Continue the most recent chat session
+  chat-cli resume last
+
   # Assess and improve your prompts
   chat-cli -a
 
@@ -77,6 +231,529 @@ var historyCmd = &cobra.Command{
 	},
 }
 
+var resumeCmd = &cobra.Command{
+	Use:   "resume <session-id|last>",
+	Short: "Continue a chat session from history",
+	Long: `Continue an interactive chat recorded in history with the same provider,
+model and system prompt. The session ID is shown by "chat-cli history"; a unique
+prefix is enough, and "last" picks the most recent session.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		sessionID, entries, err := history.FindSession(args[0])
+		if err != nil {
+			color.Red("Error: %v", err)
+			return
+		}
+		last := entries[len(entries)-1]
+
+		settings, err := loadSettings(cmd, map[string]string{
+			config.KeyProvider: last.Provider,
+			config.KeyModel:    last.ModelName,
+		})
+		if err != nil {
+			color.Red("Error loading config: %v", err)
+			return
+		}
+		if err := opts.ApplySettings(settings); err != nil {
+			color.Red("Error in config: %v", err)
+			return
+		}
+		opts.SystemPrompt = last.SystemPrompt
+		cli.Resume(&opts, sessionID, entries)
+	},
+}
+
+var tuiCmd = &cobra.Command{
+	Use:   "tui [session-id|last]",
+	Short: "Chat in a full-screen terminal UI",
+	Long: `Chat full screen, with a scrollable transcript, an input box and a status
+bar showing the provider, model, temperature and token counts. Slash commands
+work as in interactive mode. Pass a session ID, or "last", to continue a session
+from history; Ctrl-O lists the sessions to switch to one.`,
+	Example: `  chat-cli tui
+  chat-cli tui -p openai --model gpt-4o
+  chat-cli tui -F README.md
+  chat-cli tui --system-file prompts/reviewer.md
+  chat-cli tui last`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		var sessionID string
+		var entries []history.Entry
+		overrides, err := systemFileOverride(cmd)
+		if err != nil {
+			color.Red("Error: %v", err)
+			return
+		}
+		if len(args) == 1 {
+			sessionID, entries, err = history.FindSession(args[0])
+			if err != nil {
+				color.Red("Error: %v", err)
+				return
+			}
+			last := entries[len(entries)-1]
+			if overrides == nil {
+				overrides = map[string]string{}
+			}
+			overrides[config.KeyProvider] = last.Provider
+			overrides[config.KeyModel] = last.ModelName
+		}
+
+		settings, err := loadSettings(cmd, overrides)
+		if err != nil {
+			color.Red("Error loading config: %v", err)
+			return
+		}
+		if err := opts.ApplySettings(settings); err != nil {
+			color.Red("Error in config: %v", err)
+			return
+		}
+		if len(entries) > 0 {
+			opts.SystemPrompt = entries[len(entries)-1].SystemPrompt
+		}
+		cli.TUI(&opts, sessionID, entries)
+	},
+}
+
+// historyFilter holds the filter flags shared by the history subcommands
+type historyFilter struct {
+	provider, model, session string
+	since, until             string
+	minScore                 int
+}
+
+// addFlags registers the filter flags on cmd
+func (f *historyFilter) addFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&f.provider, "provider", "", "Only entries from this provider")
+	cmd.Flags().StringVar(&f.model, "model", "", "Only entries whose model contains this text")
+	cmd.Flags().StringVar(&f.session, "session", "", "Only entries from this session (ID, prefix or \"last\")")
+	cmd.Flags().StringVar(&f.since, "since", "", "Only entries from this time on (2006-01-02, 7d, yesterday, tuesday, ...)")
+	cmd.Flags().StringVar(&f.until, "until", "", "Only entries before this time (a bare day is included)")
+	cmd.Flags().IntVar(&f.minScore, "min-score", 0, "Only entries with an assessment score of at least this")
+}
+
+// filter builds the history filter, matching query against prompts and responses
+func (f *historyFilter) filter(query string) (history.Filter, error) {
+	now := time.Now()
+	filter := history.Filter{
+		Query:     query,
+		Provider:  f.provider,
+		Model:     f.model,
+		SessionID: f.session,
+		MinScore:  f.minScore,
+	}
+	var err error
+	if f.session == "last" {
+		if filter.SessionID, _, err = history.FindSession("last"); err != nil {
+			return filter, err
+		}
+	}
+	if f.since != "" {
+		if filter.Since, err = history.ParseSince(f.since, now); err != nil {
+			return filter, err
+		}
+	}
+	if f.until != "" {
+		if filter.Until, err = history.ParseUntil(f.until, now); err != nil {
+			return filter, err
+		}
+	}
+	return filter, nil
+}
+
+var searchFilter historyFilter
+
+var historySearchCmd = &cobra.Command{
+	Use:   "search [query]",
+	Short: "Search chat history",
+	Long: `Search prompts and responses. Every word of the query must appear
+(case-insensitive). The query may be empty to list entries by filters alone.`,
+	Example: `  chat-cli history search terraform module --provider groq --since tuesday --until tuesday
+  chat-cli history search --session 3f9c2a
+  chat-cli history search "race condition" --min-score 80`,
+	Run: func(cmd *cobra.Command, args []string) {
+		filter, err := searchFilter.filter(strings.Join(args, " "))
+		if err != nil {
+			color.Red("Error: %v", err)
+			return
+		}
+		entries, err := history.Search(filter)
+		if err != nil {
+			color.Red("Error searching history: %v", err)
+			return
+		}
+		if len(entries) == 0 {
+			fmt.Println("No matching entries")
+			return
+		}
+		count, _ := cmd.Flags().GetInt("count")
+		if count > 0 && count < len(entries) {
+			fmt.Printf("%d matches, showing the last %d (use -n 0 for all)\n\n", len(entries), count)
+			entries = entries[len(entries)-count:]
+		} else {
+			fmt.Printf("%d matches\n\n", len(entries))
+		}
+		history.ShowEntries(entries, filter.Query)
+	},
+}
+
+var historyShowCmd = &cobra.Command{
+	Use:   "show <id>",
+	Short: "Show a history entry in full",
+	Long:  `Show the full prompt, response and metrics of one entry. The ID is shown by "chat-cli history"; a unique prefix is enough.`,
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		entry, err := history.FindEntry(args[0])
+		if err != nil {
+			color.Red("Error: %v", err)
+			return
+		}
+		history.ShowEntry(entry)
+	},
+}
+
+var exportFilter historyFilter
+
+var historyExportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Export chat history",
+	Long: `Export history as Markdown or HTML transcripts grouped by session, or as
+JSONL or CSV records with token and timing columns.`,
+	Example: `  chat-cli history export --format md --session last > chat.md
+  chat-cli history export --format html --since 7d -o week.html
+  chat-cli history export --format csv --provider openai > usage.csv`,
+	Run: func(cmd *cobra.Command, args []string) {
+		format, _ := cmd.Flags().GetString("format")
+		output, _ := cmd.Flags().GetString("output")
+
+		filter, err := exportFilter.filter("")
+		if err != nil {
+			color.Red("Error: %v", err)
+			return
+		}
+		entries, err := history.Search(filter)
+		if err != nil {
+			color.Red("Error reading history: %v", err)
+			return
+		}
+
+		w := os.Stdout
+		if output != "" {
+			f, err := os.OpenFile(output, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+			if err != nil {
+				color.Red("Error creating %s: %v", output, err)
+				return
+			}
+			defer f.Close()
+			w = f
+		}
+		if err := history.Export(w, entries, format); err != nil {
+			color.Red("Error exporting history: %v", err)
+			return
+		}
+		if output != "" {
+			color.Green("Exported %d entries to %s", len(entries), output)
+		}
+	},
+}
+
+var historyImportCmd = &cobra.Command{
+	Use:   "import <file>...",
+	Short: "Import conversations from other tools",
+	Long: `Import conversations into history. Supported formats:
+  openai   Chat completions message arrays, or {"messages": [...]} objects
+  chatgpt  conversations.json from a ChatGPT data export
+  jsonl    One history entry or {"messages": [...]} object per line
+
+Each conversation becomes a session and each user message a turn. Imported
+entries record their source, and importing the same file again skips entries
+already in history. Secrets the redaction detectors find are masked before
+entries are saved, as with prompts; detectors set to block mask instead.`,
+	Example: `  chat-cli history import conversations.json
+  chat-cli history import --format openai messages.json`,
+	Args: cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		format, _ := cmd.Flags().GetString("format")
+		detectors := opts.Redaction
+		if detectors == nil {
+			detectors = utils.DefaultDetectors()
+		}
+		now := time.Now()
+		for _, path := range args {
+			data, err := os.ReadFile(path)
+			if err != nil {
+				color.Red("Error reading %s: %v", path, err)
+				continue
+			}
+			entries, err := history.ParseImport(data, format, path, now)
+			if err != nil {
+				color.Red("Error importing %s: %v", path, err)
+				continue
+			}
+			var masked []string
+			for _, f := range history.RedactEntries(entries, detectors) {
+				if f.Action == utils.RedactMask {
+					masked = append(masked, fmt.Sprintf("%s (%d)", f.Detector, f.Count))
+				}
+			}
+			if len(masked) > 0 {
+				fmt.Fprintln(os.Stderr, color.YellowString("Masked in %s: %s", path, strings.Join(masked, ", ")))
+			}
+			added, err := history.ImportEntries(entries)
+			if err != nil {
+				color.Red("Error saving history: %v", err)
+				return
+			}
+			color.Green("Imported %d entries from %s (%d already in history)", added, path, len(entries)-added)
+		}
+	},
+}
+
+var historyPruneCmd = &cobra.Command{
+	Use:   "prune",
+	Short: "Delete history entries matching filters",
+	Long: `Delete the history entries matching every given filter. At least one filter
+is required; use clear-history to delete everything.`,
+	Example: `  chat-cli history prune --before 2026-01-01
+  chat-cli history prune --before 30d --provider openai --dry-run`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		before, _ := cmd.Flags().GetString("before")
+		dryRun, _ := cmd.Flags().GetBool("dry-run")
+
+		filter := history.Filter{}
+		filter.Provider, _ = cmd.Flags().GetString("provider")
+		filter.Model, _ = cmd.Flags().GetString("model")
+		filter.SessionID, _ = cmd.Flags().GetString("session")
+		if before != "" {
+			until, err := history.ParseSince(before, time.Now())
+			if err != nil {
+				color.Red("Error: %v", err)
+				return
+			}
+			filter.Until = until
+		}
+		if filter == (history.Filter{}) {
+			color.Red("Error: give at least one of --before, --provider, --model or --session")
+			return
+		}
+
+		if dryRun {
+			entries, err := history.Search(filter)
+			if err != nil {
+				color.Red("Error reading history: %v", err)
+				return
+			}
+			fmt.Printf("Would delete %d entries\n", len(entries))
+			return
+		}
+		removed, err := history.Prune(filter)
+		if err != nil {
+			color.Red("Error pruning history: %v", err)
+			return
+		}
+		color.Green("Deleted %d entries", removed)
+	},
+}
+
+var historyDeleteCmd = &cobra.Command{
+	Use:   "delete <id>...",
+	Short: "Delete individual history entries",
+	Long:  `Delete entries by ID, as shown by "chat-cli history" or "history search". A unique prefix is enough.`,
+	Args:  cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		var ids []string
+		for _, ref := range args {
+			entry, err := history.FindEntry(ref)
+			if err != nil {
+				color.Red("Error: %v", err)
+				return
+			}
+			ids = append(ids, entry.ID)
+		}
+		removed, err := history.DeleteEntries(ids...)
+		if err != nil {
+			color.Red("Error deleting history entries: %v", err)
+			return
+		}
+		color.Green("Deleted %d entries", removed)
+	},
+}
+
+var historyEncryptCmd = &cobra.Command{
+	Use:   "encrypt",
+	Short: "Encrypt all stored history",
+	Long: `Rewrite the history file with every entry encrypted. New entries are only
+encrypted when history.encrypt is set in config.yaml, so set that too. The
+secret comes from ` + config.PassphraseEnv + ` or history.key_file.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		count, kept, err := history.Rewrite(true)
+		if err != nil {
+			color.Red("Error encrypting history: %v", err)
+			return
+		}
+		color.Green("Encrypted %d entries", count)
+		if kept > 0 {
+			color.Yellow("Kept %d unreadable lines as they were", kept)
+		}
+	},
+}
+
+var historyDecryptCmd = &cobra.Command{
+	Use:   "decrypt",
+	Short: "Decrypt all stored history",
+	Long:  `Rewrite the history file in plain text, for example before turning history.encrypt off.`,
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		count, kept, err := history.Rewrite(false)
+		if err != nil {
+			color.Red("Error decrypting history: %v", err)
+			return
+		}
+		color.Green("Decrypted %d entries", count)
+		if kept > 0 {
+			color.Yellow("Kept %d unreadable lines as they were", kept)
+		}
+	},
+}
+
+var statsFilter historyFilter
+
+var statsCmd = &cobra.Command{
+	Use:   "stats",
+	Short: "Show usage and cost statistics",
+	Long: `Aggregate history by provider, model, day, week or session: turns, token
+counts, average latency, output tokens per second (median and 90th percentile),
+average assessment score and its trend, and estimated spend.
+
+Spend is estimated from a per-model price table in US dollars per million
+tokens. Override or extend the built-in prices in ~/.chat-cli/config.yaml:
+
+  prices:
+    gpt-4o: {input: 2.50, output: 10.00}
+    compat/my-local-model: {input: 0, output: 0}
+
+Keys are "provider/model", a model ID or a provider name.`,
+	Example: `  chat-cli stats --by week --since 8w
+  chat-cli stats --by model --provider openai`,
+	Run: func(cmd *cobra.Command, args []string) {
+		by, _ := cmd.Flags().GetString("by")
+
+		filter, err := statsFilter.filter("")
+		if err != nil {
+			color.Red("Error: %v", err)
+			return
+		}
+		entries, err := history.Search(filter)
+		if err != nil {
+			color.Red("Error reading history: %v", err)
+			return
+		}
+		if len(entries) == 0 {
+			fmt.Println("No history entries match.")
+			return
+		}
+
+		stats, total, err := history.ComputeStats(entries, by, configFile.PriceTable().Cost)
+		if err != nil {
+			color.Red("Error: %v", err)
+			return
+		}
+		history.ShowStats(os.Stdout, stats, total, by)
+	},
+}
+
+var templatesCmd = &cobra.Command{
+	Use:   "templates",
+	Short: "Manage prompt templates",
+	Long: `Prompt templates are text/template files in ~/.chat-cli/templates named
+<name>.tmpl. Variables are set with --var key=value, piped input is {{.input}}
+and a -s prompt is {{.prompt}}. The functions upper, lower, trim and default
+are available, e.g. {{default "go" .lang}}. A leading {{/* comment */}} is
+shown as the description.
+
+Use a template with "chat-cli -T <name>" or "/template <name>" in a chat.`,
+}
+
+var templatesListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List prompt templates",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		list, err := templates.List()
+		if err != nil {
+			color.Red("Error: %v", err)
+			return
+		}
+		if len(list) == 0 {
+			dir, _ := templates.Dir()
+			fmt.Printf("No templates in %s; create one with \"chat-cli templates new <name>\"\n", dir)
+			return
+		}
+		for _, t := range list {
+			fmt.Printf("%-20s %s\n", t.Name, t.Description)
+		}
+	},
+}
+
+var templatesShowCmd = &cobra.Command{
+	Use:   "show <name>",
+	Short: "Show a prompt template and its variables",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		t, err := templates.Load(args[0])
+		if err != nil {
+			color.Red("Error: %v", err)
+			return
+		}
+		fmt.Printf("Template: %s (%s)\n", t.Name, t.Path)
+		if vars := t.Variables(); len(vars) > 0 {
+			fmt.Printf("Variables: %s\n", strings.Join(vars, ", "))
+		}
+		fmt.Println()
+		fmt.Println(strings.TrimRight(t.Text, "\n"))
+	},
+}
+
+var templatesNewCmd = &cobra.Command{
+	Use:   "new <name>",
+	Short: "Create a prompt template",
+	Long: `Create a template from piped text, or from a starting skeleton that is
+opened in $EDITOR when it is set.`,
+	Example: `  chat-cli templates new review
+  echo 'Review this {{.lang}} diff for security issues:
+
+{{.input}}' | chat-cli templates new review`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		text := templates.Skeleton
+		piped := false
+		if info, err := os.Stdin.Stat(); err == nil && info.Mode()&os.ModeCharDevice == 0 {
+			data, err := io.ReadAll(os.Stdin)
+			if err != nil {
+				color.Red("Error reading stdin: %v", err)
+				return
+			}
+			text, piped = string(data), true
+		}
+
+		t, err := templates.Create(args[0], text)
+		if err != nil {
+			color.Red("Error: %v", err)
+			return
+		}
+		color.Green("Created template %s at %s", t.Name, t.Path)
+
+		if editor := os.Getenv("EDITOR"); editor != "" && !piped {
+			edit := exec.Command(editor, t.Path)
+			edit.Stdin, edit.Stdout, edit.Stderr = os.Stdin, os.Stdout, os.Stderr
+			if err := edit.Run(); err != nil {
+				color.Red("Error running %s: %v", editor, err)
+			}
+		}
+	},
+}
+
 var clearHistoryCmd = &cobra.Command{
 	Use:   "clear-history",
 	Short: "Clear chat history",
@@ -90,6 +767,47 @@ var clearHistoryCmd = &cobra.Command{
 	},
 }
 
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Inspect configuration",
+	Long:  `Inspect the settings loaded from ~/.chat-cli/config.yaml and the environment.`,
+}
+
+var configShowCmd = &cobra.Command{
+	Use:   "show",
+	Short: "Show effective settings",
+	Long:  `Show the effective settings and whether each comes from a flag, an environment variable, the profile or a default.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		settings, err := loadSettings(cmd, nil)
+		if err != nil {
+			color.Red("Error loading config: %v", err)
+			return
+		}
+		filePath, _ := config.GetConfigFilePath()
+		config.ShowSettings(os.Stdout, settings, filePath, os.Getenv)
+	},
+}
+
+var modelsCmd = &cobra.Command{
+	Use:   "models",
+	Short: "List models available from a provider",
+	Long:  `List the models a provider offers, queried live from its API. The model chat-cli would use is marked with *.`,
+	Example: `  chat-cli models -p ollama
+  chat-cli models -p compat --base-url http://localhost:1234/v1`,
+	Run: func(cmd *cobra.Command, args []string) {
+		settings, err := loadSettings(cmd, nil)
+		if err != nil {
+			color.Red("Error loading config: %v", err)
+			return
+		}
+		if err := opts.ApplySettings(settings); err != nil {
+			color.Red("Error in config: %v", err)
+			return
+		}
+		cli.ListModels(&opts)
+	},
+}
+
 var versionCmd = &cobra.Command{
 	Use:   "version",
 	Short: "Show version information",
@@ -99,17 +817,37 @@ var versionCmd = &cobra.Command{
 }
 
 func init() {
+	// Profile selection applies to chat and to config show
+	rootCmd.PersistentFlags().StringVar(&profile, "profile", "", "Config profile to use (default: default_profile from config.yaml)")
+
 	// Basic flags
 	rootCmd.Flags().BoolVarP(&opts.Verbose, "verbose", "v", false, "Enable verbose output with metrics")
-	rootCmd.Flags().VarP((*cli.ProviderFlag)(&opts.Provider), "provider", "p", "LLM provider to use (ollama, openai, together, groq, samba)")
+	rootCmd.Flags().VarP((*cli.ProviderFlag)(&opts.Provider), "provider", "p", "LLM provider to use (ollama, openai, together, groq, samba, gemini, compat)")
+	rootCmd.Flags().StringVar(&opts.Model, "model", "", "Model ID or alias (e.g. gpt-4o-mini, llama3.1:8b); see \"chat-cli models\"")
+	rootCmd.Flags().StringVar(&opts.BaseURL, "base-url", "", "API base URL (required for -p compat)")
+	rootCmd.Flags().StringVar(&opts.APIKeyEnv, "api-key-env", "", "Environment variable holding the API key for -p compat")
+	rootCmd.Flags().StringVar(&opts.SystemPrompt, "system", "", "System prompt for the session")
+	rootCmd.Flags().StringVar(&systemFile, "system-file", "", "Read the system prompt from a file")
 	rootCmd.Flags().BoolVarP(&opts.Assess, "assess", "a", false, "Assess prompt quality and structure")
 	rootCmd.Flags().StringVarP(&opts.ShellPrompt, "shell", "s", "", "Shell mode with specified prompt (read from stdin)")
+	rootCmd.Flags().StringVarP(&opts.Template, "template", "T", "", "Shell mode with a prompt template from ~/.chat-cli/templates")
+	rootCmd.Flags().StringArrayVar(&templateVars, "var", nil, "Template variable as key=value (repeatable)")
 	rootCmd.Flags().BoolVarP(&opts.LogToConsole, "log", "l", false, "Show logs in console")
+	rootCmd.Flags().BoolVarP(&opts.Quiet, "quiet", "q", false, "Shell mode: print only the response text")
+	rootCmd.Flags().Var((*cli.RenderFlag)(&opts.Render), "render", "Reply rendering: markdown or none (default: markdown when stdout is a terminal)")
+	rootCmd.Flags().StringVar(&opts.ExtractCode, "extract-code", "", "Shell mode: print only the fenced code blocks of the reply, or only those in `lang`")
+	rootCmd.Flags().Lookup("extract-code").NoOptDefVal = cli.AnyLanguage
+	rootCmd.Flags().StringVar(&opts.CodeDir, "code-dir", "", "Shell mode: write the extracted code blocks to files in this directory")
+	rootCmd.Flags().StringArrayVarP(&opts.Files, "file", "F", nil, "Attach a file, directory or glob such as 'src/**/*.go' to the prompt (repeatable)")
 
 	// Model parameter flags
 	rootCmd.Flags().Float64VarP(&opts.Temperature, "temperature", "t", 0.7, "Temperature for response generation (0.0-1.0)")
 	rootCmd.Flags().IntVarP(&opts.MaxTokens, "max-tokens", "m", 4000, "Maximum number of tokens in response")
+	rootCmd.Flags().Float64Var(&opts.TopP, "top-p", 0, "Nucleus sampling probability (0.0-1.0, 0 uses the provider default)")
+	rootCmd.Flags().StringArrayVar(&opts.Stop, "stop", nil, "Stop sequence, taken verbatim (repeatable)")
+	rootCmd.Flags().IntVar(&seed, "seed", 0, "Seed for reproducible sampling (where supported)")
 	rootCmd.Flags().StringVarP(&opts.OutputFormat, "format", "f", "text", "Output format (text, json, markdown)")
+	rootCmd.Flags().IntVar(&opts.ContextTokens, "context-tokens", 0, "Context window attached files must fit in (0 uses a provider default)")
 
 	// Logging flags - Added
 	rootCmd.Flags().StringVar(&opts.LogLevel, "log-level", "info", "Log level (debug, info, warn, error)")
@@ -117,17 +855,78 @@ func init() {
 	rootCmd.Flags().BoolVar(&opts.SkipHistory, "no-history", false, "Don't save this interaction to history")
 
 	// Group flags for better organization
-	markFlagGroup(rootCmd, "Basic Options", []string{"verbose", "provider", "assess", "shell"})
-	markFlagGroup(rootCmd, "Model Parameters", []string{"temperature", "max-tokens", "format"})
+	markFlagGroup(rootCmd, "Basic Options", []string{"verbose", "provider", "model", "base-url", "api-key-env", "system", "system-file", "assess", "shell", "template", "var", "quiet", "render", "extract-code", "code-dir", "file"})
+	markFlagGroup(rootCmd, "Model Parameters", []string{"temperature", "max-tokens", "top-p", "stop", "seed", "format", "context-tokens"})
 	markFlagGroup(rootCmd, "Logging Options", []string{"log-level", "log-file"})
 
 	// Add history command
 	historyCmd.Flags().IntP("count", "n", 10, "Number of history entries to show")
+	historySearchCmd.Flags().IntP("count", "n", 20, "Maximum number of matches to show (0 for all)")
+	searchFilter.addFlags(historySearchCmd)
+	historyCmd.AddCommand(historySearchCmd)
+	historyCmd.AddCommand(historyShowCmd)
+	historyExportCmd.Flags().StringP("format", "f", "md", "Export format ("+strings.Join(history.ExportFormats, ", ")+")")
+	historyExportCmd.Flags().StringP("output", "o", "", "Write to this file instead of stdout")
+	exportFilter.addFlags(historyExportCmd)
+	historyCmd.AddCommand(historyExportCmd)
+	historyImportCmd.Flags().String("format", "auto", "Import format ("+strings.Join(history.ImportFormats, ", ")+")")
+	historyCmd.AddCommand(historyImportCmd)
+	historyPruneCmd.Flags().String("before", "", "Only entries before this time (2006-01-02, 30d, yesterday, ...)")
+	historyPruneCmd.Flags().String("provider", "", "Only entries from this provider")
+	historyPruneCmd.Flags().String("model", "", "Only entries whose model contains this text")
+	historyPruneCmd.Flags().String("session", "", "Only entries from this session (ID or prefix)")
+	historyPruneCmd.Flags().Bool("dry-run", false, "Show how many entries would be deleted")
+	historyCmd.AddCommand(historyPruneCmd)
+	historyCmd.AddCommand(historyDeleteCmd)
+	historyCmd.AddCommand(historyEncryptCmd)
+	historyCmd.AddCommand(historyDecryptCmd)
 	rootCmd.AddCommand(historyCmd)
 
+	statsCmd.Flags().String("by", "model", "Group by ("+strings.Join(history.StatsGroups, ", ")+")")
+	statsFilter.addFlags(statsCmd)
+	rootCmd.AddCommand(statsCmd)
+
+	templatesCmd.AddCommand(templatesListCmd)
+	templatesCmd.AddCommand(templatesShowCmd)
+	templatesCmd.AddCommand(templatesNewCmd)
+	rootCmd.AddCommand(templatesCmd)
+
+	// Add resume command
+	resumeCmd.Flags().BoolVarP(&opts.Verbose, "verbose", "v", false, "Enable verbose output with metrics")
+	resumeCmd.Flags().Var((*cli.RenderFlag)(&opts.Render), "render", "Reply rendering: markdown or none (default: markdown when stdout is a terminal)")
+	rootCmd.AddCommand(resumeCmd)
+
+	// Add tui command
+	tuiCmd.Flags().VarP((*cli.ProviderFlag)(&opts.Provider), "provider", "p", "LLM provider to use (ollama, openai, together, groq, samba, gemini, compat)")
+	tuiCmd.Flags().StringVar(&opts.Model, "model", "", "Model ID or alias (e.g. gpt-4o-mini, llama3.1:8b); see \"chat-cli models\"")
+	tuiCmd.Flags().StringVar(&opts.BaseURL, "base-url", "", "API base URL (required for -p compat)")
+	tuiCmd.Flags().StringVar(&opts.APIKeyEnv, "api-key-env", "", "Environment variable holding the API key for -p compat")
+	tuiCmd.Flags().StringVar(&opts.SystemPrompt, "system", "", "System prompt for the session")
+	tuiCmd.Flags().StringVar(&systemFile, "system-file", "", "Read the system prompt from a file")
+	tuiCmd.Flags().BoolVarP(&opts.Assess, "assess", "a", false, "Assess prompt quality and structure")
+	tuiCmd.Flags().Float64VarP(&opts.Temperature, "temperature", "t", 0.7, "Temperature for response generation (0.0-1.0)")
+	tuiCmd.Flags().IntVarP(&opts.MaxTokens, "max-tokens", "m", 4000, "Maximum number of tokens in response")
+	tuiCmd.Flags().IntVar(&opts.ContextTokens, "context-tokens", 0, "Context window attached files must fit in (0 uses a provider default)")
+	tuiCmd.Flags().StringArrayVarP(&opts.Files, "file", "F", nil, "Attach a file, directory or glob to the first prompt (repeatable)")
+	tuiCmd.Flags().Var((*cli.RenderFlag)(&opts.Render), "render", "Reply rendering: markdown or none (default: markdown)")
+	tuiCmd.Flags().StringVar(&opts.LogLevel, "log-level", "info", "Log level (debug, info, warn, error)")
+	tuiCmd.Flags().BoolVar(&opts.LogToFile, "log-file", false, "Write logs to file")
+	tuiCmd.Flags().BoolVar(&opts.SkipHistory, "no-history", false, "Don't save this session to history")
+	rootCmd.AddCommand(tuiCmd)
+
 	// Add clear-history command
 	rootCmd.AddCommand(clearHistoryCmd)
 
+	// Add config command
+	configCmd.AddCommand(configShowCmd)
+	rootCmd.AddCommand(configCmd)
+
+	// Add models command
+	modelsCmd.Flags().VarP((*cli.ProviderFlag)(&opts.Provider), "provider", "p", "LLM provider to query")
+	modelsCmd.Flags().StringVar(&opts.BaseURL, "base-url", "", "API base URL (required for -p compat)")
+	modelsCmd.Flags().StringVar(&opts.APIKeyEnv, "api-key-env", "", "Environment variable holding the API key for -p compat")
+	rootCmd.AddCommand(modelsCmd)
+
 	// Add version command
 	rootCmd.AddCommand(versionCmd)
 
@@ -169,19 +968,31 @@ Additional help topics:{{range .Commands}}{{if .IsAdditionalHelpTopicCommand}}
 
 Use "{{.CommandPath}} [command] --help" for more information about a command.{{end}}
 
+Configuration:
+  Profiles are read from ~/.chat-cli/config.yaml. Settings are resolved as
+  flag > environment variable > profile > default; see "chat-cli config show".
+
 Environment Variables:
+  CHAT_CLI_*        Generic settings (PROVIDER, MODEL, BASE_URL, API_KEY_ENV,
+                    TEMPERATURE, MAX_TOKENS, SYSTEM_PROMPT, FORMAT)
+  CHAT_CLI_HISTORY_PASSPHRASE  Passphrase for encrypted history
   OLLAMA_URL        URL of your Ollama server (default: http://localhost:11434)
-  OLLAMA_MODEL      Model to use with Ollama (options: mistral, llama, deepseek)
+  *_MODEL           Model ID for the provider; aliases below are optional shorthands
+  OLLAMA_MODEL      Model to use with Ollama (aliases: mistral, llama, deepseek)
+  *_BASE_URL        Override the API base URL (OPENAI, TOGETHER, GROQ, SAMBA, GEMINI)
   TOGETHER_API_KEY  API key for Together AI
-  TOGETHER_MODEL    Model to use with Together (options: llama-70b, deepseek)
+  TOGETHER_MODEL    Model to use with Together (aliases: llama-70b, deepseek)
   GROQ_API_KEY      API key for Groq
-  GROQ_MODEL        Model to use with Groq (options: gemma)
+  GROQ_MODEL        Model to use with Groq (aliases: gemma)
   SAMBA_API_KEY     API key for SambaNova
-  SAMBA_MODEL       Model to use with SambaNova (options: llama-70b)
+  SAMBA_MODEL       Model to use with SambaNova (aliases: llama-70b)
   OPENAI_API_KEY    API key for OpenAI
-  OPENAI_MODEL      Model to use with OpenAI (options: gpt-4.1-nano)
+  OPENAI_MODEL      Model to use with OpenAI (aliases: gpt-4.1-nano)
   GEMINI_API_KEY    API key for Google Gemini
-  GEMINI_MODEL      Model to use with Gemini (options: gemini-pro, gemini-flash, gemini-flash-lite)
+  GEMINI_MODEL      Model to use with Gemini (aliases: gemini-pro, gemini-flash, gemini-flash-lite)
+  OPENAI_COMPAT_BASE_URL  Base URL for -p compat (e.g. http://localhost:8000/v1)
+  OPENAI_COMPAT_MODEL     Model ID for -p compat
+  OPENAI_COMPAT_API_KEY   API key for -p compat (optional; see --api-key-env)
 `
 
 func main() {
@@ -0,0 +1,213 @@
+package tests
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/valdezdata/chat-cli/internal/attach"
+	"github.com/valdezdata/chat-cli/internal/cli"
+)
+
+// writeTree creates files under dir, with paths relative to it
+func writeTree(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// chdir changes to dir for the rest of the test
+func chdir(t *testing.T, dir string) {
+	t.Helper()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+}
+
+func TestCollectFiles(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{
+		".git/HEAD":              "ref: refs/heads/main\n",
+		".gitignore":             "*.log\nbuild/\n!keep.log\n",
+		"main.go":                "package main\n",
+		"README.md":              "# Demo\n",
+		"app.log":                "noise\n",
+		"keep.log":               "kept\n",
+		"logo.png":               "\x89PNG\r\n\x1a\n\x00\x00",
+		"build/out.go":           "package out\n",
+		"internal/a/a.go":        "package a\n",
+		"internal/a/b/b.go":      "package b\n",
+		"internal/a/.gitignore":  "gen_*.go\n",
+		"internal/a/gen_x.go":    "package a\n",
+		"internal/a/notes.txt":   "notes\n",
+		"internal/a/b/b_test.go": "package b\n",
+	})
+	chdir(t, dir)
+
+	paths := func(files []attach.File) []string {
+		var got []string
+		for _, f := range files {
+			got = append(got, filepath.ToSlash(f.Path))
+		}
+		return got
+	}
+
+	tests := []struct {
+		name     string
+		patterns []string
+		want     []string
+		skipped  []string
+	}{
+		{"path", []string{"main.go"}, []string{"main.go"}, nil},
+		{"glob", []string{"*.go", "*.md"}, []string{"main.go", "README.md"}, nil},
+		{"double star", []string{"internal/**/*.go"}, []string{"internal/a/a.go", "internal/a/b/b.go", "internal/a/b/b_test.go"}, []string{"internal/a/gen_x.go"}},
+		{"directory", []string{"internal/a/b"}, []string{"internal/a/b/b.go", "internal/a/b/b_test.go"}, nil},
+		{"gitignore", []string{"*.log"}, []string{"keep.log"}, []string{"app.log"}},
+		{"binary", []string{"logo.png"}, nil, []string{"logo.png"}},
+		{"duplicates", []string{"main.go", "*.go", "./main.go"}, []string{"main.go"}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			files, skipped, err := attach.Collect(tt.patterns)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := paths(files); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("files = %q, want %q", got, tt.want)
+			}
+			var gotSkipped []string
+			for _, s := range skipped {
+				gotSkipped = append(gotSkipped, filepath.ToSlash(s.Path))
+			}
+			if !reflect.DeepEqual(gotSkipped, tt.skipped) {
+				t.Errorf("skipped = %q, want %q", gotSkipped, tt.skipped)
+			}
+		})
+	}
+
+	// Walking the whole tree leaves out .git and ignored directories
+	files, _, err := attach.Collect([]string{"."})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range paths(files) {
+		if strings.HasPrefix(p, ".git/") || strings.HasPrefix(p, "build/") {
+			t.Errorf("Collect(.) included %s", p)
+		}
+	}
+
+	if _, _, err := attach.Collect([]string{"*.rs"}); err == nil || !strings.Contains(err.Error(), "no files match") {
+		t.Errorf("Collect(*.rs) error = %v, want no files match", err)
+	}
+}
+
+func TestFormatAndFitFiles(t *testing.T) {
+	files := []attach.File{
+		{Path: "main.go", Content: "package main\n"},
+		{Path: "README.md", Content: "Run:\n\n```sh\ngo run .\n```\n"},
+		{Path: "notes", Content: "plain\n"},
+	}
+	want := "File: main.go\n```go\npackage main\n```\n\n" +
+		"File: README.md\n````markdown\nRun:\n\n```sh\ngo run .\n```\n````\n\n" +
+		"File: notes\n```\nplain\n```"
+	if got := attach.Format(files); got != want {
+		t.Errorf("Format = %q, want %q", got, want)
+	}
+
+	// Count characters so the budget is exact
+	count := func(s string) int { return len(s) }
+	kept, dropped := attach.Fit(files, 1000, count)
+	if !reflect.DeepEqual(kept, files) || dropped != nil {
+		t.Errorf("Fit with room for all = %v, %v", kept, dropped)
+	}
+
+	long := attach.File{Path: "log.txt", Content: "one\ntwo\nthree\nfour\n"}
+	budget := len(attach.Format([]attach.File{{Path: "log.txt", Content: "one\ntwo\n", Truncated: true}}))
+	kept, dropped = attach.Fit([]attach.File{long, files[0]}, budget, count)
+	if len(kept) != 1 || kept[0].Content != "one\ntwo\n" || !kept[0].Truncated {
+		t.Errorf("Fit kept %+v, want log.txt cut to two lines", kept)
+	}
+	if !reflect.DeepEqual(dropped, []string{"main.go"}) {
+		t.Errorf("Fit dropped %q, want main.go", dropped)
+	}
+	if !strings.HasPrefix(attach.Format(kept), "File: log.txt (truncated)\n") {
+		t.Errorf("Format does not mark the truncated file: %q", attach.Format(kept))
+	}
+
+	kept, dropped = attach.Fit([]attach.File{long}, 5, count)
+	if kept != nil || !reflect.DeepEqual(dropped, []string{"log.txt"}) {
+		t.Errorf("Fit with no room = %v, %q", kept, dropped)
+	}
+}
+
+func TestAttachFiles(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{
+		"main.go":  "package main\n",
+		"util.py":  "print(1)\n",
+		"data.bin": "\x00\x01\x02",
+	})
+	chdir(t, dir)
+	srv, bodies := recordServer(t)
+	opts := func() *cli.ChatOptions {
+		return &cli.ChatOptions{
+			Provider:     cli.ProviderCompat,
+			BaseURL:      srv.URL,
+			Model:        "test-model",
+			OutputFormat: "text",
+			SkipHistory:  true,
+			LogLevel:     "error",
+			Render:       cli.RenderNone,
+		}
+	}
+
+	shell := opts()
+	shell.Shell = true
+	shell.ShellPrompt = "Explain"
+	shell.Files = []string{"*.go", "data.bin"}
+	withStdin(t, "", func() {
+		captureStdout(t, func() { cli.Chat(shell) })
+	})
+
+	// Files added with /add go with the next prompt only
+	var out string
+	withStdin(t, "/add util.py main.go\n/add\nReview\nAgain\n/exit\n", func() {
+		out = captureStdout(t, func() { cli.Chat(opts()) })
+	})
+	for _, text := range []string{"Attached util.py", "Attached main.go", "2 files, about", "main.go (1 line,"} {
+		if !strings.Contains(out, text) {
+			t.Errorf("output is missing %q:\n%s", text, out)
+		}
+	}
+
+	got := bodies()
+	if len(got) != 3 {
+		t.Fatalf("got %d requests, want 3", len(got))
+	}
+	assertMessages(t, got[0], "system:Provide helpful and concise responses", "user:Explain\n\nFile: main.go\n```go\npackage main\n```")
+	lastUser := func(body map[string]interface{}) string {
+		messages := body["messages"].([]interface{})
+		return messages[len(messages)-1].(map[string]interface{})["content"].(string)
+	}
+	if want := "Review\n\nFile: util.py\n```python\nprint(1)\n```\n\nFile: main.go\n```go\npackage main\n```"; lastUser(got[1]) != want {
+		t.Errorf("first prompt = %q, want %q", lastUser(got[1]), want)
+	}
+	if lastUser(got[2]) != "Again" {
+		t.Errorf("second prompt = %q, want the files left out", lastUser(got[2]))
+	}
+}
@@ -48,7 +48,7 @@ func TestCreateChatClient(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			// Add logger parameter here
-			client, err := cli.CreateChatClient(tt.provider, logger)
+			client, err := cli.CreateChatClient(tt.provider, providers.Config{}, logger)
 			if tt.expectError {
 				if err == nil {
 					t.Errorf("CreateChatClient(%q) expected error, got nil", tt.provider)
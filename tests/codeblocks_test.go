@@ -0,0 +1,144 @@
+package tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/valdezdata/chat-cli/internal/cli"
+)
+
+const codeReply = "Here you go:\n\n```go main.go\npackage main\n\nfunc main() {}\n```\n\nAnd a test:\n\n```sh\ngo test ./...\n```\n\n```python\nprint(\"hi\")\n```"
+
+// replyServer streams reply to every chat request
+func replyServer(t *testing.T, reply string) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		content, _ := json.Marshal(reply)
+		fmt.Fprintf(w, "data: {\"choices\":[{\"index\":0,\"delta\":{\"content\":%s}}]}\n\n", content)
+		io.WriteString(w, "data: [DONE]\n\n")
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestShellModeExtractCode(t *testing.T) {
+	srv := replyServer(t, codeReply)
+	run := func(lang, dir string) string {
+		return captureStdout(t, func() {
+			cli.Chat(&cli.ChatOptions{
+				Provider:     cli.ProviderCompat,
+				BaseURL:      srv.URL,
+				Model:        "test-model",
+				Shell:        true,
+				ShellPrompt:  "Write a program",
+				OutputFormat: "text",
+				SkipHistory:  true,
+				LogLevel:     "error",
+				ExtractCode:  lang,
+				CodeDir:      dir,
+			})
+		})
+	}
+
+	tests := []struct {
+		lang, want string
+	}{
+		{cli.AnyLanguage, "package main\n\nfunc main() {}\n\ngo test ./...\n\nprint(\"hi\")\n"},
+		{"go", "package main\n\nfunc main() {}\n"},
+		{"bash", "go test ./...\n"}, // Matches the sh block
+		{"py", "print(\"hi\")\n"},
+	}
+	for _, tt := range tests {
+		if got := run(tt.lang, ""); got != tt.want {
+			t.Errorf("--extract-code=%s printed %q, want %q", tt.lang, got, tt.want)
+		}
+	}
+	if got := run("rust", ""); strings.Contains(got, "package main") || !strings.Contains(got, "no rust code blocks") {
+		t.Errorf("--extract-code=rust printed %q, want an error", got)
+	}
+
+	dir := t.TempDir()
+	run(cli.AnyLanguage, dir)
+	for name, want := range map[string]string{
+		"main.go":   "package main\n\nfunc main() {}\n",
+		"code-2.sh": "go test ./...\n",
+		"code-3.py": "print(\"hi\")\n",
+	} {
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil || string(data) != want {
+			t.Errorf("%s = %q, %v; want %q", name, data, err, want)
+		}
+	}
+}
+
+func TestInteractiveSaveCodeAndApply(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	srv, _ := recordServer(t)
+	dir := t.TempDir()
+	saved := filepath.Join(dir, "chat.json")
+	transcript, _ := json.Marshal(map[string]interface{}{
+		"messages": []map[string]string{
+			{"role": "user", "content": "Write a program"},
+			{"role": "assistant", "content": codeReply},
+		},
+	})
+	if err := os.WriteFile(saved, transcript, 0600); err != nil {
+		t.Fatal(err)
+	}
+	existing := filepath.Join(dir, "main.go")
+	if err := os.WriteFile(existing, []byte("package old\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	declined := filepath.Join(dir, "declined.sh")
+
+	input := strings.Join([]string{
+		"/load " + saved,
+		"/save-code",
+		"/save-code 3 " + filepath.Join(dir, "hi.py"),
+		"/apply " + existing, // The block that names main.go
+		"y",
+		"/apply 2 " + declined,
+		"n",
+		"/exit",
+	}, "\n") + "\n"
+
+	var out string
+	withStdin(t, input, func() {
+		out = captureStdout(t, func() {
+			cli.Chat(&cli.ChatOptions{
+				Provider:     cli.ProviderCompat,
+				BaseURL:      srv.URL,
+				Model:        "test-model",
+				OutputFormat: "text",
+				LogLevel:     "error",
+				Render:       cli.RenderNone,
+			})
+		})
+	})
+
+	for _, text := range []string{"1. go, 3 lines: package main", "2. sh, 1 line: go test", "-package old", "+package main"} {
+		if !strings.Contains(out, text) {
+			t.Errorf("output is missing %q:\n%s", text, out)
+		}
+	}
+	for path, want := range map[string]string{
+		filepath.Join(dir, "hi.py"): "print(\"hi\")\n",
+		existing:                    "package main\n\nfunc main() {}\n",
+	} {
+		data, err := os.ReadFile(path)
+		if err != nil || string(data) != want {
+			t.Errorf("%s = %q, %v; want %q", path, data, err, want)
+		}
+	}
+	if _, err := os.Stat(declined); !os.IsNotExist(err) {
+		t.Errorf("/apply wrote %s although it was declined", declined)
+	}
+}
@@ -0,0 +1,264 @@
+package tests
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/valdezdata/chat-cli/internal/cli"
+	"github.com/valdezdata/chat-cli/internal/history"
+)
+
+func TestCompleteCommand(t *testing.T) {
+	tests := []struct {
+		line string
+		want []string
+	}{
+		{"/mo", []string{"/model "}},
+		{"/q", []string{"/quit "}},
+		{"/provider g", []string{"/provider gemini", "/provider groq"}},
+		{"/assess o", []string{"/assess off", "/assess on"}},
+		{"/help re", []string{"/help reset", "/help retry"}},
+		{"/nothing ", nil},
+		{"hello", nil},
+	}
+	for _, tt := range tests {
+		if got := cli.CompleteCommand(tt.line); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("CompleteCommand(%q) = %q, want %q", tt.line, got, tt.want)
+		}
+	}
+}
+
+// recordServer answers every chat request with openAIStream and records
+// the request bodies
+func recordServer(t *testing.T) (*httptest.Server, func() []map[string]interface{}) {
+	t.Helper()
+	var mu sync.Mutex
+	var bodies []map[string]interface{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		body := map[string]interface{}{}
+		if err := json.Unmarshal(data, &body); err != nil {
+			t.Errorf("decoding request body %q: %v", data, err)
+		}
+		mu.Lock()
+		bodies = append(bodies, body)
+		mu.Unlock()
+		openAIStream(w)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, func() []map[string]interface{} {
+		mu.Lock()
+		defer mu.Unlock()
+		return bodies
+	}
+}
+
+// withStdin runs fn with os.Stdin reading input
+func withStdin(t *testing.T, input string, fn func()) {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.WriteString(input); err != nil {
+		t.Fatal(err)
+	}
+	w.Close()
+
+	stdin := os.Stdin
+	os.Stdin = r
+	defer func() {
+		os.Stdin = stdin
+		r.Close()
+	}()
+	fn()
+}
+
+func TestInteractiveCommands(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	srv, bodies := recordServer(t)
+	saved := filepath.Join(t.TempDir(), "chat.json")
+
+	input := strings.Join([]string{
+		"/temp 0.5",
+		"exit", // A prompt now, not a command
+		"/undo",
+		"/system Be terse",
+		"second",
+		"/retry",
+		"/unknown",
+		"/save " + saved,
+		"/exit",
+		"never sent",
+	}, "\n") + "\n"
+
+	withStdin(t, input, func() {
+		cli.Chat(&cli.ChatOptions{
+			Provider:     cli.ProviderCompat,
+			BaseURL:      srv.URL,
+			Model:        "test-model",
+			OutputFormat: "text",
+			LogLevel:     "error",
+		})
+	})
+
+	got := bodies()
+	if len(got) != 3 {
+		t.Fatalf("sent %d requests, want 3", len(got))
+	}
+	assertField(t, got[0], "temperature", 0.5)
+	assertMessages(t, got[0], "system:Provide helpful and concise responses", "user:exit")
+	assertMessages(t, got[1], "system:Be terse", "user:second")
+	assertMessages(t, got[2], "system:Be terse", "user:second")
+
+	data, err := os.ReadFile(saved)
+	if err != nil {
+		t.Fatalf("/save wrote nothing: %v", err)
+	}
+	var transcript map[string]interface{}
+	if err := json.Unmarshal(data, &transcript); err != nil {
+		t.Fatalf("decoding saved conversation: %v", err)
+	}
+	assertMessages(t, transcript, "system:Be terse", "user:second", "assistant:hi")
+
+	h, err := history.LoadHistory()
+	if err != nil || len(h.Entries) != 3 {
+		t.Fatalf("LoadHistory() = %+v, %v", h, err)
+	}
+	if h.Entries[2].SystemPrompt != "Be terse" {
+		t.Errorf("history system prompt = %q, want the one set by /system", h.Entries[2].SystemPrompt)
+	}
+}
+
+func TestInteractiveLoad(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	srv, bodies := recordServer(t)
+	saved := filepath.Join(t.TempDir(), "chat.json")
+	data := `{"messages":[{"role":"system","content":"Be brief"},{"role":"user","content":"earlier"},{"role":"assistant","content":"reply"}]}`
+	if err := os.WriteFile(saved, []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	withStdin(t, "/load "+saved+"\nnext\n", func() {
+		cli.Chat(&cli.ChatOptions{
+			Provider:     cli.ProviderCompat,
+			BaseURL:      srv.URL,
+			Model:        "test-model",
+			OutputFormat: "text",
+			LogLevel:     "error",
+		})
+	})
+
+	got := bodies()
+	if len(got) != 1 {
+		t.Fatalf("sent %d requests, want 1", len(got))
+	}
+	assertMessages(t, got[0], "system:Be brief", "user:earlier", "assistant:reply", "user:next")
+}
+
+// assertMessages checks the "messages" of a request body as role:content
+func assertMessages(t *testing.T, body map[string]interface{}, want ...string) {
+	t.Helper()
+	raw, _ := body["messages"].([]interface{})
+	var got []string
+	for _, m := range raw {
+		msg, _ := m.(map[string]interface{})
+		got = append(got, msg["role"].(string)+":"+msg["content"].(string))
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("messages = %q, want %q", got, want)
+	}
+}
+
+func TestInteractiveSwitchProvider(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	local, localBodies := recordServer(t)
+	hosted, hostedBodies := recordServer(t)
+	t.Setenv("OPENAI_API_KEY", "sk-test-0123456789abcdefghij")
+	t.Setenv("OPENAI_BASE_URL", hosted.URL)
+
+	input := "first\n/provider openai gpt-4o\nsecond\n"
+	withStdin(t, input, func() {
+		cli.Chat(&cli.ChatOptions{
+			Provider:     cli.ProviderCompat,
+			BaseURL:      local.URL,
+			Model:        "local-model",
+			OutputFormat: "text",
+			LogLevel:     "error",
+		})
+	})
+
+	if got := localBodies(); len(got) != 1 {
+		t.Fatalf("sent %d requests to the first provider, want 1", len(got))
+	}
+	got := hostedBodies()
+	if len(got) != 1 {
+		t.Fatalf("sent %d requests to the second provider, want 1", len(got))
+	}
+	assertField(t, got[0], "model", "gpt-4o")
+	assertMessages(t, got[0], "system:Provide helpful and concise responses", "user:first", "assistant:hi", "user:second")
+
+	h, err := history.LoadHistory()
+	if err != nil || len(h.Entries) != 2 {
+		t.Fatalf("LoadHistory() = %+v, %v", h, err)
+	}
+	if h.Entries[0].Provider != "compat" || h.Entries[1].Provider != "openai" || h.Entries[0].SessionID != h.Entries[1].SessionID {
+		t.Errorf("history entries = %+v, want both providers in one session", h.Entries)
+	}
+}
+
+func TestInteractiveCancelKeepsPartialReply(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	var mu sync.Mutex
+	var requests []map[string]interface{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body := map[string]interface{}{}
+		json.NewDecoder(r.Body).Decode(&body)
+		mu.Lock()
+		requests = append(requests, body)
+		first := len(requests) == 1
+		mu.Unlock()
+		if !first {
+			openAIStream(w)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		io.WriteString(w, "data: {\"choices\":[{\"index\":0,\"delta\":{\"content\":\"partial\"}}]}\n\n")
+		w.(http.Flusher).Flush()
+		// Give the client time to read the chunk, press Ctrl-C, then hold the
+		// stream open until the client gives up
+		time.Sleep(200 * time.Millisecond)
+		if p, err := os.FindProcess(os.Getpid()); err == nil {
+			p.Signal(os.Interrupt)
+		}
+		<-r.Context().Done()
+	}))
+	defer srv.Close()
+
+	withStdin(t, "first\nsecond\n", func() {
+		cli.Chat(&cli.ChatOptions{
+			Provider:     cli.ProviderCompat,
+			BaseURL:      srv.URL,
+			Model:        "test-model",
+			OutputFormat: "text",
+			LogLevel:     "error",
+		})
+	})
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(requests) != 2 {
+		t.Fatalf("sent %d requests, want 2", len(requests))
+	}
+	assertMessages(t, requests[1], "system:Provide helpful and concise responses", "user:first", "assistant:partial", "user:second")
+}
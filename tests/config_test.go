@@ -0,0 +1,242 @@
+package tests
+
+import (
+	"bytes"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/valdezdata/chat-cli/internal/config"
+	"github.com/valdezdata/chat-cli/internal/utils"
+)
+
+func fakeEnv(vars map[string]string) func(string) string {
+	return func(name string) string { return vars[name] }
+}
+
+func TestResolvePrecedence(t *testing.T) {
+	temperature := 0.2
+	file := &config.File{
+		DefaultProfile: "work",
+		Profiles: map[string]config.Profile{
+			"work": {Provider: "groq", Model: "llama-70b", Temperature: &temperature, Format: "markdown"},
+		},
+	}
+
+	tests := []struct {
+		name       string
+		flags      map[string]string
+		env        map[string]string
+		key        string
+		wantValue  string
+		wantSource string
+	}{
+		{"profile", nil, nil, config.KeyTemperature, "0.2", config.SourceProfile},
+		{"env beats profile", nil, map[string]string{"CHAT_CLI_TEMPERATURE": "0.5"}, config.KeyTemperature, "0.5", config.SourceEnv},
+		{"flag beats env", map[string]string{config.KeyTemperature: "0.9"}, map[string]string{"CHAT_CLI_TEMPERATURE": "0.5"}, config.KeyTemperature, "0.9", config.SourceFlag},
+		{"default", nil, nil, config.KeyMaxTokens, "4000", config.SourceDefault},
+		{"provider env beats generic env", nil, map[string]string{"GROQ_MODEL": "gemma", "CHAT_CLI_MODEL": "other"}, config.KeyModel, "gemma", config.SourceEnv},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			settings, err := config.Resolve(file, "", tt.flags, fakeEnv(tt.env))
+			if err != nil {
+				t.Fatalf("Resolve() error: %v", err)
+			}
+			got := settings.Values[tt.key]
+			if got.Value != tt.wantValue || got.Source != tt.wantSource {
+				t.Errorf("%s = %q (%s), want %q (%s)", tt.key, got.Value, got.Source, tt.wantValue, tt.wantSource)
+			}
+		})
+	}
+}
+
+func TestResolveProviderOverrideDropsProfileModel(t *testing.T) {
+	file := &config.File{
+		Profiles: map[string]config.Profile{
+			"work": {Provider: "groq", Model: "llama-70b", BaseURL: "https://example.com"},
+		},
+	}
+
+	settings, err := config.Resolve(file, "work", map[string]string{config.KeyProvider: "openai"}, fakeEnv(nil))
+	if err != nil {
+		t.Fatalf("Resolve() error: %v", err)
+	}
+	if got := settings.Get(config.KeyModel); got != "" {
+		t.Errorf("model = %q, want empty when the provider differs from the profile's", got)
+	}
+	if got := settings.Get(config.KeyBaseURL); got != "" {
+		t.Errorf("base_url = %q, want empty when the provider differs from the profile's", got)
+	}
+}
+
+func TestResolveUnknownProfile(t *testing.T) {
+	if _, err := config.Resolve(&config.File{}, "missing", nil, fakeEnv(nil)); err == nil {
+		t.Error("Resolve() with an unknown profile expected error, got nil")
+	}
+}
+
+func TestShowSettingsShortensLongValues(t *testing.T) {
+	system := strings.Repeat("é", 50)
+	settings, err := config.Resolve(&config.File{}, "", map[string]string{config.KeySystemPrompt: system}, fakeEnv(nil))
+	if err != nil {
+		t.Fatalf("Resolve() error: %v", err)
+	}
+	var out bytes.Buffer
+	config.ShowSettings(&out, settings, "config.toml", fakeEnv(nil))
+	if !utf8.Valid(out.Bytes()) {
+		t.Errorf("ShowSettings() wrote invalid UTF-8:\n%s", out.String())
+	}
+	if want := strings.Repeat("é", 37) + "..."; !strings.Contains(out.String(), want) {
+		t.Errorf("ShowSettings() output is missing %q:\n%s", want, out.String())
+	}
+}
+
+func TestLoadConfigFile(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+
+	file, err := config.Load()
+	if err != nil {
+		t.Fatalf("Load() without a config file error: %v", err)
+	}
+	if len(file.Profiles) != 0 {
+		t.Errorf("Load() without a config file returned %d profiles", len(file.Profiles))
+	}
+
+	data := "default_profile: local\nprofiles:\n  local:\n    provider: ollama\n    max_tokens: 256\n"
+	if err := os.WriteFile(filepath.Join(home, ".chat-cli", "config.yaml"), []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+	file, err = config.Load()
+	if err != nil {
+		t.Fatalf("Load() error: %v", err)
+	}
+	p := file.Profiles["local"]
+	if file.DefaultProfile != "local" || p.Provider != "ollama" || p.MaxTokens == nil || *p.MaxTokens != 256 {
+		t.Errorf("Load() = %+v, profile %+v", file, p)
+	}
+}
+
+func TestPriceTable(t *testing.T) {
+	file := &config.File{Prices: map[string]config.Price{
+		"gpt-4o":          {Input: 1, Output: 2},
+		"compat/my-model": {Input: 3, Output: 4},
+	}}
+	table := file.PriceTable()
+
+	tests := []struct {
+		provider, model string
+		want            float64
+		wantOK          bool
+	}{
+		{"openai", "gpt-4o", 1*1 + 2*0.5, true},             // Config overrides the default
+		{"compat", "my-model", 3*1 + 4*0.5, true},           // provider/model key
+		{"ollama", "llama3:latest", 0, true},                // Provider key
+		{"openai", "gpt-4.1-nano", 0.10*1 + 0.40*0.5, true}, // Default
+		{"compat", "unknown-model", 0, false},
+	}
+	for _, tt := range tests {
+		got, ok := table.Cost(tt.provider, tt.model, 1_000_000, 500_000)
+		if ok != tt.wantOK || math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("Cost(%q, %q) = %v, %v, want %v, %v", tt.provider, tt.model, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
+
+func TestHistoryRetentionConfig(t *testing.T) {
+	r, err := config.HistoryConfig{MaxAge: "90d", MaxEntries: 500, MaxBytes: "10MB"}.Retention()
+	if err != nil {
+		t.Fatalf("Retention() error: %v", err)
+	}
+	if r.MaxAge != 90*24*time.Hour || r.MaxEntries != 500 || r.MaxBytes != 10<<20 {
+		t.Errorf("Retention() = %+v", r)
+	}
+
+	for _, h := range []config.HistoryConfig{{MaxAge: "3x"}, {MaxBytes: "lots"}, {MaxEntries: -1}} {
+		if _, err := h.Retention(); err == nil {
+			t.Errorf("Retention() with %+v expected error, got nil", h)
+		}
+	}
+}
+
+func TestHistoryEncryptionConfig(t *testing.T) {
+	keyFile := filepath.Join(t.TempDir(), "history.key")
+	if err := os.WriteFile(keyFile, []byte("key file secret\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	e, err := config.HistoryConfig{Encrypt: true, KeyFile: keyFile}.Encryption(fakeEnv(nil))
+	if err != nil || !e.Enabled || string(e.Secret) != "key file secret" {
+		t.Errorf("Encryption() with a key file = %+v, %v", e, err)
+	}
+
+	env := fakeEnv(map[string]string{config.PassphraseEnv: "from env"})
+	e, err = config.HistoryConfig{Encrypt: true, KeyFile: keyFile}.Encryption(env)
+	if err != nil || string(e.Secret) != "from env" {
+		t.Errorf("Encryption() with %s = %+v, %v", config.PassphraseEnv, e, err)
+	}
+
+	if _, err := (config.HistoryConfig{Encrypt: true}).Encryption(fakeEnv(nil)); err == nil {
+		t.Error("Encryption() without a secret expected error, got nil")
+	}
+}
+
+func TestRedactionConfig(t *testing.T) {
+	c := config.RedactionConfig{
+		Actions: map[string]string{"email": "mask", "jwt": "block"},
+		Rules:   []config.RedactionRule{{Name: "hostname", Pattern: `\b[a-z]+\.corp\.example\b`}},
+	}
+	detectors, err := c.Detectors()
+	if err != nil {
+		t.Fatalf("Detectors() error: %v", err)
+	}
+	actions := map[string]utils.RedactAction{}
+	for _, d := range detectors {
+		actions[d.Name] = d.Action
+	}
+	if actions["email"] != utils.RedactMask || actions["jwt"] != utils.RedactBlock || actions["hostname"] != utils.RedactMask || actions["api_key"] != utils.RedactMask {
+		t.Errorf("Detectors() actions = %v", actions)
+	}
+
+	bad := []config.RedactionConfig{
+		{Actions: map[string]string{"email": "shred"}},
+		{Actions: map[string]string{"phone": "mask"}},
+		{Rules: []config.RedactionRule{{Name: "broken", Pattern: "("}}},
+	}
+	for _, c := range bad {
+		if _, err := c.Detectors(); err == nil {
+			t.Errorf("Detectors() with %+v expected error, got nil", c)
+		}
+	}
+}
+
+func TestInputConfig(t *testing.T) {
+	tests := []struct {
+		c     config.InputConfig
+		limit int
+	}{
+		{config.InputConfig{}, config.DefaultInputHistorySize},
+		{config.InputConfig{Keymap: config.KeymapVi, HistorySize: 50}, 50},
+		{config.InputConfig{HistorySize: -1}, 0},
+	}
+	for _, tt := range tests {
+		if err := tt.c.Validate(); err != nil {
+			t.Errorf("Validate() with %+v error: %v", tt.c, err)
+		}
+		if got := tt.c.HistoryLimit(); got != tt.limit {
+			t.Errorf("HistoryLimit() with %+v = %d, want %d", tt.c, got, tt.limit)
+		}
+	}
+
+	for _, c := range []config.InputConfig{{Keymap: "nano"}, {HistorySize: -2}} {
+		if err := c.Validate(); err == nil {
+			t.Errorf("Validate() with %+v expected error, got nil", c)
+		}
+	}
+}
@@ -0,0 +1,147 @@
+package tests
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/valdezdata/chat-cli/internal/history"
+)
+
+func TestEncryptedHistory(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	defer history.SetEncryption(history.Encryption{})
+
+	// A plaintext entry from before encryption was turned on
+	if err := history.AddEntry(history.Entry{Prompt: "plain prompt"}); err != nil {
+		t.Fatalf("AddEntry() error: %v", err)
+	}
+
+	history.SetEncryption(history.Encryption{Enabled: true, Secret: []byte("correct horse")})
+	if err := history.AddEntry(history.Entry{Prompt: "proprietary code", Response: "secret reply"}); err != nil {
+		t.Fatalf("AddEntry() with encryption error: %v", err)
+	}
+
+	path := filepath.Join(home, ".chat-cli", "history.jsonl")
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(data, []byte("proprietary")) || !bytes.Contains(data, []byte("plain prompt")) {
+		t.Errorf("history file should hold only the old entry in plain text:\n%s", data)
+	}
+
+	// Reading decrypts transparently, including for search
+	found, err := history.Search(history.Filter{Query: "proprietary"})
+	if err != nil || len(found) != 1 || found[0].Response != "secret reply" {
+		t.Fatalf("Search() = %+v, %v", found, err)
+	}
+
+	// Encrypting rewrites the old entry too
+	if n, kept, err := history.Rewrite(true); err != nil || n != 2 || kept != 0 {
+		t.Fatalf("Rewrite(true) = %d, %d, %v", n, kept, err)
+	}
+	data, _ = os.ReadFile(path)
+	if bytes.Contains(data, []byte("plain prompt")) {
+		t.Errorf("history file still holds plain text after Rewrite(true):\n%s", data)
+	}
+
+	// Reading requires the right secret
+	history.SetEncryption(history.Encryption{})
+	if _, err := history.LoadHistory(); err != history.ErrNoPassphrase {
+		t.Errorf("LoadHistory() without a secret error = %v, want ErrNoPassphrase", err)
+	}
+	history.SetEncryption(history.Encryption{Secret: []byte("wrong")})
+	if _, err := history.LoadHistory(); err == nil || !strings.Contains(err.Error(), "wrong history passphrase") {
+		t.Errorf("LoadHistory() with a wrong secret error = %v", err)
+	}
+
+	// Decrypting restores plain text
+	history.SetEncryption(history.Encryption{Secret: []byte("correct horse")})
+	if n, kept, err := history.Rewrite(false); err != nil || n != 2 || kept != 0 {
+		t.Fatalf("Rewrite(false) = %d, %d, %v", n, kept, err)
+	}
+	data, _ = os.ReadFile(path)
+	if !bytes.Contains(data, []byte("proprietary code")) {
+		t.Errorf("history file not decrypted:\n%s", data)
+	}
+}
+
+func TestEncryptKeepsUnreadableLines(t *testing.T) {
+	defer history.SetEncryption(history.Encryption{})
+
+	// A line encrypted under another passphrase, copied from another history
+	other := t.TempDir()
+	t.Setenv("HOME", other)
+	history.SetEncryption(history.Encryption{Enabled: true, Secret: []byte("other secret")})
+	if err := history.AddEntry(history.Entry{Prompt: "elsewhere"}); err != nil {
+		t.Fatalf("AddEntry() error: %v", err)
+	}
+	foreign, err := os.ReadFile(filepath.Join(other, ".chat-cli", "history.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	history.SetEncryption(history.Encryption{Enabled: true, Secret: []byte("correct horse")})
+	if err := history.AddEntry(history.Entry{Prompt: "mine"}); err != nil {
+		t.Fatalf("AddEntry() error: %v", err)
+	}
+	path := filepath.Join(home, ".chat-cli", "history.jsonl")
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	truncated := "{\"prompt\": \"cut sho\n"
+	f.Write(foreign)
+	f.WriteString(truncated)
+	f.Close()
+
+	for _, encrypt := range []bool{false, true} {
+		if n, kept, err := history.Rewrite(encrypt); err != nil || n != 1 || kept != 2 {
+			t.Fatalf("Rewrite(%v) = %d, %d, %v, want 1, 2, nil", encrypt, n, kept, err)
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.HasSuffix(data, append(foreign, truncated...)) {
+			t.Errorf("Rewrite(%v) did not keep the unreadable lines:\n%s", encrypt, data)
+		}
+		if bytes.Contains(data, []byte("mine")) == encrypt {
+			t.Errorf("Rewrite(%v) left:\n%s", encrypt, data)
+		}
+	}
+}
+
+func TestHistoryFilePermissions(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+
+	// A history file and directory created by an older version
+	dir := filepath.Join(home, ".chat-cli")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "history.jsonl")
+	if err := os.WriteFile(path, []byte(`{"prompt":"old"}`+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := history.AddEntry(history.Entry{Prompt: "new"}); err != nil {
+		t.Fatalf("AddEntry() error: %v", err)
+	}
+	for name, want := range map[string]os.FileMode{dir: 0700, path: 0600, filepath.Join(dir, "history.lock"): 0600} {
+		info, err := os.Stat(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := info.Mode().Perm(); got != want {
+			t.Errorf("%s mode = %o, want %o", name, got, want)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/valdezdata/chat-cli/internal/history"
+)
+
+func exportEntries() []history.Entry {
+	at := time.Date(2026, 10, 13, 15, 0, 0, 0, time.UTC)
+	return []history.Entry{
+		{ID: "e1", Timestamp: at, SessionID: "s1", Turn: 1, Provider: "groq", ModelName: "gemma2-9b-it", Prompt: "first <question>", Response: "first answer", InputTokens: 7, OutputTokens: 2, TotalTokens: 9, TokenSource: "provider", TimeTaken: 1.5},
+		{ID: "e2", Timestamp: at.Add(time.Minute), Provider: "ollama", ModelName: "llama3:latest", Prompt: "standalone", Response: "reply, with \"quotes\"\nand a newline"},
+		{ID: "e3", Timestamp: at.Add(2 * time.Minute), SessionID: "s1", Turn: 2, Provider: "groq", ModelName: "gemma2-9b-it", Prompt: "second question", Response: "second answer", Assessment: &history.Assessment{OverallScore: 80}},
+	}
+}
+
+func TestExportMarkdownGroupsSessions(t *testing.T) {
+	var buf bytes.Buffer
+	if err := history.Export(&buf, exportEntries(), "md"); err != nil {
+		t.Fatalf("Export() error: %v", err)
+	}
+	out := buf.String()
+
+	session := strings.Index(out, "## Session s1")
+	second := strings.Index(out, "second question")
+	standalone := strings.Index(out, "## Entry e2")
+	if session < 0 || second < 0 || standalone < 0 {
+		t.Fatalf("markdown transcript is missing sections:\n%s", out)
+	}
+	if !(session < second && second < standalone) {
+		t.Errorf("session turns are not grouped before the next conversation:\n%s", out)
+	}
+}
+
+func TestExportHTMLEscapes(t *testing.T) {
+	var buf bytes.Buffer
+	if err := history.Export(&buf, exportEntries(), "html"); err != nil {
+		t.Fatalf("Export() error: %v", err)
+	}
+	if strings.Contains(buf.String(), "<question>") || !strings.Contains(buf.String(), "&lt;question&gt;") {
+		t.Error("HTML export does not escape message content")
+	}
+}
+
+func TestExportCSV(t *testing.T) {
+	var buf bytes.Buffer
+	if err := history.Export(&buf, exportEntries(), "csv"); err != nil {
+		t.Fatalf("Export() error: %v", err)
+	}
+	records, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatalf("reading exported CSV: %v", err)
+	}
+	if len(records) != 4 {
+		t.Fatalf("CSV has %d rows, want header + 3", len(records))
+	}
+
+	row := map[string]string{}
+	for i, name := range records[0] {
+		row[name] = records[1][i]
+	}
+	want := map[string]string{"id": "e1", "input_tokens": "7", "output_tokens": "2", "total_tokens": "9", "time_taken": "1.500", "token_source": "provider"}
+	for name, value := range want {
+		if row[name] != value {
+			t.Errorf("CSV %s = %q, want %q", name, row[name], value)
+		}
+	}
+	if got := records[2][len(records[2])-1]; got != "reply, with \"quotes\"\nand a newline" {
+		t.Errorf("CSV response did not round-trip: %q", got)
+	}
+}
+
+func TestExportJSONL(t *testing.T) {
+	var buf bytes.Buffer
+	if err := history.Export(&buf, exportEntries(), "jsonl"); err != nil {
+		t.Fatalf("Export() error: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("JSONL has %d lines, want 3", len(lines))
+	}
+	var entry history.Entry
+	if err := json.Unmarshal([]byte(lines[0]), &entry); err != nil {
+		t.Fatalf("decoding JSONL line: %v", err)
+	}
+	if entry.TotalTokens != 9 || entry.TimeTaken != 1.5 {
+		t.Errorf("JSONL entry = %+v, want token and timing fields", entry)
+	}
+}
+
+func TestExportUnknownFormat(t *testing.T) {
+	if err := history.Export(&bytes.Buffer{}, nil, "pdf"); err == nil {
+		t.Error("Export() with an unknown format expected error, got nil")
+	}
+}
@@ -0,0 +1,302 @@
+package tests
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/valdezdata/chat-cli/internal/history"
+)
+
+func TestFindSession(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	entries := []history.Entry{
+		{SessionID: "aaa111", Turn: 1, Prompt: "one"},
+		{Prompt: "before sessions"},
+		{SessionID: "bbb222", Turn: 1, Prompt: "other"},
+		{SessionID: "aaa111", Turn: 2, Prompt: "two"},
+	}
+	for _, entry := range entries {
+		if err := history.AddEntry(entry); err != nil {
+			t.Fatalf("AddEntry() error: %v", err)
+		}
+	}
+
+	tests := []struct {
+		ref         string
+		wantID      string
+		wantPrompts []string
+	}{
+		{"aaa111", "aaa111", []string{"one", "two"}},
+		{"bbb", "bbb222", []string{"other"}},
+		{"last", "aaa111", []string{"one", "two"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.ref, func(t *testing.T) {
+			id, found, err := history.FindSession(tt.ref)
+			if err != nil {
+				t.Fatalf("FindSession(%q) error: %v", tt.ref, err)
+			}
+			if id != tt.wantID {
+				t.Errorf("FindSession(%q) id = %q, want %q", tt.ref, id, tt.wantID)
+			}
+			var prompts []string
+			for _, entry := range found {
+				prompts = append(prompts, entry.Prompt)
+			}
+			if !reflect.DeepEqual(prompts, tt.wantPrompts) {
+				t.Errorf("FindSession(%q) prompts = %v, want %v", tt.ref, prompts, tt.wantPrompts)
+			}
+		})
+	}
+
+	if _, _, err := history.FindSession("zzz"); err == nil {
+		t.Error("FindSession() with an unknown session expected error, got nil")
+	}
+}
+
+func TestListSessions(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	start := time.Date(2025, 3, 1, 9, 0, 0, 0, time.UTC)
+	entries := []history.Entry{
+		{SessionID: "aaa111", Turn: 1, Timestamp: start, Provider: "ollama", ModelName: "llama", Prompt: "one"},
+		{Timestamp: start.Add(time.Minute), Prompt: "before sessions"},
+		{SessionID: "bbb222", Turn: 1, Timestamp: start.Add(2 * time.Minute), Provider: "groq", ModelName: "mixtral", Prompt: "other"},
+		{SessionID: "aaa111", Turn: 2, Timestamp: start.Add(3 * time.Minute), Provider: "openai", ModelName: "gpt-4o", Prompt: "two"},
+	}
+	for _, entry := range entries {
+		if err := history.AddEntry(entry); err != nil {
+			t.Fatalf("AddEntry() error: %v", err)
+		}
+	}
+
+	sessions, err := history.ListSessions()
+	if err != nil {
+		t.Fatalf("ListSessions() error: %v", err)
+	}
+	want := []history.Session{
+		{ID: "aaa111", Started: start, Updated: start.Add(3 * time.Minute), Turns: 2, Provider: "openai", Model: "gpt-4o", Title: "one"},
+		{ID: "bbb222", Started: start.Add(2 * time.Minute), Updated: start.Add(2 * time.Minute), Turns: 1, Provider: "groq", Model: "mixtral", Title: "other"},
+	}
+	if len(sessions) != len(want) {
+		t.Fatalf("ListSessions() = %+v, want %+v", sessions, want)
+	}
+	for i := range want {
+		got := sessions[i]
+		if got.ID != want[i].ID || !got.Started.Equal(want[i].Started) || !got.Updated.Equal(want[i].Updated) ||
+			got.Turns != want[i].Turns || got.Provider != want[i].Provider || got.Model != want[i].Model || got.Title != want[i].Title {
+			t.Errorf("ListSessions()[%d] = %+v, want %+v", i, got, want[i])
+		}
+	}
+}
+
+func TestNewSessionID(t *testing.T) {
+	a, b := history.NewSessionID(), history.NewSessionID()
+	if a == "" || a == b {
+		t.Errorf("NewSessionID() = %q, %q; want distinct non-empty IDs", a, b)
+	}
+}
+
+func TestMigrateLegacyHistory(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	dir := filepath.Join(home, ".chat-cli")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	legacy := `{"entries":[{"provider":"groq","prompt":"old one"},{"provider":"ollama","prompt":"old two"}]}`
+	if err := os.WriteFile(filepath.Join(dir, "history.json"), []byte(legacy), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := history.AddEntry(history.Entry{Prompt: "new"}); err != nil {
+		t.Fatalf("AddEntry() error: %v", err)
+	}
+	h, err := history.LoadHistory()
+	if err != nil {
+		t.Fatalf("LoadHistory() error: %v", err)
+	}
+	var prompts []string
+	for _, entry := range h.Entries {
+		prompts = append(prompts, entry.Prompt)
+	}
+	if want := []string{"old one", "old two", "new"}; !reflect.DeepEqual(prompts, want) {
+		t.Errorf("prompts after migration = %v, want %v", prompts, want)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "history.json.bak")); err != nil {
+		t.Errorf("legacy history was not kept as a backup: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "history.json")); !os.IsNotExist(err) {
+		t.Errorf("legacy history.json still present after migration")
+	}
+}
+
+func TestConcurrentAddEntry(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	const writers, perWriter = 8, 25
+	var wg sync.WaitGroup
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < perWriter; i++ {
+				entry := history.Entry{Prompt: fmt.Sprintf("writer %d entry %d", w, i), Response: strings.Repeat("x", 4096)}
+				if err := history.AddEntry(entry); err != nil {
+					t.Errorf("AddEntry() error: %v", err)
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	h, err := history.LoadHistory()
+	if err != nil {
+		t.Fatalf("LoadHistory() error: %v", err)
+	}
+	if len(h.Entries) != writers*perWriter || h.Skipped != 0 {
+		t.Errorf("LoadHistory() = %d entries, %d skipped; want %d, 0", len(h.Entries), h.Skipped, writers*perWriter)
+	}
+}
+
+func TestTruncatedHistoryLine(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	if err := history.AddEntry(history.Entry{Prompt: "first"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Simulate a crash in the middle of an append
+	path, err := history.GetHistoryFilePath()
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`{"prompt":"cut sh`)
+	f.Close()
+
+	if err := history.AddEntry(history.Entry{Prompt: "after crash"}); err != nil {
+		t.Fatal(err)
+	}
+	h, err := history.LoadHistory()
+	if err != nil {
+		t.Fatalf("LoadHistory() error: %v", err)
+	}
+	if len(h.Entries) != 2 || h.Entries[1].Prompt != "after crash" || h.Skipped != 1 {
+		t.Errorf("LoadHistory() = %+v, skipped %d; want 2 entries and 1 skipped line", h.Entries, h.Skipped)
+	}
+}
+
+func TestFilterMatch(t *testing.T) {
+	day := time.Date(2026, 10, 13, 15, 0, 0, 0, time.UTC)
+	entry := history.Entry{
+		Timestamp:  day,
+		SessionID:  "abc123",
+		Provider:   "groq",
+		ModelName:  "gemma2-9b-it",
+		Prompt:     "How do I pin the provider version?",
+		Response:   "In your Terraform module, add a required_providers block.",
+		Assessment: &history.Assessment{OverallScore: 75},
+	}
+
+	tests := []struct {
+		name   string
+		filter history.Filter
+		want   bool
+	}{
+		{"empty filter", history.Filter{}, true},
+		{"all words, any case", history.Filter{Query: "terraform MODULE"}, true},
+		{"missing word", history.Filter{Query: "terraform ansible"}, false},
+		{"provider", history.Filter{Provider: "groq"}, true},
+		{"other provider", history.Filter{Provider: "openai"}, false},
+		{"model substring", history.Filter{Model: "gemma"}, true},
+		{"session prefix", history.Filter{SessionID: "abc"}, true},
+		{"inside range", history.Filter{Since: day.Add(-time.Hour), Until: day.Add(time.Hour)}, true},
+		{"until is exclusive", history.Filter{Until: day}, false},
+		{"score high enough", history.Filter{MinScore: 70}, true},
+		{"score too low", history.Filter{MinScore: 80}, false},
+		{"score required", history.Filter{MinScore: 1}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.filter.Match(entry); got != tt.want {
+				t.Errorf("Match() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	if (history.Filter{MinScore: 1}).Match(history.Entry{}) {
+		t.Error("Match() with MinScore accepted an entry without an assessment")
+	}
+}
+
+func TestParseTimeRange(t *testing.T) {
+	// Friday 2026-10-16 12:00
+	now := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	midnight := func(day int) time.Time { return time.Date(2026, 10, day, 0, 0, 0, 0, time.UTC) }
+
+	tests := []struct {
+		value     string
+		wantSince time.Time
+		wantUntil time.Time
+	}{
+		{"2026-10-13", midnight(13), midnight(14)},
+		{"2026-10-13 09:30", midnight(13).Add(9*time.Hour + 30*time.Minute), midnight(13).Add(9*time.Hour + 30*time.Minute)},
+		{"today", midnight(16), midnight(17)},
+		{"yesterday", midnight(15), midnight(16)},
+		{"Tuesday", midnight(13), midnight(14)},
+		{"friday", midnight(9), midnight(10)},
+		{"36h", now.Add(-36 * time.Hour), now.Add(-36 * time.Hour)},
+		{"2w", now.AddDate(0, 0, -14), now.AddDate(0, 0, -14)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			since, err := history.ParseSince(tt.value, now)
+			if err != nil || !since.Equal(tt.wantSince) {
+				t.Errorf("ParseSince(%q) = %v, %v; want %v", tt.value, since, err, tt.wantSince)
+			}
+			until, err := history.ParseUntil(tt.value, now)
+			if err != nil || !until.Equal(tt.wantUntil) {
+				t.Errorf("ParseUntil(%q) = %v, %v; want %v", tt.value, until, err, tt.wantUntil)
+			}
+		})
+	}
+
+	if _, err := history.ParseSince("last tuesday-ish", now); err == nil {
+		t.Error("ParseSince() with an invalid value expected error, got nil")
+	}
+}
+
+func TestFindEntry(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	for _, entry := range []history.Entry{{ID: "a1b2c3d4", Prompt: "one"}, {ID: "a1ffffff", Prompt: "two"}, {Prompt: "generated"}} {
+		if err := history.AddEntry(entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if entry, err := history.FindEntry("a1b"); err != nil || entry.Prompt != "one" {
+		t.Errorf("FindEntry(%q) = %+v, %v; want the first entry", "a1b", entry, err)
+	}
+	if _, err := history.FindEntry("a1"); err == nil {
+		t.Error("FindEntry() with an ambiguous prefix expected error, got nil")
+	}
+
+	h, err := history.LoadHistory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id := h.Entries[2].ID; id == "" {
+		t.Error("AddEntry() did not assign an ID")
+	}
+}
@@ -0,0 +1,160 @@
+package tests
+
+import (
+	"testing"
+	"time"
+
+	"github.com/valdezdata/chat-cli/internal/history"
+)
+
+const chatGPTExport = `[{
+  "id": "conv-1",
+  "title": "Greetings",
+  "create_time": 1700000000.5,
+  "current_node": "n4",
+  "mapping": {
+    "root": {"parent": null, "message": null},
+    "n1": {"parent": "root", "message": {"author": {"role": "system"}, "content": {"content_type": "text", "parts": [""]}}},
+    "n2": {"parent": "n1", "message": {"author": {"role": "user"}, "create_time": 1700000001, "content": {"content_type": "text", "parts": ["hello"]}}},
+    "n3": {"parent": "n2", "message": {"author": {"role": "assistant"}, "create_time": 1700000003, "content": {"content_type": "text", "parts": ["hi there"]}, "metadata": {"model_slug": "gpt-4o"}}},
+    "old": {"parent": "n3", "message": {"author": {"role": "user"}, "content": {"content_type": "text", "parts": ["abandoned branch"]}}},
+    "n4": {"parent": "n3", "message": {"author": {"role": "user"}, "create_time": 1700000010, "content": {"content_type": "text", "parts": ["bye"]}}}
+  }
+}]`
+
+func TestParseImportChatGPT(t *testing.T) {
+	now := time.Now()
+	entries, err := history.ParseImport([]byte(chatGPTExport), "auto", "/tmp/conversations.json", now)
+	if err != nil {
+		t.Fatalf("ParseImport() error: %v", err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("ParseImport() returned %d entries, want 2: %+v", len(entries), entries)
+	}
+
+	first := entries[0]
+	if first.Prompt != "hello" || first.Response != "hi there" || first.ModelName != "gpt-4o" {
+		t.Errorf("first entry = %+v", first)
+	}
+	if first.Provider != "chatgpt" || first.Source != "chatgpt:conversations.json" {
+		t.Errorf("first entry provider/source = %q/%q", first.Provider, first.Source)
+	}
+	if !first.Timestamp.Equal(time.Unix(1700000001, 0)) || first.TimeTaken != 2 {
+		t.Errorf("first entry timestamp/time taken = %v/%v", first.Timestamp, first.TimeTaken)
+	}
+	if entries[1].Prompt != "bye" || entries[1].Response != "" || entries[1].Turn != 2 {
+		t.Errorf("second entry = %+v", entries[1])
+	}
+	if first.SessionID == "" || entries[1].SessionID != first.SessionID {
+		t.Errorf("session IDs = %q, %q, want the same non-empty ID", first.SessionID, entries[1].SessionID)
+	}
+
+	again, _ := history.ParseImport([]byte(chatGPTExport), "chatgpt", "conversations.json", now.Add(time.Hour))
+	if again[0].ID != first.ID || again[0].SessionID != first.SessionID {
+		t.Errorf("IDs are not stable across imports: %q/%q vs %q/%q", again[0].ID, again[0].SessionID, first.ID, first.SessionID)
+	}
+}
+
+func TestParseImportOpenAIMessages(t *testing.T) {
+	data := `[
+	  {"role": "system", "content": "Be terse."},
+	  {"role": "user", "content": "2+2?"},
+	  {"role": "assistant", "content": [{"type": "text", "text": "4"}]},
+	  {"role": "user", "content": "thanks"},
+	  {"role": "assistant", "content": "np"}
+	]`
+	now := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	entries, err := history.ParseImport([]byte(data), "auto", "messages.json", now)
+	if err != nil {
+		t.Fatalf("ParseImport() error: %v", err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("ParseImport() returned %d entries, want 2", len(entries))
+	}
+	for i, want := range [][2]string{{"2+2?", "4"}, {"thanks", "np"}} {
+		entry := entries[i]
+		if entry.Prompt != want[0] || entry.Response != want[1] {
+			t.Errorf("entry %d = %q/%q, want %q/%q", i, entry.Prompt, entry.Response, want[0], want[1])
+		}
+		if entry.SystemPrompt != "Be terse." || entry.Source != "openai:messages.json" || !entry.Timestamp.Equal(now) {
+			t.Errorf("entry %d = %+v", i, entry)
+		}
+	}
+}
+
+func TestParseImportJSONL(t *testing.T) {
+	data := `{"id": "keep1", "timestamp": "2025-01-01T00:00:00Z", "provider": "groq", "prompt": "p1", "response": "r1"}
+
+{"model": "gpt-4o-mini", "messages": [{"role": "user", "content": "p2"}, {"role": "assistant", "content": "r2"}]}
+`
+	entries, err := history.ParseImport([]byte(data), "auto", "mixed.jsonl", time.Now())
+	if err != nil {
+		t.Fatalf("ParseImport() error: %v", err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("ParseImport() returned %d entries, want 2", len(entries))
+	}
+	if entries[0].ID != "keep1" || entries[0].Provider != "groq" || entries[0].Source != "jsonl:mixed.jsonl" {
+		t.Errorf("entry line = %+v", entries[0])
+	}
+	if entries[1].Prompt != "p2" || entries[1].ModelName != "gpt-4o-mini" {
+		t.Errorf("messages line = %+v", entries[1])
+	}
+
+	if _, err := history.ParseImport([]byte("{\"foo\": 1}\n{\"bar\": 2}\n"), "jsonl", "bad.jsonl", time.Now()); err == nil {
+		t.Error("ParseImport() with unrecognized lines expected error, got nil")
+	}
+	if _, err := history.ParseImport([]byte("[]"), "xml", "x", time.Now()); err == nil {
+		t.Error("ParseImport() with an unknown format expected error, got nil")
+	}
+}
+
+func TestImportEntriesDedupes(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	entries, err := history.ParseImport([]byte(chatGPTExport), "auto", "conversations.json", time.Now())
+	if err != nil {
+		t.Fatalf("ParseImport() error: %v", err)
+	}
+	added, err := history.ImportEntries(entries)
+	if err != nil || added != 2 {
+		t.Fatalf("ImportEntries() = %d, %v, want 2, nil", added, err)
+	}
+	added, err = history.ImportEntries(entries)
+	if err != nil || added != 0 {
+		t.Fatalf("second ImportEntries() = %d, %v, want 0, nil", added, err)
+	}
+
+	stored, err := history.LoadHistory()
+	if err != nil {
+		t.Fatalf("LoadHistory() error: %v", err)
+	}
+	if len(stored.Entries) != 2 {
+		t.Errorf("history has %d entries, want 2", len(stored.Entries))
+	}
+	if _, found, err := history.FindSession(entries[0].SessionID); err != nil || len(found) != 2 {
+		t.Errorf("FindSession(%q) = %d entries, %v", entries[0].SessionID, len(found), err)
+	}
+	if len(entries[0].ID) != 32 || len(entries[0].SessionID) != len("imp")+32 {
+		t.Errorf("imported IDs %q, %q are not 16 bytes", entries[0].ID, entries[0].SessionID)
+	}
+
+	// A different turn that happens to share an ID is not taken for a duplicate
+	collision := entries[0]
+	collision.Prompt = "something else"
+	if added, err := history.ImportEntries([]history.Entry{collision}); err != nil || added != 1 {
+		t.Errorf("ImportEntries() with a colliding ID = %d, %v, want 1, nil", added, err)
+	}
+
+	// Message arrays have no times, so each import stamps them afresh
+	data := []byte(`[{"role": "user", "content": "2+2?"}, {"role": "assistant", "content": "4"}]`)
+	for i, want := range []int{1, 0} {
+		entries, err := history.ParseImport(data, "openai", "messages.json", time.Now().Add(time.Duration(i)*time.Hour))
+		if err != nil {
+			t.Fatalf("ParseImport() error: %v", err)
+		}
+		if added, err := history.ImportEntries(entries); err != nil || added != want {
+			t.Errorf("import %d of messages.json = %d, %v, want %d, nil", i+1, added, err, want)
+		}
+	}
+}
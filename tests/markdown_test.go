@@ -0,0 +1,93 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/valdezdata/chat-cli/internal/cli"
+
+	"github.com/fatih/color"
+)
+
+const markdownReply = "## Steps\n\nRun **this**:\n\n```sh\n# not a heading\nmake test\n```\n\n| Flag | Use |\n|------|-----|\n| -v | verbose |\n\nDone"
+
+// captureStdout returns what fn writes to stdout
+func captureStdout(t *testing.T, fn func()) string {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout, colorOutput := os.Stdout, color.Output
+	os.Stdout, color.Output = w, w
+	defer func() {
+		os.Stdout, color.Output = stdout, colorOutput
+	}()
+
+	var buf bytes.Buffer
+	copied := make(chan struct{})
+	go func() {
+		io.Copy(&buf, r)
+		close(copied)
+	}()
+	fn()
+	w.Close()
+	<-copied
+	return buf.String()
+}
+
+func TestShellModeRender(t *testing.T) {
+	// Stream the reply a few bytes at a time, so blocks arrive in pieces
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		for i := 0; i < len(markdownReply); i += 3 {
+			chunk, _ := json.Marshal(markdownReply[i:min(i+3, len(markdownReply))])
+			fmt.Fprintf(w, "data: {\"choices\":[{\"index\":0,\"delta\":{\"content\":%s}}]}\n\n", chunk)
+		}
+		io.WriteString(w, "data: [DONE]\n\n")
+	}))
+	defer srv.Close()
+
+	run := func(mode cli.RenderMode) string {
+		return captureStdout(t, func() {
+			cli.Chat(&cli.ChatOptions{
+				Provider:     cli.ProviderCompat,
+				BaseURL:      srv.URL,
+				Model:        "test-model",
+				Shell:        true,
+				ShellPrompt:  "How do I test?",
+				OutputFormat: "text",
+				Quiet:        true,
+				SkipHistory:  true,
+				LogLevel:     "error",
+				Render:       mode,
+			})
+		})
+	}
+
+	// Not a terminal, so the default is raw text
+	for _, mode := range []cli.RenderMode{cli.RenderAuto, cli.RenderNone} {
+		if got := run(mode); got != markdownReply+"\n" {
+			t.Errorf("render %q printed %q, want the raw reply", mode, got)
+		}
+	}
+
+	got := run(cli.RenderMarkdown)
+	for _, markup := range []string{"```", "|------|"} {
+		if strings.Contains(got, markup) {
+			t.Errorf("rendered reply contains %q:\n%s", markup, got)
+		}
+	}
+	for _, text := range []string{"## Steps", "# not a heading", "make test", "verbose", "Done"} {
+		if !strings.Contains(got, text) {
+			t.Errorf("rendered reply is missing %q:\n%s", text, got)
+		}
+	}
+}
@@ -0,0 +1,523 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/valdezdata/chat-cli/internal/providers"
+)
+
+// testParams are sent with every request; the tests check they reach the wire
+func testParams() providers.MessageParams {
+	seed := 42
+	return providers.MessageParams{
+		Temperature: 0.25,
+		MaxTokens:   123,
+		TopP:        0.5,
+		Stop:        []string{"END"},
+		Seed:        &seed,
+	}
+}
+
+// captureServer records the decoded JSON body of the last request to path
+func captureServer(t *testing.T, path string, respond func(w http.ResponseWriter)) (*httptest.Server, *map[string]interface{}) {
+	t.Helper()
+	body := map[string]interface{}{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != path {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		data, err := io.ReadAll(r.Body)
+		if err != nil {
+			t.Errorf("reading request body: %v", err)
+		}
+		if err := json.Unmarshal(data, &body); err != nil {
+			t.Errorf("decoding request body %q: %v", data, err)
+		}
+		respond(w)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &body
+}
+
+// userTurn is a conversation holding just one user message
+func userTurn(text string) []providers.Message {
+	return []providers.Message{{Role: "user", Content: text}}
+}
+
+func openAIStream(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "text/event-stream")
+	fmt.Fprint(w, "data: {\"choices\":[{\"index\":0,\"delta\":{\"content\":\"hi\"}}]}\n\n")
+	fmt.Fprint(w, "data: {\"choices\":[],\"usage\":{\"prompt_tokens\":7,\"completion_tokens\":2,\"total_tokens\":9}}\n\n")
+	fmt.Fprint(w, "data: [DONE]\n\n")
+}
+
+func assertField(t *testing.T, body map[string]interface{}, key string, want interface{}) {
+	t.Helper()
+	got, ok := body[key]
+	if !ok {
+		t.Errorf("request body missing %q: %v", key, body)
+		return
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("request %q = %#v, want %#v", key, got, want)
+	}
+}
+
+// assertEvents checks that the deltas spell want and the stream ends with EventDone
+func assertEvents(t *testing.T, events []providers.Event, want string) {
+	t.Helper()
+	var text string
+	for _, e := range events {
+		if e.Type == providers.EventDelta {
+			text += e.Delta
+		}
+	}
+	if text != want {
+		t.Errorf("streamed deltas = %q, want %q", text, want)
+	}
+	if len(events) == 0 || events[len(events)-1].Type != providers.EventDone {
+		t.Errorf("stream did not end with EventDone: %+v", events)
+	}
+}
+
+// assertUsage checks token counts reported by the provider
+func assertUsage(t *testing.T, usage providers.Usage, input, output, total int) {
+	t.Helper()
+	want := providers.Usage{
+		InputTokens:  input,
+		OutputTokens: output,
+		TotalTokens:  total,
+		Source:       providers.UsageSourceProvider,
+	}
+	if usage != want {
+		t.Errorf("usage = %+v, want %+v", usage, want)
+	}
+}
+
+func TestOpenAICompatibleParams(t *testing.T) {
+	tests := []struct {
+		name    string
+		keyEnv  string
+		urlEnv  string
+		newChat func() providers.ChatInterface
+	}{
+		{"OpenAI", "OPENAI_API_KEY", "OPENAI_BASE_URL", func() providers.ChatInterface { return &providers.OpenAIClient{} }},
+		{"Groq", "GROQ_API_KEY", "GROQ_BASE_URL", func() providers.ChatInterface { return &providers.GroqClient{} }},
+		{"Together", "TOGETHER_API_KEY", "TOGETHER_BASE_URL", func() providers.ChatInterface { return &providers.TogetherClient{} }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, body := captureServer(t, "/chat/completions", openAIStream)
+			t.Setenv(tt.keyEnv, "sk-test-0123456789abcdefghij")
+			t.Setenv(tt.urlEnv, srv.URL)
+
+			client := tt.newChat()
+			if err := client.Initialize(providers.Config{}); err != nil {
+				t.Fatalf("Initialize() error: %v", err)
+			}
+			var events []providers.Event
+			sink := func(e providers.Event) { events = append(events, e) }
+			resp, err := client.SendMessage(context.Background(), userTurn("hello"), testParams(), sink)
+			if err != nil {
+				t.Fatalf("SendMessage() error: %v", err)
+			}
+			if resp.Content != "hi" {
+				t.Errorf("SendMessage() = %q, want %q", resp.Content, "hi")
+			}
+			assertEvents(t, events, "hi")
+			assertUsage(t, resp.Usage, 7, 2, 9)
+
+			assertField(t, *body, "temperature", 0.25)
+			assertField(t, *body, "max_tokens", 123.0)
+			assertField(t, *body, "top_p", 0.5)
+			assertField(t, *body, "stop", []interface{}{"END"})
+			assertField(t, *body, "seed", 42.0)
+			assertField(t, *body, "stream_options", map[string]interface{}{"include_usage": true})
+		})
+	}
+}
+
+func TestOpenAIZeroTemperature(t *testing.T) {
+	srv, body := captureServer(t, "/chat/completions", openAIStream)
+	client := &providers.CompatClient{}
+	if err := client.Initialize(providers.Config{BaseURL: srv.URL, Model: "m"}); err != nil {
+		t.Fatalf("Initialize() error: %v", err)
+	}
+	if _, err := client.SendMessage(context.Background(), userTurn("hello"), providers.MessageParams{}, nil); err != nil {
+		t.Fatalf("SendMessage() error: %v", err)
+	}
+	// A left-out temperature would mean the default of 1
+	temp, ok := (*body)["temperature"].(float64)
+	if !ok || temp <= 0 || temp > 1e-30 {
+		t.Errorf("temperature = %v, want a value as good as 0", (*body)["temperature"])
+	}
+}
+
+func TestCompatClient(t *testing.T) {
+	var auth, model string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth = r.Header.Get("Authorization")
+		var req struct{ Model string }
+		json.NewDecoder(r.Body).Decode(&req)
+		model = req.Model
+		openAIStream(w)
+	}))
+	defer srv.Close()
+	t.Setenv("GATEWAY_TOKEN", "gw-secret")
+
+	client := &providers.CompatClient{}
+	cfg := providers.Config{BaseURL: srv.URL, Model: "org/custom-model", APIKeyEnv: "GATEWAY_TOKEN"}
+	if err := client.Initialize(cfg); err != nil {
+		t.Fatalf("Initialize() error: %v", err)
+	}
+	if got := client.GetModelName(); got != "org/custom-model" {
+		t.Errorf("GetModelName() = %q, want the raw model ID", got)
+	}
+	resp, err := client.SendMessage(context.Background(), userTurn("hello"), testParams(), nil)
+	if err != nil {
+		t.Fatalf("SendMessage() error: %v", err)
+	}
+	if resp.Content != "hi" {
+		t.Errorf("SendMessage() = %q, want %q", resp.Content, "hi")
+	}
+	if model != "org/custom-model" {
+		t.Errorf("request model = %q, want %q", model, "org/custom-model")
+	}
+	if auth != "Bearer gw-secret" {
+		t.Errorf("Authorization = %q, want the key from GATEWAY_TOKEN", auth)
+	}
+}
+
+func TestCompatClientRequiresBaseURLAndModel(t *testing.T) {
+	t.Setenv(providers.CompatBaseEnv, "")
+	t.Setenv(providers.CompatModelEnv, "")
+
+	tests := []struct {
+		name string
+		cfg  providers.Config
+	}{
+		{"no base URL", providers.Config{Model: "m"}},
+		{"no model", providers.Config{BaseURL: "http://localhost:8000/v1"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := (&providers.CompatClient{}).Initialize(tt.cfg); err == nil {
+				t.Error("Initialize() expected error, got nil")
+			}
+		})
+	}
+}
+
+func TestRawModelIDs(t *testing.T) {
+	srv, _ := captureServer(t, "/api/chat", func(w http.ResponseWriter) {})
+	t.Setenv("OLLAMA_URL", srv.URL)
+
+	tests := []struct {
+		model string
+		want  string
+	}{
+		{"", "llama3:latest"},
+		{"mistral", "mistral:latest"},
+		{"qwen2.5-coder:7b", "qwen2.5-coder:7b"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			client := &providers.OllamaClient{}
+			if err := client.Initialize(providers.Config{Model: tt.model}); err != nil {
+				t.Fatalf("Initialize() error: %v", err)
+			}
+			if got := client.GetModelName(); got != tt.want {
+				t.Errorf("model %q selected %q, want %q", tt.model, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestListModels(t *testing.T) {
+	t.Run("Ollama", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/api/tags" {
+				fmt.Fprint(w, `{"models":[{"name":"mistral:latest"},{"name":"gemma:2b"}]}`)
+			}
+		}))
+		defer srv.Close()
+		t.Setenv("OLLAMA_URL", srv.URL)
+
+		client := &providers.OllamaClient{}
+		if err := client.Initialize(providers.Config{}); err != nil {
+			t.Fatalf("Initialize() error: %v", err)
+		}
+		assertModels(t, client, []string{"gemma:2b", "mistral:latest"})
+	})
+
+	t.Run("OpenAI-compatible", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/models" {
+				fmt.Fprint(w, `{"object":"list","data":[{"id":"local-b"},{"id":"local-a"}]}`)
+			}
+		}))
+		defer srv.Close()
+
+		// Without a model, the first one the server lists is used
+		client := &providers.CompatClient{}
+		if err := client.Initialize(providers.Config{BaseURL: srv.URL}); err != nil {
+			t.Fatalf("Initialize() error: %v", err)
+		}
+		if got := client.GetModelName(); got != "local-a" {
+			t.Errorf("GetModelName() = %q, want %q", got, "local-a")
+		}
+		assertModels(t, client, []string{"local-a", "local-b"})
+	})
+}
+
+func assertModels(t *testing.T, client providers.ModelLister, want []string) {
+	t.Helper()
+	got, err := client.ListModels(context.Background())
+	if err != nil {
+		t.Fatalf("ListModels() error: %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ListModels() = %v, want %v", got, want)
+	}
+}
+
+func TestOllamaParams(t *testing.T) {
+	srv, body := captureServer(t, "/api/chat", func(w http.ResponseWriter) {
+		fmt.Fprintln(w, `{"message":{"role":"assistant","content":"hi"},"done":false}`)
+		fmt.Fprintln(w, `{"message":{"role":"assistant","content":""},"done":true}`)
+	})
+	t.Setenv("OLLAMA_URL", srv.URL)
+
+	client := &providers.OllamaClient{}
+	if err := client.Initialize(providers.Config{}); err != nil {
+		t.Fatalf("Initialize() error: %v", err)
+	}
+	if _, err := client.SendMessage(context.Background(), userTurn("hello"), testParams(), nil); err != nil {
+		t.Fatalf("SendMessage() error: %v", err)
+	}
+
+	options, ok := (*body)["options"].(map[string]interface{})
+	if !ok {
+		t.Fatalf("request body missing options: %v", *body)
+	}
+	assertField(t, options, "temperature", 0.25)
+	assertField(t, options, "num_predict", 123.0)
+	assertField(t, options, "top_p", 0.5)
+	assertField(t, options, "stop", []interface{}{"END"})
+	assertField(t, options, "seed", 42.0)
+}
+
+func TestSambaParams(t *testing.T) {
+	srv, body := captureServer(t, "/chat/completions", func(w http.ResponseWriter) {
+		fmt.Fprint(w, `{"choices":[{"message":{"content":"hi"}}]}`)
+	})
+	t.Setenv("SAMBA_API_KEY", "samba-test-key")
+	t.Setenv("SAMBA_BASE_URL", srv.URL)
+
+	client := &providers.SambaClient{}
+	if err := client.Initialize(providers.Config{}); err != nil {
+		t.Fatalf("Initialize() error: %v", err)
+	}
+	if _, err := client.SendMessage(context.Background(), userTurn("hello"), testParams(), nil); err != nil {
+		t.Fatalf("SendMessage() error: %v", err)
+	}
+
+	assertField(t, *body, "temperature", 0.25)
+	assertField(t, *body, "max_tokens", 123.0)
+	assertField(t, *body, "top_p", 0.5)
+	assertField(t, *body, "stop", []interface{}{"END"})
+	assertField(t, *body, "seed", 42.0)
+}
+
+func TestGeminiParams(t *testing.T) {
+	srv, body := captureServer(t, "/v1beta/models/gemini-2.0-flash-lite:streamGenerateContent", func(w http.ResponseWriter) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `[{"candidates":[{"content":{"role":"model","parts":[{"text":"hi"}]}}]}]`)
+	})
+	t.Setenv("GEMINI_API_KEY", "gemini-test-key")
+	t.Setenv("GEMINI_BASE_URL", srv.URL)
+	t.Setenv("GEMINI_MODEL", "gemini-flash-lite")
+
+	client := &providers.GeminiClient{}
+	if err := client.Initialize(providers.Config{}); err != nil {
+		t.Fatalf("Initialize() error: %v", err)
+	}
+	// Only the request is asserted here: depending on the encoding/json version,
+	// gax may report the closing ']' of the response stream as an error
+	if _, err := client.SendMessage(context.Background(), userTurn("hello"), testParams(), nil); err != nil {
+		t.Logf("SendMessage() error: %v", err)
+	}
+
+	config, ok := (*body)["generationConfig"].(map[string]interface{})
+	if !ok {
+		t.Fatalf("request body missing generationConfig: %v", *body)
+	}
+	assertField(t, config, "temperature", 0.25)
+	assertField(t, config, "maxOutputTokens", 123.0)
+	assertField(t, config, "topP", 0.5)
+	assertField(t, config, "stopSequences", []interface{}{"END"})
+}
+
+func TestSystemPrompt(t *testing.T) {
+	cfg := providers.Config{SystemPrompt: "be brief"}
+	wantFirst := map[string]interface{}{"role": "system", "content": "be brief"}
+
+	t.Run("OpenAI", func(t *testing.T) {
+		srv, body := captureServer(t, "/chat/completions", openAIStream)
+		t.Setenv("OPENAI_API_KEY", "sk-test-0123456789abcdefghij")
+		t.Setenv("OPENAI_BASE_URL", srv.URL)
+
+		client := &providers.OpenAIClient{}
+		if err := client.Initialize(cfg); err != nil {
+			t.Fatalf("Initialize() error: %v", err)
+		}
+		if _, err := client.SendMessage(context.Background(), userTurn("hello"), testParams(), nil); err != nil {
+			t.Fatalf("SendMessage() error: %v", err)
+		}
+		messages, _ := (*body)["messages"].([]interface{})
+		if len(messages) == 0 || !reflect.DeepEqual(messages[0], wantFirst) {
+			t.Errorf("request messages = %v, want the system prompt first", messages)
+		}
+	})
+
+	t.Run("Samba", func(t *testing.T) {
+		srv, body := captureServer(t, "/chat/completions", func(w http.ResponseWriter) {
+			fmt.Fprint(w, `{"choices":[{"message":{"content":"hi"}}]}`)
+		})
+		t.Setenv("SAMBA_API_KEY", "samba-test-key")
+		t.Setenv("SAMBA_BASE_URL", srv.URL)
+
+		client := &providers.SambaClient{}
+		if err := client.Initialize(cfg); err != nil {
+			t.Fatalf("Initialize() error: %v", err)
+		}
+		if _, err := client.SendMessage(context.Background(), userTurn("hello"), testParams(), nil); err != nil {
+			t.Fatalf("SendMessage() error: %v", err)
+		}
+		messages, _ := (*body)["messages"].([]interface{})
+		if len(messages) == 0 || !reflect.DeepEqual(messages[0], wantFirst) {
+			t.Errorf("request messages = %v, want the system prompt first", messages)
+		}
+	})
+
+	t.Run("Gemini", func(t *testing.T) {
+		srv, body := captureServer(t, "/v1beta/models/gemini-2.0-flash-lite:streamGenerateContent", func(w http.ResponseWriter) {
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprint(w, `[{"candidates":[{"content":{"role":"model","parts":[{"text":"ok"}]}}]}]`)
+		})
+		t.Setenv("GEMINI_API_KEY", "gemini-test-key")
+		t.Setenv("GEMINI_BASE_URL", srv.URL)
+
+		client := &providers.GeminiClient{}
+		if err := client.Initialize(cfg); err != nil {
+			t.Fatalf("Initialize() error: %v", err)
+		}
+		if _, err := client.SendMessage(context.Background(), userTurn("hello"), testParams(), nil); err != nil {
+			t.Logf("SendMessage() error: %v", err)
+		}
+		want := map[string]interface{}{"parts": []interface{}{map[string]interface{}{"text": "be brief"}}}
+		if got := (*body)["systemInstruction"]; !reflect.DeepEqual(got, want) {
+			t.Errorf("request systemInstruction = %v, want %v", got, want)
+		}
+	})
+}
+
+func TestSendConversation(t *testing.T) {
+	conversation := []providers.Message{
+		{Role: "user", Content: "first question"},
+		{Role: "assistant", Content: "first answer"},
+		{Role: "user", Content: "second question"},
+	}
+
+	t.Run("Ollama", func(t *testing.T) {
+		srv, body := captureServer(t, "/api/chat", func(w http.ResponseWriter) {
+			fmt.Fprintln(w, `{"message":{"role":"assistant","content":"ok"},"done":true}`)
+		})
+		t.Setenv("OLLAMA_URL", srv.URL)
+
+		client := &providers.OllamaClient{}
+		if err := client.Initialize(providers.Config{SystemPrompt: "be brief"}); err != nil {
+			t.Fatalf("Initialize() error: %v", err)
+		}
+		if _, err := client.SendMessage(context.Background(), conversation, testParams(), nil); err != nil {
+			t.Fatalf("SendMessage() error: %v", err)
+		}
+		assertField(t, *body, "messages", []interface{}{
+			map[string]interface{}{"role": "system", "content": "be brief"},
+			map[string]interface{}{"role": "user", "content": "first question"},
+			map[string]interface{}{"role": "assistant", "content": "first answer"},
+			map[string]interface{}{"role": "user", "content": "second question"},
+		})
+	})
+
+	t.Run("Gemini", func(t *testing.T) {
+		srv, body := captureServer(t, "/v1beta/models/gemini-2.0-flash-lite:streamGenerateContent", func(w http.ResponseWriter) {
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprint(w, `[{"candidates":[{"content":{"role":"model","parts":[{"text":"ok"}]}}]}]`)
+		})
+		t.Setenv("GEMINI_API_KEY", "gemini-test-key")
+		t.Setenv("GEMINI_BASE_URL", srv.URL)
+
+		client := &providers.GeminiClient{}
+		if err := client.Initialize(providers.Config{}); err != nil {
+			t.Fatalf("Initialize() error: %v", err)
+		}
+		if _, err := client.SendMessage(context.Background(), conversation, testParams(), nil); err != nil {
+			t.Logf("SendMessage() error: %v", err)
+		}
+
+		// Gemini calls the assistant role "model"
+		contents, _ := (*body)["contents"].([]interface{})
+		var roles []interface{}
+		for _, c := range contents {
+			roles = append(roles, c.(map[string]interface{})["role"])
+		}
+		if want := []interface{}{"user", "model", "user"}; !reflect.DeepEqual(roles, want) {
+			t.Errorf("request roles = %v, want %v", roles, want)
+		}
+	})
+}
+
+func TestOllamaCancelReturnsPartialReply(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/chat" {
+			return
+		}
+		fmt.Fprintln(w, `{"message":{"role":"assistant","content":"partial"},"done":false}`)
+		w.(http.Flusher).Flush()
+		// Hold the stream open until the client gives up
+		<-r.Context().Done()
+	}))
+	defer srv.Close()
+	t.Setenv("OLLAMA_URL", srv.URL)
+
+	client := &providers.OllamaClient{}
+	if err := client.Initialize(providers.Config{}); err != nil {
+		t.Fatalf("Initialize() error: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	cancelOnDelta := func(e providers.Event) {
+		if e.Type == providers.EventDelta {
+			cancel()
+		}
+	}
+	resp, err := client.SendMessage(ctx, userTurn("first"), testParams(), cancelOnDelta)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("SendMessage() error = %v, want context.Canceled", err)
+	}
+	if resp.Content != "partial" {
+		t.Errorf("SendMessage() = %q, want partial reply %q", resp.Content, "partial")
+	}
+}
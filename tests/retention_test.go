@@ -0,0 +1,192 @@
+package tests
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/valdezdata/chat-cli/internal/history"
+)
+
+// storedPrompts returns the prompts in the history file, in order
+func storedPrompts(t *testing.T) []string {
+	t.Helper()
+	h, err := history.LoadHistory()
+	if err != nil {
+		t.Fatalf("LoadHistory() error: %v", err)
+	}
+	var prompts []string
+	for _, entry := range h.Entries {
+		prompts = append(prompts, entry.Prompt)
+	}
+	return prompts
+}
+
+func TestRetentionOnWrite(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name      string
+		retention history.Retention
+		want      string
+	}{
+		{"max entries", history.Retention{MaxEntries: 2}, "[p3 p4]"},
+		{"max age", history.Retention{MaxAge: 36 * time.Hour}, "[p3 p4]"},
+		{"max bytes", history.Retention{MaxBytes: 600}, "[p4]"},
+		{"unlimited", history.Retention{}, "[p1 p2 p3 p4]"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("HOME", t.TempDir())
+			history.SetRetention(tt.retention)
+			defer history.SetRetention(history.Retention{})
+
+			for i, age := range []int{72, 48, 24, 0} {
+				entry := history.Entry{
+					Timestamp: now.Add(-time.Duration(age) * time.Hour),
+					Prompt:    fmt.Sprintf("p%d", i+1),
+					Response:  fmt.Sprintf("%0300d", 0),
+				}
+				if err := history.AddEntry(entry); err != nil {
+					t.Fatalf("AddEntry() error: %v", err)
+				}
+			}
+			if got := fmt.Sprint(storedPrompts(t)); got != tt.want {
+				t.Errorf("history = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPruneAndDelete(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	day := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	entries := []history.Entry{
+		{ID: "aa01", Timestamp: day, Provider: "openai", Prompt: "old openai"},
+		{ID: "aa02", Timestamp: day, Provider: "groq", Prompt: "old groq"},
+		{ID: "bb01", Timestamp: day.AddDate(0, 1, 0), Provider: "openai", Prompt: "new openai"},
+		{ID: "bb02", Timestamp: day.AddDate(0, 1, 0), Provider: "ollama", Prompt: "secret"},
+	}
+	for _, entry := range entries {
+		if err := history.AddEntry(entry); err != nil {
+			t.Fatalf("AddEntry() error: %v", err)
+		}
+	}
+
+	removed, err := history.Prune(history.Filter{Provider: "openai", Until: day.AddDate(0, 0, 7)})
+	if err != nil || removed != 1 {
+		t.Fatalf("Prune() = %d, %v, want 1, nil", removed, err)
+	}
+	if got := fmt.Sprint(storedPrompts(t)); got != "[old groq new openai secret]" {
+		t.Errorf("after Prune() history = %s", got)
+	}
+
+	removed, err = history.DeleteEntries("bb02", "missing")
+	if err != nil || removed != 1 {
+		t.Fatalf("DeleteEntries() = %d, %v, want 1, nil", removed, err)
+	}
+	if got := fmt.Sprint(storedPrompts(t)); got != "[old groq new openai]" {
+		t.Errorf("after DeleteEntries() history = %s", got)
+	}
+}
+
+func TestRewritesKeepUnreadableLines(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	history.SetRetention(history.Retention{MaxEntries: 1})
+	defer history.SetRetention(history.Retention{})
+
+	path, err := history.GetHistoryFilePath()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A line that can't be read, such as one cut short by a crash
+	foreign := "{\"prompt\": \"cut sho\n"
+	if err := os.WriteFile(path, []byte(foreign), 0600); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	for i, prompt := range []string{"first", "second", "third"} {
+		entry := history.Entry{ID: fmt.Sprintf("id%d", i), Timestamp: now.Add(time.Duration(i) * time.Minute), Prompt: prompt}
+		if err := history.AddEntry(entry); err != nil {
+			t.Fatalf("AddEntry() error: %v", err)
+		}
+	}
+	if _, err := history.DeleteEntries("id2"); err != nil {
+		t.Fatalf("DeleteEntries() error: %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(data), foreign) {
+		t.Errorf("the unreadable line was not kept:\n%s", data)
+	}
+	if got := fmt.Sprint(storedPrompts(t)); got != "[]" {
+		t.Errorf("history = %s, want []", got)
+	}
+}
+
+func TestRetentionMeasuresTheFile(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	defer history.SetEncryption(history.Encryption{})
+	defer history.SetRetention(history.Retention{})
+	history.SetEncryption(history.Encryption{Enabled: true, Secret: []byte("correct horse")})
+
+	path, err := history.GetHistoryFilePath()
+	if err != nil {
+		t.Fatal(err)
+	}
+	add := func(prompt string) {
+		t.Helper()
+		if err := history.AddEntry(history.Entry{Timestamp: time.Now(), Prompt: prompt, Response: fmt.Sprintf("%0200d", 0)}); err != nil {
+			t.Fatalf("AddEntry() error: %v", err)
+		}
+	}
+	add("p1")
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Room for two entries in plain JSON, but only one encrypted
+	history.SetRetention(history.Retention{MaxBytes: info.Size() * 3 / 2})
+	add("p2")
+	if got := fmt.Sprint(storedPrompts(t)); got != "[p2]" {
+		t.Errorf("history = %s, want [p2]", got)
+	}
+}
+
+func TestRetentionNoticesOtherWriters(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	history.SetRetention(history.Retention{MaxEntries: 2})
+	defer history.SetRetention(history.Retention{})
+
+	now := time.Now()
+	for i, prompt := range []string{"p1", "p2"} {
+		if err := history.AddEntry(history.Entry{Timestamp: now.Add(time.Duration(i) * time.Minute), Prompt: prompt}); err != nil {
+			t.Fatalf("AddEntry() error: %v", err)
+		}
+	}
+
+	// Another process appends an entry
+	path, err := history.GetHistoryFilePath()
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fmt.Fprintf(f, "{\"timestamp\":%q,\"prompt\":\"p3\"}\n", now.Add(2*time.Minute).Format(time.RFC3339Nano))
+	f.Close()
+
+	if err := history.AddEntry(history.Entry{Timestamp: now.Add(3 * time.Minute), Prompt: "p4"}); err != nil {
+		t.Fatalf("AddEntry() error: %v", err)
+	}
+	if got := fmt.Sprint(storedPrompts(t)); got != "[p3 p4]" {
+		t.Errorf("history = %s, want [p3 p4]", got)
+	}
+}
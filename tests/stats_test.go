@@ -0,0 +1,68 @@
+package tests
+
+import (
+	"bytes"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/valdezdata/chat-cli/internal/history"
+)
+
+func TestComputeStats(t *testing.T) {
+	day := time.Date(2026, 10, 12, 12, 0, 0, 0, time.Local) // A Monday
+	score := func(n int) *history.Assessment { return &history.Assessment{OverallScore: n} }
+	entries := []history.Entry{
+		{Timestamp: day.AddDate(0, 0, 7), Provider: "groq", ModelName: "gemma2-9b-it", InputTokens: 10, OutputTokens: 100, TotalTokens: 110, TimeTaken: 1, Assessment: score(80)},
+		{Timestamp: day, Provider: "openai", ModelName: "gpt-4o", InputTokens: 1000, OutputTokens: 500, TotalTokens: 1500, TimeTaken: 5},
+		{Timestamp: day.Add(time.Hour), Provider: "groq", ModelName: "gemma2-9b-it", InputTokens: 20, OutputTokens: 200, TotalTokens: 220, TimeTaken: 4, Assessment: score(60)},
+		{Timestamp: day.AddDate(0, 0, 1), Provider: "groq", ModelName: "gemma2-9b-it", InputTokens: 5, OutputTokens: 50, TotalTokens: 55, TimeTaken: 0.5, Assessment: score(70)},
+	}
+	cost := func(provider, model string, in, out int) (float64, bool) {
+		if provider == "openai" {
+			return 0, false
+		}
+		return float64(in+out) / 1000, true
+	}
+
+	stats, total, err := history.ComputeStats(entries, "week", cost)
+	if err != nil {
+		t.Fatalf("ComputeStats() error: %v", err)
+	}
+	if len(stats) != 2 || stats[0].Key != "2026-W42" || stats[1].Key != "2026-W43" {
+		t.Fatalf("ComputeStats() weeks = %+v", stats)
+	}
+	week := stats[0]
+	if week.Turns != 3 || week.TotalTokens != 1775 || week.Unpriced != 1 || math.Abs(week.Cost-0.275) > 1e-9 {
+		t.Errorf("first week = %+v", week)
+	}
+	// Rates are 50 (gemma 200/4), 100 (gpt-4o 500/5) and 100 (gemma 50/0.5)
+	if week.Percentile(50) != 100 || week.Percentile(0) != 50 || week.Percentile(90) != 100 {
+		t.Errorf("first week rates = %v", week.TokensPerSec)
+	}
+	if week.Scored != 2 || week.AvgScore != 65 || week.ScoreTrend != 10 {
+		t.Errorf("first week scores = %d, %v, %v", week.Scored, week.AvgScore, week.ScoreTrend)
+	}
+	if total.Turns != 4 || math.Abs(total.AvgLatency-2.625) > 1e-9 || total.Scored != 3 || total.ScoreTrend != 20 {
+		t.Errorf("total = %+v", total)
+	}
+
+	stats, _, err = history.ComputeStats(entries, "model", cost)
+	if err != nil {
+		t.Fatalf("ComputeStats() error: %v", err)
+	}
+	if len(stats) != 2 || stats[0].Key != "groq/gemma2-9b-it" || stats[1].Key != "openai/gpt-4o" {
+		t.Errorf("ComputeStats() models = %+v", stats)
+	}
+
+	var buf bytes.Buffer
+	history.ShowStats(&buf, stats, total, "model")
+	if out := buf.String(); !strings.Contains(out, "groq/gemma2-9b-it") || !strings.Contains(out, "1 entries have no price") {
+		t.Errorf("ShowStats() output:\n%s", out)
+	}
+
+	if _, _, err := history.ComputeStats(entries, "month", cost); err == nil {
+		t.Error("ComputeStats() with an unknown grouping expected error, got nil")
+	}
+}
@@ -0,0 +1,107 @@
+package tests
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/valdezdata/chat-cli/internal/cli"
+	"github.com/valdezdata/chat-cli/internal/templates"
+)
+
+func TestTemplates(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	text := `{{/* Review code for security issues */}}
+Review this {{default "code" .lang}} for {{upper .focus}} issues.
+{{if .input}}
+{{.input}}
+{{end}}`
+	created, err := templates.Create("review", text)
+	if err != nil {
+		t.Fatalf("Create() error: %v", err)
+	}
+	if created.Description != "Review code for security issues" {
+		t.Errorf("Description = %q", created.Description)
+	}
+	if _, err := templates.Create("review", text); err == nil {
+		t.Error("Create() of an existing template expected error, got nil")
+	}
+	for _, bad := range []string{"../escape", "has space"} {
+		if _, err := templates.Create(bad, text); err == nil {
+			t.Errorf("Create(%q) expected error, got nil", bad)
+		}
+	}
+	if _, err := templates.Create("broken", "{{.oops"); err == nil {
+		t.Error("Create() with invalid syntax expected error, got nil")
+	}
+
+	list, err := templates.List()
+	if err != nil || len(list) != 1 || list[0].Name != "review" {
+		t.Fatalf("List() = %+v, %v", list, err)
+	}
+
+	loaded, err := templates.Load("review")
+	if err != nil {
+		t.Fatalf("Load() error: %v", err)
+	}
+	if got, want := loaded.Variables(), []string{"focus", "input", "lang"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Variables() = %v, want %v", got, want)
+	}
+
+	got, err := loaded.Render(map[string]string{"lang": "go", "focus": "security", "input": "func main() {}"})
+	if err != nil {
+		t.Fatalf("Render() error: %v", err)
+	}
+	if want := "Review this go for SECURITY issues.\n\nfunc main() {}"; got != want {
+		t.Errorf("Render() = %q, want %q", got, want)
+	}
+	got, _ = loaded.Render(nil)
+	if got != "Review this code for  issues." {
+		t.Errorf("Render(nil) = %q", got)
+	}
+
+	if _, err := templates.Load("missing"); err == nil {
+		t.Error("Load() of a missing template expected error, got nil")
+	}
+}
+
+func TestParseVars(t *testing.T) {
+	vars, err := templates.ParseVars([]string{"lang=go", "query=a=b", "empty="})
+	if err != nil {
+		t.Fatalf("ParseVars() error: %v", err)
+	}
+	if want := map[string]string{"lang": "go", "query": "a=b", "empty": ""}; !reflect.DeepEqual(vars, want) {
+		t.Errorf("ParseVars() = %v, want %v", vars, want)
+	}
+	if _, err := templates.ParseVars([]string{"novalue"}); err == nil {
+		t.Error("ParseVars() without '=' expected error, got nil")
+	}
+}
+
+func TestShellModeTemplate(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	if _, err := templates.Create("explain", "Explain {{.topic}} to a {{.audience}}. {{.prompt}}"); err != nil {
+		t.Fatal(err)
+	}
+
+	srv, body := captureServer(t, "/chat/completions", openAIStream)
+	cli.Chat(&cli.ChatOptions{
+		Provider:     cli.ProviderCompat,
+		BaseURL:      srv.URL,
+		Model:        "test-model",
+		Shell:        true,
+		ShellPrompt:  "Keep it short.",
+		Template:     "explain",
+		TemplateVars: map[string]string{"topic": "goroutines", "audience": "beginner"},
+		OutputFormat: "text",
+		Quiet:        true,
+		SkipHistory:  true,
+	})
+
+	sent := fmt.Sprint((*body)["messages"])
+	if !strings.Contains(sent, "Explain goroutines to a beginner. Keep it short.") {
+		t.Errorf("request messages = %s", sent)
+	}
+}
@@ -0,0 +1,46 @@
+package tests
+
+import (
+	"testing"
+
+	"github.com/valdezdata/chat-cli/internal/tokens"
+)
+
+type fixedEstimator struct{}
+
+func (fixedEstimator) Name() string          { return "fixed" }
+func (fixedEstimator) Count(text string) int { return 42 }
+
+func TestHeuristicEstimator(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want int
+	}{
+		{"empty", "", 0},
+		{"short word", "hi", 1},
+		{"characters dominate", "internationalization", 5},
+		{"words dominate", "a b c d e f g h", 8},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := (tokens.HeuristicEstimator{}).Count(tt.text); got != tt.want {
+				t.Errorf("Count(%q) = %d, want %d", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSetEstimator(t *testing.T) {
+	previous := tokens.Current()
+	defer tokens.SetEstimator(previous)
+
+	tokens.SetEstimator(fixedEstimator{})
+	if got := tokens.Estimate("anything"); got != 42 {
+		t.Errorf("Estimate() = %d, want 42 from the custom estimator", got)
+	}
+	if got := tokens.Current().Name(); got != "fixed" {
+		t.Errorf("Current().Name() = %q, want %q", got, "fixed")
+	}
+}
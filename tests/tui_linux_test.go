@@ -0,0 +1,117 @@
+package tests
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/sys/unix"
+	"golang.org/x/term"
+
+	"github.com/valdezdata/chat-cli/internal/cli"
+)
+
+// withTerminal runs fn with os.Stdin and os.Stdout on a pseudo-terminal, as
+// the TUI only reads keys from a terminal. It returns the end that types into
+// it, and a function that presses Enter until fn returns, then returns what
+// fn wrote.
+func withTerminal(t *testing.T, fn func()) (keys *os.File, wait func() string) {
+	t.Helper()
+	master, err := os.OpenFile("/dev/ptmx", os.O_RDWR|unix.O_NOCTTY, 0)
+	if err != nil {
+		t.Skipf("no pseudo-terminals: %v", err)
+	}
+	if err := unix.IoctlSetPointerInt(int(master.Fd()), unix.TIOCSPTLCK, 0); err != nil {
+		t.Fatal(err)
+	}
+	n, err := unix.IoctlGetInt(int(master.Fd()), unix.TIOCGPTN)
+	if err != nil {
+		t.Fatal(err)
+	}
+	slave, err := os.OpenFile(fmt.Sprintf("/dev/pts/%d", n), os.O_RDWR|unix.O_NOCTTY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Keys typed before the TUI starts arrive as they would after
+	if _, err := term.MakeRaw(int(slave.Fd())); err != nil {
+		t.Fatal(err)
+	}
+	if err := unix.IoctlSetWinsize(int(slave.Fd()), unix.TIOCSWINSZ, &unix.Winsize{Row: 40, Col: 100}); err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	copied := make(chan struct{})
+	go func() {
+		defer close(copied)
+		io.Copy(&out, master)
+	}()
+
+	stdin, stdout := os.Stdin, os.Stdout
+	os.Stdin, os.Stdout = slave, slave
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		fn()
+	}()
+	return master, func() string {
+		defer func() {
+			os.Stdin, os.Stdout = stdin, stdout
+		}()
+		// Enter is ignored while a request runs, so keep pressing it
+		for timeout := time.After(10 * time.Second); ; {
+			select {
+			case <-done:
+				slave.Close()
+				<-copied
+				master.Close()
+				return out.String()
+			case <-time.After(50 * time.Millisecond):
+				master.WriteString("\r")
+			case <-timeout:
+				t.Fatal("the TUI did not exit")
+			}
+		}
+	}
+}
+
+func TestTUIAttachmentOverBudget(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{"big.txt": strings.Repeat("line of text\n", 2000)})
+	chdir(t, dir)
+	srv, bodies := recordServer(t)
+	opts := &cli.ChatOptions{
+		Provider:      cli.ProviderCompat,
+		BaseURL:       srv.URL,
+		Model:         "test-model",
+		ContextTokens: 60,
+		Files:         []string{"big.txt"},
+		SkipHistory:   true,
+		LogLevel:      "error",
+		Render:        cli.RenderNone,
+	}
+
+	// The warning about big.txt is written while the prompt is sent, which
+	// must not stall the screen
+	keys, wait := withTerminal(t, func() { cli.TUI(opts, "", nil) })
+	keys.WriteString("Summarize\r/exit")
+	out := wait()
+
+	got := bodies()
+	if len(got) != 1 {
+		t.Fatalf("got %d requests, want 1", len(got))
+	}
+	messages := got[0]["messages"].([]interface{})
+	prompt := messages[len(messages)-1].(map[string]interface{})["content"].(string)
+	if !strings.HasPrefix(prompt, "Summarize\n\nFile: big.txt (truncated)\n") {
+		t.Errorf("prompt = %.80q..., want big.txt truncated", prompt)
+	}
+	if !strings.Contains(out, "Truncated big.txt") {
+		t.Errorf("output is missing the truncation warning:\n%s", out)
+	}
+}